@@ -28,7 +28,7 @@ build_and_package() {
 
     # Build the application
     echo "Building ${BINARY_NAME}..."
-    GOOS=$OS GOARCH=$ARCH go build -o "build/$BINARY_NAME" "$PROJECT_DIR"
+    GOOS=$OS GOARCH=$ARCH go build -tags sqlite_fts5 -o "build/$BINARY_NAME" "$PROJECT_DIR"
 
     # Compress the binary
     echo "Packaging ${BINARY_NAME}..."
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/Utility-Gods/gottem/internal/db"
+)
+
+const dbUsage = `usage: gottem db migrate [--status] [--to N]
+
+  --status  list the schema migrations and which have been applied
+  --to N    migrate up or down to schema version N, default the latest.
+            Going down drops tables and columns with their data.`
+
+// runDBCommand handles "gottem db ..." and returns the exit code
+func runDBCommand(args []string) int {
+	if len(args) == 0 || args[0] != "migrate" {
+		fmt.Fprintln(os.Stderr, dbUsage)
+		return 2
+	}
+
+	flags := flag.NewFlagSet("gottem db migrate", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprintln(os.Stderr, dbUsage) }
+	status := flags.Bool("status", false, "")
+	to := flags.Int("to", -1, "")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	if err := db.Open(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open database: %v\n", err)
+		return 1
+	}
+	defer db.CloseDB()
+
+	if *status {
+		if err := printMigrationStatus(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read migration status: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	target := *to
+	if target < 0 {
+		latest, err := db.LatestSchemaVersion()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read migrations: %v\n", err)
+			return 1
+		}
+		target = latest
+	}
+
+	if err := db.MigrateTo(target); err != nil {
+		fmt.Fprintf(os.Stderr, "Migration failed: %v\n", err)
+		return 1
+	}
+	if err := db.EnsureSearchIndex(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to prepare chat search: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Database is at schema version %d.\n", target)
+	return 0
+}
+
+func printMigrationStatus() error {
+	migrations, err := db.MigrationStatus()
+	if err != nil {
+		return err
+	}
+	current, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Schema version %d, latest %d\n\n", current, len(migrations))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Version\tName\tStatus")
+	for _, m := range migrations {
+		state := "pending"
+		if m.Applied {
+			state = "applied"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", m.Version, m.Name, state)
+	}
+	return w.Flush()
+}
@@ -2,12 +2,22 @@ package main
 
 import (
 	"log"
+	"os"
 
+	"github.com/Utility-Gods/gottem/internal/config"
 	"github.com/Utility-Gods/gottem/internal/db"
 	"github.com/Utility-Gods/gottem/internal/menu"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "db" {
+		os.Exit(runDBCommand(os.Args[2:]))
+	}
+
+	if err := config.Load(); err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
 	if err := db.InitDB(); err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
@@ -1,40 +1,130 @@
 package api
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"time"
 
 	"github.com/Utility-Gods/gottem/pkg/types"
 )
 
 // App represents the main application structure
 type App struct {
-	APIs map[string]types.APIInfo
+	APIs   map[string]types.APIInfo
+	models *modelCache
 }
 
 func NewApp() *App {
 	return &App{
-		APIs: GetAPIHandlers(),
+		APIs:   GetAPIHandlers(),
+		models: newModelCache(),
 	}
 }
 
-// HandleQuery processes a query for a specific API
-func (a *App) HandleQuery(apiShortcut, query string, chatID int, context string) (string, error) {
-	api, exists := a.APIs[apiShortcut]
-	if !exists {
-		return "", fmt.Errorf("no API found for shortcut '%s'", apiShortcut)
+// HandleQuery sends a conversation to a specific API and returns the reply
+// to its final user message. When the chat has caching on, the answer to an
+// identical earlier request is returned without sending it.
+func (a *App) HandleQuery(ctx context.Context, apiShortcut string, query types.Request) (types.Response, error) {
+	api, err := a.lookup(apiShortcut, query.Messages)
+	if err != nil {
+		return types.Response{}, err
+	}
+	cached, key, ok := cachedResponse(api, query)
+	if ok {
+		return cached, nil
+	}
+	prepared, err := a.prepareQuery(ctx, api, query)
+	if err != nil {
+		response := types.Response{Provider: api.Name}
+		prepared.finish(&response)
+		return response, err
 	}
 
-	fullQuery := context + "\n\nHuman: " + query + "\n\nAssistant:"
-	response := api.Handler.HandleQuery(fullQuery)
+	start := time.Now()
+	response, err := send(ctx, api.Handler, prepared.Request, nil)
+	if err == nil {
+		response, err = continueAnswer(ctx, api, prepared.Request, response, nil)
+	}
+	response.Latency = time.Since(start)
+	prepared.finish(&response)
+	if response.Provider == "" {
+		response.Provider = api.Name
+	}
+	if err == nil {
+		cacheResponse(key, response)
+	}
+	return response, err
+}
+
+// StreamQuery sends a conversation to a specific API, calling onDelta with
+// partial output as it arrives. Handlers that cannot stream deliver the whole
+// response as a single delta. Answers cut off by max_tokens are continued
+// when the chat's continue parameter allows it.
+func (a *App) StreamQuery(ctx context.Context, apiShortcut string, query types.Request, onDelta func(delta string)) (types.Response, error) {
+	api, err := a.lookup(apiShortcut, query.Messages)
+	if err != nil {
+		return types.Response{}, err
+	}
+	cached, key, ok := cachedResponse(api, query)
+	if ok {
+		onDelta(cached.Text)
+		return cached, nil
+	}
+	prepared, err := a.prepareQuery(ctx, api, query)
+	if err != nil {
+		response := types.Response{Provider: api.Name}
+		prepared.finish(&response)
+		return response, err
+	}
 
-	return response, nil
+	start := time.Now()
+	response, err := send(ctx, api.Handler, prepared.Request, onDelta)
+	if err == nil {
+		response, err = continueAnswer(ctx, api, prepared.Request, response, onDelta)
+	}
+	response.Latency = time.Since(start)
+	prepared.finish(&response)
+
+	if response.Provider == "" {
+		response.Provider = api.Name
+	}
+	if err == nil {
+		cacheResponse(key, response)
+	}
+	return response, err
+}
+
+// prepareQuery fits the conversation into the model's context window and
+// refuses requests that would cross a hard monthly budget. Fallback chains
+// prepare the request for each member as they try it instead.
+func (a *App) prepareQuery(ctx context.Context, api types.APIInfo, query types.Request) (preparedQuery, error) {
+	if _, ok := api.Handler.(*FallbackAPI); ok {
+		return preparedQuery{Request: query}, nil
+	}
+	return prepareQuery(ctx, api, query)
+}
+
+func (a *App) lookup(apiShortcut string, messages []types.Message) (types.APIInfo, error) {
+	api, exists := a.APIs[apiShortcut]
+	if !exists {
+		return types.APIInfo{}, fmt.Errorf("no API found for shortcut '%s'", apiShortcut)
+	}
+	if _, ok := LastUserMessage(messages); !ok {
+		return types.APIInfo{}, fmt.Errorf("conversation must end with a user message")
+	}
+	return api, nil
 }
 
-// GetAvailableAPIs returns a list of available APIs
+// GetAvailableAPIs returns a list of available APIs, sorted by name so the
+// order is the same every time
 func (a *App) GetAvailableAPIs() []types.APIInfo {
 	apis := make([]types.APIInfo, 0, len(a.APIs))
 	for _, api := range a.APIs {
 		apis = append(apis, api)
 	}
+	sort.Slice(apis, func(i, j int) bool {
+		return apis[i].Name < apis[j].Name
+	})
 	return apis
 }
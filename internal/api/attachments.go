@@ -0,0 +1,321 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Utility-Gods/gottem/internal/db"
+	"github.com/Utility-Gods/gottem/pkg/types"
+)
+
+const (
+	// maxImageSize is the largest image Claude and OpenAI accept
+	maxImageSize = 5 << 20
+	// maxDocumentSize caps inlined text documents, which count towards the
+	// context window
+	maxDocumentSize = 512 << 10
+	// imageTokens roughly estimates what an image costs in input tokens
+	imageTokens = 1600
+)
+
+// imageTypes are the image formats every provider with image input accepts
+var imageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// attachmentToken matches @path or @"path with spaces" at the start of a
+// word
+var attachmentToken = regexp.MustCompile(`(?:^|\s)@(?:"([^"]+)"|(\S+))`)
+
+// AttachmentToken returns the token that references name in a message,
+// quoting it if it contains spaces
+func AttachmentToken(name string) string {
+	if strings.ContainsAny(name, " \t") {
+		return `@"` + name + `"`
+	}
+	return "@" + name
+}
+
+// attachmentNames returns the names referenced by @ tokens in content.
+// Trailing punctuation is dropped from unquoted names so "see @notes.txt."
+// refers to notes.txt.
+func attachmentNames(content string) []string {
+	var names []string
+	for _, match := range attachmentToken.FindAllStringSubmatch(content, -1) {
+		name := match[1]
+		if name == "" {
+			name = strings.TrimRight(match[2], ".,;:!?)")
+		}
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// LoadAttachment reads a file to attach to a message. Only the image types
+// the providers accept and text documents are supported.
+// A leading ~/ stands for the home directory.
+func LoadAttachment(name string) (types.Attachment, error) {
+	path := name
+	if rest, ok := strings.CutPrefix(name, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, rest)
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return types.Attachment{}, err
+	}
+	if info.IsDir() {
+		return types.Attachment{}, fmt.Errorf("%s is a directory", path)
+	}
+	if info.Size() > maxImageSize {
+		return types.Attachment{}, fmt.Errorf("%s is too large (%d KB, the limit is %d KB)", path, info.Size()>>10, maxImageSize>>10)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return types.Attachment{}, err
+	}
+
+	mimeType := detectMIMEType(path, data)
+	switch {
+	case imageTypes[mimeType]:
+	case strings.HasPrefix(mimeType, "text/"):
+		if len(data) > maxDocumentSize {
+			return types.Attachment{}, fmt.Errorf("%s is too large (%d KB, the limit for documents is %d KB)", path, len(data)>>10, maxDocumentSize>>10)
+		}
+	default:
+		return types.Attachment{}, fmt.Errorf("%s is a %s file, only PNG, JPEG, GIF and WebP images and text documents can be attached", path, mimeType)
+	}
+
+	return types.Attachment{Name: name, MIMEType: mimeType, Data: data}, nil
+}
+
+// detectMIMEType goes by the file's content, then its extension. Content
+// that is valid UTF-8 without NUL bytes is treated as plain text, so source
+// files and other unregistered extensions can be attached.
+func detectMIMEType(path string, data []byte) string {
+	sniffed, _, _ := strings.Cut(http.DetectContentType(data), ";")
+	if imageTypes[sniffed] {
+		return sniffed
+	}
+
+	byExtension, _, _ := strings.Cut(mime.TypeByExtension(filepath.Ext(path)), ";")
+	switch {
+	case strings.HasPrefix(byExtension, "text/"):
+		return byExtension
+	case byExtension == "application/json", byExtension == "application/xml", byExtension == "application/x-yaml":
+		return "text/plain"
+	}
+
+	if utf8.Valid(data) && bytes.IndexByte(data, 0) < 0 {
+		return "text/plain"
+	}
+	if byExtension != "" {
+		return byExtension
+	}
+	return sniffed
+}
+
+// SkippedAttachment is an @ token of the message being sent that names a
+// file which cannot be attached, such as a directory or a file that is too
+// large. The token is sent as plain text.
+type SkippedAttachment struct {
+	Name string
+	Err  error
+}
+
+func (s SkippedAttachment) String() string {
+	return fmt.Sprintf("@%s sent as text (%v)", s.Name, s.Err)
+}
+
+// ResolveAttachments parses a chat's transcript into messages with the
+// files their @ tokens reference attached. Each message sends its own copy
+// of a file: the one stored when the message first sent it, or attached to
+// it with AttachFile. Files a message has not sent before are read now and
+// their copies recorded against it, so later changes to the file only reach
+// later messages. Tokens that do not name a file that can be attached are
+// left as plain text; those in the last user message are returned as
+// skipped, unless nothing exists at that path.
+func (a *App) ResolveAttachments(chatID int, transcript string) ([]types.Message, []SkippedAttachment, error) {
+	stored, err := db.GetMessages(chatID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	turns := splitTurns(transcript)
+	saved := transcriptMessages(stored, turns)
+	lastUser := -1
+	for i, t := range turns {
+		if t.role == types.RoleUser {
+			lastUser = i
+		}
+	}
+
+	messages := make([]types.Message, len(turns))
+	var skipped []SkippedAttachment
+	changed := false
+	for i, t := range turns {
+		messages[i] = types.Message{Role: t.role, Content: t.content}
+		if t.role != types.RoleUser {
+			continue
+		}
+
+		var refs []db.AttachmentRef
+		for _, name := range attachmentNames(t.content) {
+			attachment, ref, err := storedAttachment(chatID, saved[i].Attachments, name)
+			if err != nil {
+				return nil, nil, err
+			}
+			if attachment.Name == "" {
+				attachment, err = LoadAttachment(name)
+				if err != nil {
+					if !os.IsNotExist(err) {
+						debugf("Sending @%s as text: %v", name, err)
+						if i == lastUser {
+							skipped = append(skipped, SkippedAttachment{Name: name, Err: err})
+						}
+					}
+					continue
+				}
+				hash, err := db.SaveAttachment(chatID, attachment)
+				if err != nil {
+					return nil, nil, err
+				}
+				ref = db.AttachmentRef{Name: name, Hash: hash}
+			}
+			refs = append(refs, ref)
+			messages[i].Attachments = append(messages[i].Attachments, attachment)
+		}
+		if !sameRefs(refs, saved[i].Attachments) {
+			saved[i].Attachments = refs
+			changed = true
+		}
+	}
+
+	if changed {
+		if err := db.ReplaceMessages(chatID, saved); err != nil {
+			return nil, nil, err
+		}
+	}
+	return mergeConsecutive(messages), skipped, nil
+}
+
+// storedAttachment returns the copy of name a message sent before, or a zero
+// attachment if it has not sent one or the copy is missing
+func storedAttachment(chatID int, refs []db.AttachmentRef, name string) (types.Attachment, db.AttachmentRef, error) {
+	for _, ref := range refs {
+		if ref.Name != name {
+			continue
+		}
+		attachment, err := db.GetAttachment(chatID, ref)
+		return attachment, ref, err
+	}
+	return types.Attachment{}, db.AttachmentRef{}, nil
+}
+
+func sameRefs(a, b []db.AttachmentRef) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// AttachFile stores a copy of a file and records it against the last user
+// message of the transcript, replacing any copy of the same name that
+// message had. Other messages keep the copies they sent.
+func (a *App) AttachFile(chatID int, transcript string, attachment types.Attachment) error {
+	stored, err := db.GetMessages(chatID)
+	if err != nil {
+		return err
+	}
+	messages := transcriptMessages(stored, splitTurns(transcript))
+
+	last := -1
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == types.RoleUser {
+			last = i
+			break
+		}
+	}
+	if last < 0 {
+		return fmt.Errorf("there is no message to attach %s to", attachment.Name)
+	}
+
+	hash, err := db.SaveAttachment(chatID, attachment)
+	if err != nil {
+		return err
+	}
+	var refs []db.AttachmentRef
+	for _, ref := range messages[last].Attachments {
+		if ref.Name != attachment.Name {
+			refs = append(refs, ref)
+		}
+	}
+	messages[last].Attachments = append(refs, db.AttachmentRef{Name: attachment.Name, Hash: hash})
+
+	return db.ReplaceMessages(chatID, messages)
+}
+
+// messageText is the message's content followed by its inlined text
+// documents
+func messageText(m types.Message) string {
+	var b strings.Builder
+	b.WriteString(m.Content)
+	for _, a := range m.Attachments {
+		if !a.IsImage() {
+			fmt.Fprintf(&b, "\n\n<document name=%q>\n%s\n</document>", a.Name, a.Data)
+		}
+	}
+	return b.String()
+}
+
+// messageImages returns the message's image attachments
+func messageImages(m types.Message) []types.Attachment {
+	var images []types.Attachment
+	for _, a := range m.Attachments {
+		if a.IsImage() {
+			images = append(images, a)
+		}
+	}
+	return images
+}
+
+// messageTokens estimates the tokens a message's content and attachments
+// take up
+func messageTokens(estimate func(string) int, m types.Message) int {
+	return estimate(messageText(m)) + len(messageImages(m))*imageTokens
+}
+
+// dataURL encodes an image for providers that take images as URLs
+func dataURL(a types.Attachment) string {
+	return "data:" + a.MIMEType + ";base64," + base64.StdEncoding.EncodeToString(a.Data)
+}
+
+// noImagesError reports that a provider cannot take image attachments
+func noImagesError(provider string) error {
+	return &types.APIError{
+		Kind:     types.ErrBadRequest,
+		Provider: provider,
+		Message:  "images cannot be attached for this provider, remove the @ reference or pick another API",
+	}
+}
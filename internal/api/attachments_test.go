@@ -0,0 +1,38 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAttachmentNames(t *testing.T) {
+	tests := []struct {
+		content string
+		want    []string
+	}{
+		{"no attachments", nil},
+		{"@notes.txt", []string{"notes.txt"}},
+		{"see @notes.txt.", []string{"notes.txt"}},
+		{"compare @a.png, @b.png)", []string{"a.png", "b.png"}},
+		{"(@inside.png)", nil},
+		{`read @"my notes.md" please`, []string{"my notes.md"}},
+		{"mail me@example.com", nil},
+		{"line one\n@next.txt", []string{"next.txt"}},
+		{"just @ and @...", nil},
+	}
+
+	for _, tt := range tests {
+		if got := attachmentNames(tt.content); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("attachmentNames(%q) = %q, want %q", tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestAttachmentTokenRoundTrip(t *testing.T) {
+	for _, name := range []string{"notes.txt", "my notes.md", "tab\tname.txt"} {
+		got := attachmentNames("see " + AttachmentToken(name))
+		if len(got) != 1 || got[0] != name {
+			t.Errorf("token %q refers to %q, want %q", AttachmentToken(name), got, name)
+		}
+	}
+}
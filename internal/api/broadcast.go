@@ -0,0 +1,47 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Utility-Gods/gottem/pkg/types"
+)
+
+// BroadcastResult is one API's answer to a broadcast query
+type BroadcastResult struct {
+	Shortcut string
+	Response types.Response
+	Err      error
+	Latency  time.Duration
+}
+
+// Broadcast sends the same conversation to several APIs at once. Deltas and
+// results are tagged with the index of the API in shortcuts, and onDone is
+// called as each API finishes. Broadcast returns once all of them have.
+//
+// Each API uses its default model, since a model chosen for one provider
+// rarely exists on another.
+func (a *App) Broadcast(ctx context.Context, shortcuts []string, query types.Request, onDelta func(i int, delta string), onDone func(i int, result BroadcastResult)) {
+	query.Model = ""
+
+	var wg sync.WaitGroup
+	for i, shortcut := range shortcuts {
+		wg.Add(1)
+		go func(i int, shortcut string) {
+			defer wg.Done()
+
+			start := time.Now()
+			response, err := a.StreamQuery(ctx, shortcut, query, func(delta string) {
+				onDelta(i, delta)
+			})
+			onDone(i, BroadcastResult{
+				Shortcut: shortcut,
+				Response: response,
+				Err:      err,
+				Latency:  time.Since(start),
+			})
+		}(i, shortcut)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Utility-Gods/gottem/internal/db"
+	"github.com/Utility-Gods/gottem/pkg/types"
+)
+
+// BudgetWarning reports that a request is expected to take spending past a
+// soft monthly budget, or that its cost could not be estimated
+type BudgetWarning struct {
+	Budget   string  // "Overall" or the provider's name
+	Spent    float64 // Spent so far this month
+	Estimate float64 // Estimated cost of the request
+	Limit    float64
+	Unpriced string // The model, when it has no price and the request was not counted
+}
+
+func (w BudgetWarning) String() string {
+	if w.Unpriced != "" {
+		return fmt.Sprintf("%s budget: %s has no price, so this request is not counted against the soft limit of $%.2f",
+			w.Budget, w.Unpriced, w.Limit)
+	}
+	return fmt.Sprintf("%s budget: $%.2f spent this month, this request ~$%.4f, soft limit $%.2f",
+		w.Budget, w.Spent, w.Estimate, w.Limit)
+}
+
+// localAPI is implemented by handlers for model servers on the user's own
+// machine, whose requests cost nothing
+type localAPI interface {
+	Local() bool
+}
+
+type budgetWarningKey struct{}
+
+// WithBudgetWarning returns a context that reports soft budget overruns to
+// notify. Requests still go ahead.
+func WithBudgetWarning(ctx context.Context, notify func(BudgetWarning)) context.Context {
+	return context.WithValue(ctx, budgetWarningKey{}, notify)
+}
+
+func notifyBudgetWarning(ctx context.Context, warning BudgetWarning) {
+	if notify, ok := ctx.Value(budgetWarningKey{}).(func(BudgetWarning)); ok {
+		notify(warning)
+	}
+}
+
+// checkBudget estimates what a request to api will cost and compares it with
+// the overall and per-provider monthly budgets. It returns an ErrBudget error
+// if a hard limit would be crossed and warns through ctx for soft limits.
+// The estimate assumes the whole max_tokens allowance is used. Local models
+// are free. When a hard limit applies but the cost cannot be estimated,
+// because the model has no price or the spending cannot be read, the
+// request is refused rather than let through unchecked; a price of 0 marks a
+// model as free.
+func checkBudget(ctx context.Context, api types.APIInfo, query types.Request) error {
+	if local, ok := api.Handler.(localAPI); ok && local.Local() {
+		return nil
+	}
+
+	var budgets []db.Budget
+	for _, provider := range []string{"", api.Name} {
+		budget, err := db.GetBudget(provider)
+		if err != nil {
+			return budgetError(api, fmt.Sprintf("the monthly budgets could not be read: %v", err))
+		}
+		if budget.Soft > 0 || budget.Hard > 0 {
+			budgets = append(budgets, budget)
+		}
+	}
+	if len(budgets) == 0 {
+		return nil
+	}
+
+	model := modelFor(api, query)
+	price, err := db.GetModelPrice(model)
+	if err != nil {
+		debugf("No price for %s: %v", model, err)
+	}
+	priced := err == nil && price.Model != ""
+
+	inputTokens := 0
+	for _, m := range withSystemPrompt(query) {
+		inputTokens += messageTokens(estimateTokens, m)
+	}
+	estimate := (float64(inputTokens)*price.InputPrice + float64(maxTokens(query.Params))*price.OutputPrice) / 1e6
+
+	for _, budget := range budgets {
+		name := budget.Provider
+		if name == "" {
+			name = "Overall"
+		}
+
+		if !priced {
+			if budget.Hard > 0 {
+				return budgetError(api, fmt.Sprintf("%s has no price, so it cannot be checked against the %s monthly budget of $%.2f. "+
+					"Add a price under Settings → Usage & Costs, 0 if the model is free", model, name, budget.Hard))
+			}
+			notifyBudgetWarning(ctx, BudgetWarning{Budget: name, Limit: budget.Soft, Unpriced: model})
+			continue
+		}
+
+		spent, err := db.GetMonthSpend(budget.Provider)
+		if err != nil {
+			if budget.Hard > 0 {
+				return budgetError(api, fmt.Sprintf("this month's spending could not be read to check the %s budget: %v", name, err))
+			}
+			debugf("Soft budget check skipped for %s: %v", api.Name, err)
+			continue
+		}
+
+		if budget.Hard > 0 && spent+estimate > budget.Hard {
+			return budgetError(api, fmt.Sprintf("%s monthly budget of $%.2f would be exceeded ($%.2f spent, this request ~$%.4f)",
+				name, budget.Hard, spent, estimate))
+		}
+		if budget.Soft > 0 && spent+estimate > budget.Soft {
+			notifyBudgetWarning(ctx, BudgetWarning{Budget: name, Spent: spent, Estimate: estimate, Limit: budget.Soft})
+		}
+	}
+
+	return nil
+}
+
+func budgetError(api types.APIInfo, message string) error {
+	return &types.APIError{
+		Kind:     types.ErrBudget,
+		Provider: api.Name,
+		Message:  message,
+	}
+}
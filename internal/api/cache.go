@@ -0,0 +1,121 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Utility-Gods/gottem/internal/db"
+	"github.com/Utility-Gods/gottem/pkg/types"
+)
+
+// DefaultCacheTTL is how long cached responses are reused when no TTL has
+// been saved
+const DefaultCacheTTL = 24 * time.Hour
+
+// cacheTTLSetting is the key the cache TTL is stored under in the settings
+// table
+const cacheTTLSetting = "cache.ttl"
+
+// LoadCacheTTL reads the cache TTL, falling back to the default if it is
+// unset or invalid
+func LoadCacheTTL() time.Duration {
+	if value, err := db.GetSetting(cacheTTLSetting); err == nil && value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			return d
+		}
+	}
+	return DefaultCacheTTL
+}
+
+// SaveCacheTTL stores how long cached responses are reused
+func SaveCacheTTL(ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("the TTL must be positive")
+	}
+	return db.SetSetting(cacheTTLSetting, ttl.String())
+}
+
+// cachedResponse looks a request up in the response cache when the chat has
+// caching switched on. The cache key is returned so a fresh answer can be
+// stored under it; it is empty when the request should not be cached.
+func cachedResponse(api types.APIInfo, query types.Request) (types.Response, string, bool) {
+	if !query.Params.Cache {
+		return types.Response{}, "", false
+	}
+
+	key, err := cacheKey(api, query)
+	if err != nil {
+		debugf("Response cache skipped for %s: %v", api.Name, err)
+		return types.Response{}, "", false
+	}
+
+	cached, err := db.GetCachedResponse(key, LoadCacheTTL())
+	if err != nil {
+		debugf("Response cache lookup failed for %s: %v", api.Name, err)
+		return types.Response{}, key, false
+	}
+	if cached.Key == "" {
+		return types.Response{}, key, false
+	}
+
+	return types.Response{Text: cached.Text, Model: cached.Model, Provider: cached.Provider, Cached: true}, key, true
+}
+
+// cacheResponse stores a successful answer under key. Answers that ran tools
+// are not stored, since replaying them would skip the tools.
+func cacheResponse(key string, response types.Response) {
+	if key == "" || response.Text == "" || response.Tools > 0 {
+		return
+	}
+
+	err := db.SaveCachedResponse(db.CachedResponse{
+		Key:      key,
+		Provider: response.Provider,
+		Model:    response.Model,
+		Text:     response.Text,
+	})
+	if err != nil {
+		debugf("Failed to cache response from %s: %v", response.Provider, err)
+	}
+}
+
+// cacheKey hashes everything that decides the answer: the API, the model,
+// the parameters, the summary and the normalized messages
+func cacheKey(api types.APIInfo, query types.Request) (string, error) {
+	params := query.Params
+	params.Cache = false
+
+	messages := make([]types.Message, len(query.Messages))
+	for i, m := range query.Messages {
+		m.Content = normalizeText(m.Content)
+		messages[i] = m
+	}
+
+	data, err := json.Marshal(struct {
+		API      string
+		Model    string
+		Params   types.Params
+		Summary  types.Summary
+		Messages []types.Message
+	}{api.Name, modelFor(api, query), params, query.Summary, messages})
+	if err != nil {
+		return "", fmt.Errorf("error encoding cache key: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// normalizeText unifies line endings and trims trailing spaces and blank
+// lines, so edits that do not change the message still hit the cache
+func normalizeText(text string) string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
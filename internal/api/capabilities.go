@@ -0,0 +1,145 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Utility-Gods/gottem/pkg/types"
+)
+
+// newAPIInfo registers a handler along with what it supports
+func newAPIInfo(name, shortcut string, handler types.APIHandler) types.APIInfo {
+	return types.APIInfo{Name: name, Shortcut: shortcut, Handler: handler, Capabilities: capabilitiesOf(handler)}
+}
+
+// capabilitiesOf asks a handler what it supports. Handlers that do not say
+// are assumed to take text and system prompts only.
+func capabilitiesOf(handler types.APIHandler) types.Capabilities {
+	if reporter, ok := handler.(types.CapabilityReporter); ok {
+		return reporter.Capabilities()
+	}
+
+	_, streaming := handler.(types.StreamingAPIHandler)
+	caps := types.Capabilities{Streaming: streaming, SystemPrompt: true}
+	if limiter, ok := handler.(types.ContextLimiter); ok {
+		if lister, ok := handler.(types.ModelLister); ok {
+			caps.ContextSize = limiter.ContextSize(lister.DefaultModel())
+		}
+	}
+	return caps
+}
+
+// visionReporter is implemented by handlers where image input depends on
+// the model. SupportsVision may have to ask the server, KnownVision only
+// returns what is already known.
+type visionReporter interface {
+	SupportsVision(model string) bool
+	KnownVision(model string) (vision, known bool)
+}
+
+// ModelCapabilities returns what an API supports with a specific model. The
+// context size, and for some APIs vision, depend on the model; an empty
+// model means the default. Finding out about vision may mean a request to
+// the API, so the editor's event loop uses ImageSupport instead.
+func ModelCapabilities(info types.APIInfo, model string) types.Capabilities {
+	caps := info.Capabilities
+	if limiter, ok := info.Handler.(types.ContextLimiter); ok && model != "" {
+		caps.ContextSize = limiter.ContextSize(model)
+	}
+	if reporter, ok := info.Handler.(visionReporter); ok {
+		caps.Vision = reporter.SupportsVision(defaultModel(info, model))
+	}
+	return caps
+}
+
+// ProbeModel finds out in the background what an API supports with a model,
+// so ImageSupport can answer for it without waiting
+func ProbeModel(info types.APIInfo, model string) {
+	if reporter, ok := info.Handler.(visionReporter); ok {
+		go reporter.SupportsVision(defaultModel(info, model))
+	}
+}
+
+// ImageSupport reports whether an API takes images with a model, without
+// waiting on the API. known is false while that is still being found out,
+// see ProbeModel.
+func ImageSupport(info types.APIInfo, model string) (vision, known bool) {
+	if reporter, ok := info.Handler.(visionReporter); ok {
+		return reporter.KnownVision(defaultModel(info, model))
+	}
+	return info.Capabilities.Vision, true
+}
+
+// defaultModel returns model, or the API's default when it is empty
+func defaultModel(info types.APIInfo, model string) string {
+	if model == "" {
+		if lister, ok := info.Handler.(types.ModelLister); ok {
+			return lister.DefaultModel()
+		}
+	}
+	return model
+}
+
+// FormatCapabilities lists what an API supports, e.g. "streaming, vision,
+// 200k context"
+func FormatCapabilities(caps types.Capabilities) string {
+	var parts []string
+	for _, c := range []struct {
+		ok   bool
+		name string
+	}{
+		{caps.Streaming, "streaming"},
+		{caps.Vision, "vision"},
+		{caps.Tools, "tools"},
+		{caps.SystemPrompt, "system prompts"},
+		{caps.JSONMode, "JSON mode"},
+	} {
+		if c.ok {
+			parts = append(parts, c.name)
+		}
+	}
+	if caps.ContextSize > 0 {
+		parts = append(parts, fmt.Sprintf("%dk context", caps.ContextSize/1000))
+	}
+	if len(parts) == 0 {
+		return "text only"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// checkCapabilities refuses a request that uses something api does not
+// support, before anything is sent. Unconfigured APIs are left to fail with
+// their configuration error.
+func checkCapabilities(api types.APIInfo, query types.Request) error {
+	if _, ok := api.Handler.(*ErrorAPI); ok {
+		return nil
+	}
+
+	caps := ModelCapabilities(api, query.Model)
+	var missing string
+	switch {
+	case hasImages(query.Messages) && !caps.Vision:
+		return noImagesError(api.Name)
+	case query.Params.JSON && !caps.JSONMode:
+		missing = "JSON mode, run :unset json or pick another API"
+	case !caps.SystemPrompt && hasSystemPrompt(query):
+		missing = "system prompts, remove them or pick another API"
+	default:
+		return nil
+	}
+
+	return &types.APIError{
+		Kind:     types.ErrBadRequest,
+		Provider: api.Name,
+		Message:  "does not support " + missing,
+	}
+}
+
+func hasSystemPrompt(query types.Request) bool {
+	for _, m := range withSystemPrompt(query) {
+		if m.Role == types.RoleSystem {
+			return true
+		}
+	}
+	return false
+}
@@ -2,123 +2,537 @@ package api
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"io"
-	"log"
 	"net/http"
-	"time"
+	"strings"
 
-	"github.com/Utility-Gods/gottem/internal/db"
-	"github.com/briandowns/spinner"
+	"github.com/Utility-Gods/gottem/pkg/types"
 )
 
 const (
-	claudeAPIURL = "https://api.anthropic.com/v1/messages"
+	claudeName         = "Claude API"
+	claudeKeyName      = "claude"
+	claudeKeyEnv       = "ANTHROPIC_API_KEY"
+	claudeBaseURL      = "https://api.anthropic.com/v1"
+	claudeDefaultModel = "claude-3-opus-20240229"
+	claudeContextSize  = 200000 // Every Claude 3 model
+	claudeMaxTokens    = "max_tokens"
+
+	// thinkingLabel starts extended thinking in the transcript
+	thinkingLabel = "Thinking:"
 )
 
+// claudeModels is used when the models endpoint cannot be reached
+var claudeModels = []string{
+	"claude-3-5-sonnet-20240620",
+	"claude-3-opus-20240229",
+	"claude-3-sonnet-20240229",
+	"claude-3-haiku-20240307",
+}
+
 // ClaudeAPI implements the APIHandler interface for Claude API
 type ClaudeAPI struct {
-	apiKey string
-	client *http.Client
+	key     handlerKey
+	baseURL string
+	http    *httpClient
 }
 
 // NewClaudeAPI creates a new instance of ClaudeAPI
 func NewClaudeAPI() (*ClaudeAPI, error) {
-	apiKey, err := db.GetAPIKey("claude")
+	key, err := resolveAPIKey(claudeKeyName, claudeKeyEnv)
 	if err != nil {
 		return nil, fmt.Errorf("error getting Claude API key: %w", err)
 	}
-	if apiKey == "" {
+	if key.Key == "" {
 		return nil, fmt.Errorf("Claude API key not set. Please run setup")
 	}
 
+	network := loadNetworkSettings(claudeName)
+	client, err := newHTTPClient(claudeName, network, hostedTimeout)
+	if err != nil {
+		return nil, err
+	}
+
 	return &ClaudeAPI{
-		apiKey: apiKey,
-		client: &http.Client{Timeout: 30 * time.Second},
+		key:     handlerKey{name: claudeKeyName, variable: claudeKeyEnv},
+		baseURL: baseURLFor(network, claudeBaseURL),
+		http:    client,
 	}, nil
 }
 
-func (c *ClaudeAPI) HandleQuery(query string) string {
-	if c.client == nil {
-		log.Println("HTTP client is nil")
-		return "Error: HTTP client not initialized"
+// Capabilities reports what the Messages API supports. It has no JSON mode.
+func (c *ClaudeAPI) Capabilities() types.Capabilities {
+	return types.Capabilities{
+		Streaming:    true,
+		Vision:       true,
+		Tools:        true,
+		SystemPrompt: true,
+		ContextSize:  claudeContextSize,
 	}
+}
+
+// DefaultModel returns the model used when a chat has not picked one
+func (c *ClaudeAPI) DefaultModel() string {
+	return claudeDefaultModel
+}
 
-	// Create a new spinner
-	s := spinner.New(spinner.CharSets[9], 100*time.Millisecond)
-	s.Suffix = " Querying Claude API..."
-	s.Start()
+// ContextSize returns the context window of a Claude model in tokens
+func (c *ClaudeAPI) ContextSize(model string) int {
+	return claudeContextSize
+}
 
-	// Defer stopping the spinner
-	defer s.Stop()
+func (c *ClaudeAPI) EstimateTokens(text string) int {
+	return estimateTokens(text)
+}
 
-	// Prepare the messages for the API request
-	messages := []map[string]string{
-		{"role": "user", "content": query},
+// ListModels returns the models available to the configured API key
+func (c *ClaudeAPI) ListModels(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/models?limit=100", nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	if err := c.setHeaders(req); err != nil {
+		return nil, err
 	}
 
-	requestBody, err := json.Marshal(map[string]interface{}{
-		"model":      "claude-3-opus-20240229",
-		"max_tokens": 1000,
-		"messages":   messages,
-	})
+	resp, err := c.http.Do(ctx, req)
 	if err != nil {
-		// log.Printf("Error creating request body: %v", err)
-		return fmt.Sprintf("Error creating request body: %v", err)
+		return nil, err
 	}
+	defer resp.Body.Close()
 
-	req, err := http.NewRequest("POST", claudeAPIURL, bytes.NewBuffer(requestBody))
+	var result struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error parsing model list: %w", err)
+	}
+
+	models := make([]string, 0, len(result.Data))
+	for _, m := range result.Data {
+		models = append(models, m.ID)
+	}
+	return models, nil
+}
+
+func (c *ClaudeAPI) HandleQuery(ctx context.Context, query types.Request) (types.Response, error) {
+	if c.http == nil {
+		return types.Response{}, fmt.Errorf("HTTP client not initialized")
+	}
+
+	req, err := c.newRequest(ctx, query, false, nil, false)
 	if err != nil {
-		// log.Printf("Error creating request: %v", err)
-		return fmt.Sprintf("Error creating request: %v", err)
+		return types.Response{}, err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", c.apiKey)
-	req.Header.Set("anthropic-version", "2023-06-01")
+	resp, err := c.http.DoQuery(ctx, req, requestTokens(query))
+	if err != nil {
+		return types.Response{}, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Model      string        `json:"model"`
+		Content    []claudeBlock `json:"content"`
+		StopReason string        `json:"stop_reason"`
+		Usage      claudeUsage   `json:"usage"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return types.Response{}, requestError(ctx, claudeName, fmt.Errorf("error reading response: %w", err))
+	}
+
+	if len(result.Content) == 0 && result.StopReason == "" {
+		return types.Response{}, fmt.Errorf("unexpected response format from Claude API")
+	}
+
+	// Every block is kept, with thinking and tool calls labelled so they
+	// read apart from the answer
+	var text strings.Builder
+	for _, b := range result.Content {
+		switch b.Type {
+		case "text":
+			text.WriteString(b.Text)
+		case "thinking", "redacted_thinking":
+			text.WriteString(b.thinkingStart() + b.Thinking + "\n\n")
+		case "tool_use":
+			text.WriteString(toolCallText(ToolCall{ID: b.ID, Name: b.Name, Arguments: string(b.Input)}))
+		}
+	}
+
+	return types.Response{
+		Text:       text.String(),
+		Model:      result.Model,
+		Usage:      result.Usage.usage(),
+		StopReason: result.StopReason,
+		Truncated:  result.StopReason == claudeMaxTokens,
+	}, nil
+}
+
+// StreamQuery sends the query with streaming enabled and calls onDelta for
+// every text delta received from the Claude API. When the context allows
+// tools, tool calls are confirmed, run and sent back until Claude answers.
+func (c *ClaudeAPI) StreamQuery(ctx context.Context, query types.Request, onDelta func(delta string)) (types.Response, error) {
+	if c.http == nil {
+		return types.Response{}, fmt.Errorf("HTTP client not initialized")
+	}
+
+	var text strings.Builder
+	var usage types.Usage
+	var rounds []map[string]interface{}
+	var stopReason string
+	tools := 0
+	record := func(delta string) {
+		text.WriteString(delta)
+		onDelta(delta)
+	}
+	response := func() types.Response {
+		return types.Response{Text: text.String(), Model: c.model(query), Usage: usage, Tools: tools,
+			StopReason: stopReason, Truncated: stopReason == claudeMaxTokens}
+	}
+
+	for round := 0; ; round++ {
+		turn, err := c.streamTurn(ctx, query, rounds, round < maxToolRounds, record)
+		usage.InputTokens += turn.usage.InputTokens
+		usage.OutputTokens += turn.usage.OutputTokens
+		stopReason = turn.stopReason
+		if err != nil {
+			return response(), requestError(ctx, claudeName, err)
+		}
+		// A turn cut off by max_tokens may hold a half-written tool call
+		if len(turn.calls) == 0 || turn.stopReason == claudeMaxTokens {
+			break
+		}
+
+		tools += len(turn.calls)
+		results := runToolCalls(ctx, turn.calls, record)
+		blocks := make([]map[string]interface{}, 0, len(results))
+		for _, r := range results {
+			blocks = append(blocks, map[string]interface{}{
+				"type":        "tool_result",
+				"tool_use_id": r.call.ID,
+				"content":     r.content,
+				"is_error":    r.isError,
+			})
+		}
+		rounds = append(rounds,
+			map[string]interface{}{"role": "assistant", "content": turn.content},
+			map[string]interface{}{"role": "user", "content": blocks},
+		)
+	}
+
+	return response(), nil
+}
+
+// claudeTurn is one streamed assistant message
+type claudeTurn struct {
+	content    []map[string]interface{} // Content blocks, replayed with tool results
+	calls      []ToolCall
+	usage      types.Usage
+	stopReason string
+}
 
-	resp, err := c.client.Do(req)
+// streamTurn streams one assistant message after the conversation and any
+// earlier tool rounds. allowTools is false once the model has used up its
+// tool rounds, so it has to answer.
+func (c *ClaudeAPI) streamTurn(ctx context.Context, query types.Request, rounds []map[string]interface{}, allowTools bool, onDelta func(delta string)) (claudeTurn, error) {
+	var turn claudeTurn
+
+	req, err := c.newRequest(ctx, query, true, rounds, allowTools)
+	if err != nil {
+		return turn, err
+	}
+
+	resp, err := c.http.DoQuery(ctx, req, requestTokens(query))
 	if err != nil {
-		// log.Printf("Error making request to Claude API: %v", err)
-		return fmt.Sprintf("Error making request to Claude API: %v", err)
+		return turn, err
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	var usage claudeUsage
+	var blocks []*claudeBlock
+	err = readSSE(resp.Body, func(event, data string) error {
+		switch event {
+		case "message_start":
+			// Input tokens are reported up front, output tokens as they grow
+			var start struct {
+				Message struct {
+					Usage claudeUsage `json:"usage"`
+				} `json:"message"`
+			}
+			if err := json.Unmarshal([]byte(data), &start); err != nil {
+				return fmt.Errorf("error parsing stream event: %w", err)
+			}
+			usage = start.Message.Usage
+		case "message_delta":
+			var delta struct {
+				Delta struct {
+					StopReason string `json:"stop_reason"`
+				} `json:"delta"`
+				Usage claudeUsage `json:"usage"`
+			}
+			if err := json.Unmarshal([]byte(data), &delta); err != nil {
+				return fmt.Errorf("error parsing stream event: %w", err)
+			}
+			usage.OutputTokens = delta.Usage.OutputTokens
+			turn.stopReason = delta.Delta.StopReason
+		case "content_block_start":
+			var start struct {
+				ContentBlock claudeBlock `json:"content_block"`
+			}
+			if err := json.Unmarshal([]byte(data), &start); err != nil {
+				return fmt.Errorf("error parsing stream event: %w", err)
+			}
+			blocks = append(blocks, &start.ContentBlock)
+			if start.ContentBlock.isThinking() {
+				onDelta(start.ContentBlock.thinkingStart())
+			}
+		case "content_block_stop":
+			if len(blocks) > 0 && blocks[len(blocks)-1].isThinking() {
+				onDelta("\n\n")
+			}
+		case "content_block_delta":
+			var chunk struct {
+				Delta struct {
+					Type        string `json:"type"`
+					Text        string `json:"text"`
+					Thinking    string `json:"thinking"`
+					Signature   string `json:"signature"`
+					PartialJSON string `json:"partial_json"`
+				} `json:"delta"`
+			}
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+				return fmt.Errorf("error parsing stream event: %w", err)
+			}
+			if len(blocks) == 0 {
+				return nil
+			}
+			block := blocks[len(blocks)-1]
+			switch chunk.Delta.Type {
+			case "text_delta":
+				block.Text += chunk.Delta.Text
+				if chunk.Delta.Text != "" {
+					onDelta(chunk.Delta.Text)
+				}
+			case "thinking_delta":
+				block.Thinking += chunk.Delta.Thinking
+				if chunk.Delta.Thinking != "" {
+					onDelta(chunk.Delta.Thinking)
+				}
+			case "signature_delta":
+				block.Signature += chunk.Delta.Signature
+			case "input_json_delta":
+				block.input.WriteString(chunk.Delta.PartialJSON)
+			}
+		case "error":
+			// Errors after the stream has started, such as overloaded_error
+			return &types.APIError{Kind: types.ErrServer, Provider: claudeName, Message: errorMessage([]byte(data))}
+		}
+		return nil
+	})
+	turn.usage = usage.usage()
+	if err != nil {
+		return turn, err
+	}
+
+	for _, b := range blocks {
+		switch b.Type {
+		case "text":
+			if b.Text != "" {
+				turn.content = append(turn.content, map[string]interface{}{"type": "text", "text": b.Text})
+			}
+		case "thinking":
+			// Thinking is replayed with tool results so Claude can carry on
+			turn.content = append(turn.content, map[string]interface{}{"type": "thinking", "thinking": b.Thinking, "signature": b.Signature})
+		case "redacted_thinking":
+			turn.content = append(turn.content, map[string]interface{}{"type": "redacted_thinking", "data": b.Data})
+		case "tool_use":
+			arguments := b.input.String()
+			if arguments == "" {
+				arguments = "{}"
+			}
+			turn.content = append(turn.content, map[string]interface{}{
+				"type":  "tool_use",
+				"id":    b.ID,
+				"name":  b.Name,
+				"input": json.RawMessage(arguments),
+			})
+			turn.calls = append(turn.calls, ToolCall{ID: b.ID, Name: b.Name, Arguments: arguments})
+		}
+	}
+
+	return turn, nil
+}
+
+// claudeBlock is a content block of a response. Streamed blocks collect
+// their tool input in input, complete ones carry it in Input.
+type claudeBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text"`
+	Thinking  string          `json:"thinking"`
+	Signature string          `json:"signature"`
+	Data      string          `json:"data"` // Encrypted redacted thinking
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Input     json.RawMessage `json:"input"`
+	input     strings.Builder
+}
+
+func (b *claudeBlock) isThinking() bool {
+	return b.Type == "thinking" || b.Type == "redacted_thinking"
+}
+
+// thinkingStart labels thinking in the transcript. Redacted thinking cannot
+// be shown, so only the label is written.
+func (b *claudeBlock) thinkingStart() string {
+	if b.Type == "redacted_thinking" {
+		return "\n\n" + thinkingLabel + " (redacted)"
+	}
+	return "\n\n" + thinkingLabel + " "
+}
+
+// claudeUsage is the usage block of the Messages API
+type claudeUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+func (u claudeUsage) usage() types.Usage {
+	return types.Usage{InputTokens: u.InputTokens, OutputTokens: u.OutputTokens}
+}
+
+func (c *ClaudeAPI) model(query types.Request) string {
+	if query.Model != "" {
+		return query.Model
+	}
+	return claudeDefaultModel
+}
+
+// newRequest builds a Messages API request for the conversation followed by
+// any tool rounds. Tools are only offered when the context can confirm them,
+// and allowTools false forbids further calls.
+func (c *ClaudeAPI) newRequest(ctx context.Context, query types.Request, stream bool, rounds []map[string]interface{}, allowTools bool) (*http.Request, error) {
+	system, turns := claudeMessages(withSystemPrompt(query))
+
+	body := map[string]interface{}{
+		"model":      c.model(query),
+		"max_tokens": maxTokens(query.Params),
+		"messages":   append(turns, rounds...),
+		"stream":     stream,
+	}
+	if system != "" {
+		body["system"] = system
+	}
+	if stream && toolsEnabled(ctx) {
+		body["tools"] = claudeTools()
+		if !allowTools {
+			body["tool_choice"] = map[string]string{"type": "none"}
+		}
+	}
+	if query.Params.Temperature != nil {
+		body["temperature"] = *query.Params.Temperature
+	}
+	if query.Params.TopP != nil {
+		body["top_p"] = *query.Params.TopP
+	}
+	if len(query.Params.Stop) > 0 {
+		body["stop_sequences"] = query.Params.Stop
+	}
+
+	requestBody, err := json.Marshal(body)
 	if err != nil {
-		// log.Printf("Error reading response body: %v", err)
-		return fmt.Sprintf("Error reading response body: %v", err)
+		return nil, fmt.Errorf("error creating request body: %w", err)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		// log.Printf("Error from Claude API: %s", body)
-		return fmt.Sprintf("Error from Claude API: %s", body)
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/messages", bytes.NewBuffer(requestBody))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
 	}
 
-	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
-		// log.Printf("Error parsing response: %v", err)
-		return fmt.Sprintf("Error parsing response: %v", err)
+	req.Header.Set("Content-Type", "application/json")
+	if err := c.setHeaders(req); err != nil {
+		return nil, err
+	}
+	if stream {
+		req.Header.Set("Accept", "text/event-stream")
 	}
 
-	content, ok := result["content"].([]interface{})
-	if !ok || len(content) == 0 {
-		// log.Println("Unexpected response format from Claude API")
-		return "Unexpected response format from Claude API"
+	return req, nil
+}
+
+// setHeaders adds the API key and version headers every request needs
+func (c *ClaudeAPI) setHeaders(req *http.Request) error {
+	apiKey, err := c.key.get()
+	if err != nil {
+		return fmt.Errorf("error getting Claude API key: %w", err)
+	}
+	if apiKey == "" {
+		return fmt.Errorf("Claude API key not set. Please run setup")
+	}
+	req.Header.Set("x-api-key", apiKey)
+	req.Header.Set("anthropic-version", "2023-06-01")
+	return nil
+}
+
+// claudeMessages maps a conversation onto the Messages API format. System
+// messages are lifted into the top-level system prompt and the remaining
+// turns must start with a user message.
+func claudeMessages(messages []types.Message) (string, []map[string]interface{}) {
+	var system []string
+	var turns []types.Message
+	for _, m := range messages {
+		if m.Role == types.RoleSystem {
+			system = append(system, m.Content)
+			continue
+		}
+		turns = append(turns, m)
 	}
 
-	firstContent, ok := content[0].(map[string]interface{})
-	if !ok {
-		// log.Println("Unexpected content format from Claude API")
-		return "Unexpected content format from Claude API"
+	turns = mergeConsecutive(turns)
+	for len(turns) > 0 && turns[0].Role != types.RoleUser {
+		turns = turns[1:]
 	}
 
-	text, ok := firstContent["text"].(string)
-	if !ok {
-		// log.Println("Unable to extract text from Claude API response")
-		return "Unable to extract text from Claude API response"
+	result := make([]map[string]interface{}, 0, len(turns))
+	for _, m := range turns {
+		images := messageImages(m)
+		if len(images) == 0 {
+			result = append(result, map[string]interface{}{"role": string(m.Role), "content": messageText(m)})
+			continue
+		}
+
+		// Images go before the text, as Claude recommends
+		blocks := make([]map[string]interface{}, 0, len(images)+1)
+		for _, image := range images {
+			blocks = append(blocks, map[string]interface{}{
+				"type": "image",
+				"source": map[string]string{
+					"type":       "base64",
+					"media_type": image.MIMEType,
+					"data":       base64.StdEncoding.EncodeToString(image.Data),
+				},
+			})
+		}
+		blocks = append(blocks, map[string]interface{}{"type": "text", "text": messageText(m)})
+		result = append(result, map[string]interface{}{"role": string(m.Role), "content": blocks})
 	}
 
-	return text
+	return strings.Join(system, "\n\n"), result
+}
+
+// claudeTools describes the registered tools in the Messages API format
+func claudeTools() []map[string]interface{} {
+	result := make([]map[string]interface{}, 0, len(Tools()))
+	for _, t := range Tools() {
+		result = append(result, map[string]interface{}{
+			"name":         t.Name,
+			"description":  t.Description,
+			"input_schema": t.Parameters,
+		})
+	}
+	return result
 }
@@ -0,0 +1,562 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Utility-Gods/gottem/pkg/types"
+)
+
+// CompatibleConfig describes an endpoint that speaks the OpenAI chat
+// completions protocol, such as OpenAI itself, Groq, Together, OpenRouter,
+// LM Studio or vLLM
+type CompatibleConfig struct {
+	Name         string            // Display name, e.g. "Groq API"
+	Shortcut     string            // Key used to register the handler
+	KeyName      string            // Name the API key is stored under
+	KeyEnv       string            // The provider's own environment variable for the key, if any
+	BaseURL      string            // Base URL without the /chat/completions suffix
+	AuthHeader   string            // Header carrying the key, defaults to Authorization
+	AuthScheme   string            // Prefix for the key, e.g. "Bearer"; empty sends the bare key
+	DefaultModel string            // Model sent when a chat has not picked one
+	Models       []string          // Fallback model list when /models cannot be reached
+	Headers      map[string]string // Extra headers sent with every request
+	KeyOptional  bool              // Local servers often need no key at all
+	Local        bool              // Runs on the user's machine, so requests are free
+	StreamUsage  bool              // Ask for token usage in streams via stream_options
+	Tools        bool              // Offer local tools as functions
+	Images       bool              // Accepts image attachments
+	JSONMode     bool              // Accepts response_format json_object
+	ContextSizes map[string]int    // Context window by model name prefix, "" for any model
+}
+
+// Built-in configurations for the OpenAI-compatible providers gottem ships with
+var (
+	OpenAIConfig = CompatibleConfig{
+		Name:         "OpenAI API",
+		Shortcut:     "o",
+		KeyName:      "openai",
+		KeyEnv:       "OPENAI_API_KEY",
+		BaseURL:      "https://api.openai.com/v1",
+		AuthHeader:   "Authorization",
+		AuthScheme:   "Bearer",
+		DefaultModel: "gpt-4",
+		Models:       []string{"gpt-4o", "gpt-4-turbo", "gpt-4", "gpt-3.5-turbo"},
+		StreamUsage:  true,
+		Tools:        true,
+		Images:       true,
+		JSONMode:     true,
+		ContextSizes: map[string]int{
+			"gpt-4o":        128000,
+			"gpt-4-turbo":   128000,
+			"gpt-4":         8192,
+			"gpt-3.5-turbo": 16385,
+		},
+	}
+	GroqConfig = CompatibleConfig{
+		Name:         "Groq API",
+		Shortcut:     "g",
+		KeyName:      "groq",
+		KeyEnv:       "GROQ_API_KEY",
+		BaseURL:      "https://api.groq.com/openai/v1",
+		AuthHeader:   "Authorization",
+		AuthScheme:   "Bearer",
+		DefaultModel: "llama3-70b-8192",
+		Models:       []string{"llama3-70b-8192", "llama3-8b-8192", "mixtral-8x7b-32768", "gemma-7b-it"},
+		Tools:        true,
+		JSONMode:     true,
+		ContextSizes: map[string]int{
+			"llama3":             8192,
+			"mixtral-8x7b-32768": 32768,
+			"gemma-7b-it":        8192,
+		},
+	}
+)
+
+// CompatibleAPI implements the APIHandler interface for any OpenAI-compatible
+// chat completions endpoint
+type CompatibleAPI struct {
+	config CompatibleConfig
+	key    handlerKey
+	http   *httpClient
+}
+
+// NewCompatibleAPI creates a handler for the endpoint described by config
+func NewCompatibleAPI(config CompatibleConfig) (*CompatibleAPI, error) {
+	network := loadNetworkSettings(config.Name)
+	if network.BaseURL != "" {
+		config.BaseURL = network.BaseURL
+	}
+	if config.BaseURL == "" {
+		return nil, fmt.Errorf("%s base URL not set", config.Name)
+	}
+	if config.AuthHeader == "" {
+		config.AuthHeader = "Authorization"
+	}
+
+	key := handlerKey{name: config.KeyName, variable: config.KeyEnv}
+	apiKey, err := key.get()
+	if err != nil {
+		return nil, fmt.Errorf("error getting %s key: %w", config.Name, err)
+	}
+	if apiKey == "" && !config.KeyOptional {
+		return nil, fmt.Errorf("%s key not set. Please run setup", config.Name)
+	}
+
+	timeout := hostedTimeout
+	if config.KeyOptional {
+		timeout = localTimeout
+	}
+	client, err := newHTTPClient(config.Name, network, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CompatibleAPI{
+		config: config,
+		key:    key,
+		http:   client,
+	}, nil
+}
+
+// NewOpenAIAPI creates a handler for the OpenAI API
+func NewOpenAIAPI() (*CompatibleAPI, error) {
+	return NewCompatibleAPI(OpenAIConfig)
+}
+
+// NewGroqAPI creates a handler for the Groq API
+func NewGroqAPI() (*CompatibleAPI, error) {
+	return NewCompatibleAPI(GroqConfig)
+}
+
+// Capabilities reports what the endpoint supports according to its config
+func (c *CompatibleAPI) Capabilities() types.Capabilities {
+	return types.Capabilities{
+		Streaming:    true,
+		Vision:       c.config.Images,
+		Tools:        c.config.Tools,
+		SystemPrompt: true,
+		JSONMode:     c.config.JSONMode,
+		ContextSize:  c.ContextSize(c.config.DefaultModel),
+	}
+}
+
+// Local reports whether the endpoint is a model server on the user's own
+// machine
+func (c *CompatibleAPI) Local() bool {
+	return c.config.Local
+}
+
+// DefaultModel returns the model used when a chat has not picked one
+func (c *CompatibleAPI) DefaultModel() string {
+	return c.config.DefaultModel
+}
+
+// ListModels returns the model IDs served by the endpoint's /models route
+func (c *CompatibleAPI) ListModels(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", strings.TrimSuffix(c.config.BaseURL, "/")+"/models", nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	if err := c.setHeaders(req); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.http.Do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error parsing model list: %w", err)
+	}
+
+	models := make([]string, 0, len(result.Data))
+	for _, m := range result.Data {
+		models = append(models, m.ID)
+	}
+	return models, nil
+}
+
+func (c *CompatibleAPI) HandleQuery(ctx context.Context, query types.Request) (types.Response, error) {
+	if c.http == nil {
+		return types.Response{}, fmt.Errorf("HTTP client not initialized")
+	}
+
+	req, err := c.newRequest(ctx, query, false, nil, false)
+	if err != nil {
+		return types.Response{}, err
+	}
+
+	resp, err := c.http.DoQuery(ctx, req, requestTokens(query))
+	if err != nil {
+		return types.Response{}, err
+	}
+	defer resp.Body.Close()
+
+	response, err := readChatCompletion(ctx, c.config.Name, resp.Body)
+	if response.Model == "" {
+		response.Model = c.model(query)
+	}
+	return response, err
+}
+
+// StreamQuery sends the query with streaming enabled and calls onDelta for
+// every text delta received from the endpoint. When the provider and the
+// context allow tools, tool calls are confirmed, run and sent back until the
+// model answers.
+func (c *CompatibleAPI) StreamQuery(ctx context.Context, query types.Request, onDelta func(delta string)) (types.Response, error) {
+	if c.http == nil {
+		return types.Response{}, fmt.Errorf("HTTP client not initialized")
+	}
+
+	var text strings.Builder
+	var usage types.Usage
+	var rounds []map[string]interface{}
+	var stopReason string
+	tools := 0
+	record := func(delta string) {
+		text.WriteString(delta)
+		onDelta(delta)
+	}
+	response := func() types.Response {
+		return types.Response{Text: text.String(), Model: c.model(query), Usage: usage, Tools: tools,
+			StopReason: stopReason, Truncated: stopReason == finishLength}
+	}
+
+	for round := 0; ; round++ {
+		turn, calls, err := c.streamTurn(ctx, query, rounds, round < maxToolRounds, record)
+		usage.InputTokens += turn.Usage.InputTokens
+		usage.OutputTokens += turn.Usage.OutputTokens
+		stopReason = turn.StopReason
+		if err != nil {
+			return response(), requestError(ctx, c.config.Name, err)
+		}
+		// A turn cut off by max_tokens may hold a half-written tool call
+		if len(calls) == 0 || turn.Truncated {
+			break
+		}
+
+		tools += len(calls)
+		toolCalls := make([]map[string]interface{}, 0, len(calls))
+		for _, call := range calls {
+			toolCalls = append(toolCalls, map[string]interface{}{
+				"id":       call.ID,
+				"type":     "function",
+				"function": map[string]string{"name": call.Name, "arguments": call.Arguments},
+			})
+		}
+		rounds = append(rounds, map[string]interface{}{"role": "assistant", "content": turn.Text, "tool_calls": toolCalls})
+		for _, r := range runToolCalls(ctx, calls, record) {
+			rounds = append(rounds, map[string]interface{}{"role": "tool", "tool_call_id": r.call.ID, "content": r.content})
+		}
+	}
+
+	return response(), nil
+}
+
+// streamTurn streams one assistant message after the conversation and any
+// earlier tool rounds
+func (c *CompatibleAPI) streamTurn(ctx context.Context, query types.Request, rounds []map[string]interface{}, allowTools bool, onDelta func(delta string)) (types.Response, []ToolCall, error) {
+	req, err := c.newRequest(ctx, query, true, rounds, allowTools)
+	if err != nil {
+		return types.Response{}, nil, err
+	}
+
+	resp, err := c.http.DoQuery(ctx, req, requestTokens(query))
+	if err != nil {
+		return types.Response{}, nil, err
+	}
+	defer resp.Body.Close()
+
+	return readChatCompletionStream(c.config.Name, resp.Body, onDelta)
+}
+
+// ContextSize returns the context window of model in tokens, or 0 if the
+// provider's configuration does not know it
+func (c *CompatibleAPI) ContextSize(model string) int {
+	return contextSizeFor(c.config.ContextSizes, model)
+}
+
+func (c *CompatibleAPI) EstimateTokens(text string) int {
+	return estimateTokens(text)
+}
+
+func (c *CompatibleAPI) model(query types.Request) string {
+	if query.Model != "" {
+		return query.Model
+	}
+	return c.config.DefaultModel
+}
+
+// newRequest builds a chat completions request for the conversation followed
+// by any tool rounds. Tools are only offered to providers that support them
+// when the context can confirm them, and allowTools false forbids further
+// calls.
+func (c *CompatibleAPI) newRequest(ctx context.Context, query types.Request, stream bool, rounds []map[string]interface{}, allowTools bool) (*http.Request, error) {
+	if !c.config.Images && hasImages(query.Messages) {
+		return nil, noImagesError(c.config.Name)
+	}
+
+	body := map[string]interface{}{
+		"messages":   append(chatCompletionMessages(withSystemPrompt(query)), rounds...),
+		"max_tokens": maxTokens(query.Params),
+		"stream":     stream,
+	}
+	if stream && c.config.StreamUsage {
+		body["stream_options"] = map[string]bool{"include_usage": true}
+	}
+	if stream && c.config.Tools && toolsEnabled(ctx) {
+		body["tools"] = chatCompletionTools()
+		if !allowTools {
+			body["tool_choice"] = "none"
+		}
+	}
+	if model := c.model(query); model != "" {
+		body["model"] = model
+	}
+	if query.Params.Temperature != nil {
+		body["temperature"] = *query.Params.Temperature
+	}
+	if query.Params.TopP != nil {
+		body["top_p"] = *query.Params.TopP
+	}
+	if len(query.Params.Stop) > 0 {
+		body["stop"] = query.Params.Stop
+	}
+	if query.Params.JSON && c.config.JSONMode {
+		body["response_format"] = map[string]string{"type": "json_object"}
+	}
+
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request body: %w", err)
+	}
+
+	url := strings.TrimSuffix(c.config.BaseURL, "/") + "/chat/completions"
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(requestBody))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if err := c.setHeaders(req); err != nil {
+		return nil, err
+	}
+	if stream {
+		req.Header.Set("Accept", "text/event-stream")
+	}
+
+	return req, nil
+}
+
+// setHeaders adds the configured extra headers and the API key, if any
+func (c *CompatibleAPI) setHeaders(req *http.Request) error {
+	apiKey, err := c.key.get()
+	if err != nil {
+		return fmt.Errorf("error getting %s key: %w", c.config.Name, err)
+	}
+	if apiKey == "" && !c.config.KeyOptional {
+		return fmt.Errorf("%s key not set. Please run setup", c.config.Name)
+	}
+
+	for name, value := range c.config.Headers {
+		req.Header.Set(name, value)
+	}
+	if apiKey != "" {
+		value := apiKey
+		if c.config.AuthScheme != "" {
+			value = c.config.AuthScheme + " " + apiKey
+		}
+		req.Header.Set(c.config.AuthHeader, value)
+	}
+	return nil
+}
+
+// chatCompletionMessages maps a conversation onto the chat completions
+// messages array, which supports system, user and assistant roles natively.
+// Messages with images are sent as content parts.
+func chatCompletionMessages(messages []types.Message) []map[string]interface{} {
+	result := make([]map[string]interface{}, 0, len(messages))
+	for _, m := range messages {
+		images := messageImages(m)
+		if len(images) == 0 {
+			result = append(result, map[string]interface{}{"role": string(m.Role), "content": messageText(m)})
+			continue
+		}
+
+		parts := []map[string]interface{}{{"type": "text", "text": messageText(m)}}
+		for _, image := range images {
+			parts = append(parts, map[string]interface{}{
+				"type":      "image_url",
+				"image_url": map[string]string{"url": dataURL(image)},
+			})
+		}
+		result = append(result, map[string]interface{}{"role": string(m.Role), "content": parts})
+	}
+	return result
+}
+
+func hasImages(messages []types.Message) bool {
+	for _, m := range messages {
+		if len(messageImages(m)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// chatCompletionTools describes the registered tools as chat completions
+// functions
+func chatCompletionTools() []map[string]interface{} {
+	result := make([]map[string]interface{}, 0, len(Tools()))
+	for _, t := range Tools() {
+		result = append(result, map[string]interface{}{
+			"type": "function",
+			"function": map[string]interface{}{
+				"name":        t.Name,
+				"description": t.Description,
+				"parameters":  t.Parameters,
+			},
+		})
+	}
+	return result
+}
+
+// readChatCompletion decodes a non-streaming chat completions response
+func readChatCompletion(ctx context.Context, provider string, r io.Reader) (types.Response, error) {
+	var result struct {
+		Model   string `json:"model"`
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage *chatCompletionUsage `json:"usage"`
+	}
+	if err := json.NewDecoder(r).Decode(&result); err != nil {
+		return types.Response{}, requestError(ctx, provider, fmt.Errorf("error reading response: %w", err))
+	}
+
+	if len(result.Choices) == 0 {
+		return types.Response{}, fmt.Errorf("unexpected response format from %s", provider)
+	}
+
+	choice := result.Choices[0]
+	return types.Response{
+		Text:       choice.Message.Content,
+		Model:      result.Model,
+		Usage:      result.Usage.usage(),
+		StopReason: choice.FinishReason,
+		Truncated:  choice.FinishReason == finishLength,
+	}, nil
+}
+
+// finishLength is the finish_reason of an answer cut off by max_tokens
+const finishLength = "length"
+
+// chatCompletionUsage is the usage block of a chat completions response
+type chatCompletionUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+func (u *chatCompletionUsage) usage() types.Usage {
+	if u == nil {
+		return types.Usage{}
+	}
+	return types.Usage{InputTokens: u.PromptTokens, OutputTokens: u.CompletionTokens}
+}
+
+// readChatCompletionStream decodes an OpenAI-style chat completions stream,
+// calling onDelta for every content delta, and returns the accumulated text,
+// the finish reason and any tool calls. Usage is taken from whichever chunk reports it,
+// usually the last.
+func readChatCompletionStream(provider string, r io.Reader, onDelta func(delta string)) (types.Response, []ToolCall, error) {
+	var text strings.Builder
+	var usage types.Usage
+	var calls []ToolCall
+	var stopReason string
+	err := readSSE(r, func(event, data string) error {
+		if data == "[DONE]" {
+			return nil
+		}
+
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content   string `json:"content"`
+					ToolCalls []struct {
+						Index    int    `json:"index"`
+						ID       string `json:"id"`
+						Function struct {
+							Name      string `json:"name"`
+							Arguments string `json:"arguments"`
+						} `json:"function"`
+					} `json:"tool_calls"`
+				} `json:"delta"`
+				FinishReason string `json:"finish_reason"`
+			} `json:"choices"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+			Usage *chatCompletionUsage `json:"usage"`
+			// Groq reports usage under its own key
+			XGroq *struct {
+				Usage *chatCompletionUsage `json:"usage"`
+			} `json:"x_groq"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("error parsing stream chunk: %w", err)
+		}
+		if chunk.Error != nil {
+			return &types.APIError{Kind: types.ErrServer, Provider: provider, Message: chunk.Error.Message}
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage.usage()
+		} else if chunk.XGroq != nil && chunk.XGroq.Usage != nil {
+			usage = chunk.XGroq.Usage.usage()
+		}
+		if len(chunk.Choices) == 0 {
+			return nil
+		}
+		if reason := chunk.Choices[0].FinishReason; reason != "" {
+			stopReason = reason
+		}
+
+		// Tool calls arrive in pieces, keyed by their position in the message
+		for _, tc := range chunk.Choices[0].Delta.ToolCalls {
+			for len(calls) <= tc.Index {
+				calls = append(calls, ToolCall{})
+			}
+			call := &calls[tc.Index]
+			if tc.ID != "" {
+				call.ID = tc.ID
+			}
+			call.Name += tc.Function.Name
+			call.Arguments += tc.Function.Arguments
+		}
+
+		delta := chunk.Choices[0].Delta.Content
+		if delta == "" {
+			return nil
+		}
+		text.WriteString(delta)
+		onDelta(delta)
+		return nil
+	})
+
+	return types.Response{Text: text.String(), Usage: usage, StopReason: stopReason, Truncated: stopReason == finishLength}, calls, err
+}
@@ -0,0 +1,267 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Utility-Gods/gottem/pkg/types"
+)
+
+const (
+	// summaryMaxTokens caps the length of a conversation summary
+	summaryMaxTokens = 500
+	// messageOverhead approximates the tokens each message costs on top of
+	// its content, for roles and separators
+	messageOverhead = 4
+
+	summaryPrompt = "Summarize the conversation you are given so the summary can replace it as context for the rest " +
+		"of the chat. Keep names, facts, decisions, code and open questions. Reply with the summary only."
+	summaryHeader = "Summary of the earlier conversation:"
+)
+
+// preparedQuery is a request made ready for one API by prepareQuery
+type preparedQuery struct {
+	types.Request
+	summary *types.Summary // New summary written to make the request fit
+	usage   types.Usage    // Tokens spent writing it
+}
+
+// finish adds the new summary, and what it cost, to the response
+func (p preparedQuery) finish(response *types.Response) {
+	response.Summary = p.summary
+	response.Usage.InputTokens += p.usage.InputTokens
+	response.Usage.OutputTokens += p.usage.OutputTokens
+}
+
+// prepareQuery refuses requests that api cannot take, fits the request into
+// the context window of its model and checks it against the spending budgets
+func prepareQuery(ctx context.Context, api types.APIInfo, query types.Request) (preparedQuery, error) {
+	if err := checkCapabilities(api, query); err != nil {
+		return preparedQuery{Request: query}, err
+	}
+	prepared, err := fitContext(ctx, api, query)
+	if err != nil {
+		return prepared, err
+	}
+	return prepared, checkBudget(ctx, api, prepared.Request)
+}
+
+// fitContext applies the chat's context policy. With "truncate" the oldest
+// turns are dropped until the conversation and the max_tokens reply fit the
+// model's context window. With "summarize" they are replaced by a summary,
+// which is written by the same model and extended as the chat grows.
+// Handlers that do not implement types.ContextLimiter are left alone.
+func fitContext(ctx context.Context, api types.APIInfo, query types.Request) (preparedQuery, error) {
+	prepared := preparedQuery{Request: query}
+
+	limiter, ok := api.Handler.(types.ContextLimiter)
+	policy := query.Params.ContextPolicy
+	if policy == "" {
+		policy = ContextTruncate
+	}
+	if !ok || policy == ContextOff {
+		return prepared, nil
+	}
+
+	model := modelFor(api, query)
+	size := limiter.ContextSize(model)
+	if size <= 0 {
+		return prepared, nil
+	}
+	limit := size - maxTokens(query.Params)
+	if limit <= 0 {
+		return prepared, &types.APIError{
+			Kind:     types.ErrBadRequest,
+			Provider: api.Name,
+			Message:  fmt.Sprintf("max_tokens %d leaves no room in the %d token context of %s", maxTokens(query.Params), size, model),
+		}
+	}
+
+	var system, turns []types.Message
+	for _, m := range query.Messages {
+		if m.Role == types.RoleSystem {
+			system = append(system, m)
+		} else {
+			turns = append(turns, m)
+		}
+	}
+
+	fixed := limiter.EstimateTokens(query.Params.SystemPrompt)
+	for _, m := range system {
+		fixed += limiter.EstimateTokens(m.Content) + messageOverhead
+	}
+	tokens := func(summaryTokens int, rest []types.Message) int {
+		n := fixed + summaryTokens
+		for _, m := range rest {
+			n += messageTokens(limiter.EstimateTokens, m) + messageOverhead
+		}
+		return n
+	}
+
+	// A saved summary only applies while the chat is summarized and still
+	// has the messages it replaced
+	summary := query.Summary
+	if policy != ContextSummarize || summary.Messages > len(turns) {
+		summary = types.Summary{}
+	}
+	summaryTokens := 0
+	if summary.Text != "" {
+		summaryTokens = limiter.EstimateTokens(summaryHeader+summary.Text) + messageOverhead
+	}
+
+	if tokens(summaryTokens, turns[summary.Messages:]) <= limit {
+		prepared.Messages = withSummary(system, summary, turns[summary.Messages:])
+		return prepared, nil
+	}
+
+	// Drop the oldest turns, leaving room for a summary if one will be
+	// written, and start the rest on a user turn
+	reserve := 0
+	if policy == ContextSummarize {
+		reserve = limiter.EstimateTokens(summaryHeader) + summaryMaxTokens + messageOverhead
+		if tokens(reserve, turns[len(turns)-1:]) > limit {
+			// No room for a summary next to the last message
+			policy, reserve = ContextTruncate, 0
+		}
+	}
+	drop := summary.Messages
+	for drop < len(turns)-1 && tokens(reserve, turns[drop:]) > limit {
+		drop++
+	}
+	for drop < len(turns)-1 && turns[drop].Role != types.RoleUser {
+		drop++
+	}
+	if needed := tokens(reserve, turns[drop:]); needed > limit {
+		return prepared, &types.APIError{
+			Kind:     types.ErrBadRequest,
+			Provider: api.Name,
+			Message: fmt.Sprintf("the last message needs about %d tokens but %s has room for %d, shorten it or lower max_tokens",
+				needed, model, limit),
+		}
+	}
+
+	if policy == ContextSummarize {
+		text, usage, err := summarize(ctx, api.Handler, limiter, model, size, summary.Text, turns[summary.Messages:drop])
+		prepared.usage = usage
+		if err != nil {
+			return prepared, fmt.Errorf("failed to summarize conversation: %w", err)
+		}
+		summary = types.Summary{Text: text, Messages: drop}
+		prepared.summary = &summary
+	} else {
+		summary = types.Summary{}
+	}
+
+	prepared.Messages = withSummary(system, summary, turns[drop:])
+	return prepared, nil
+}
+
+// withSummary rebuilds a conversation from its system messages, the summary
+// of its oldest turns, if any, and the turns that are kept
+func withSummary(system []types.Message, summary types.Summary, turns []types.Message) []types.Message {
+	messages := make([]types.Message, 0, len(system)+len(turns)+1)
+	messages = append(messages, system...)
+	if summary.Text != "" {
+		messages = append(messages, types.Message{Role: types.RoleSystem, Content: summaryHeader + "\n" + summary.Text})
+	}
+	return append(messages, turns...)
+}
+
+// summarize folds messages into the previous summary using the chat's own
+// model. Long stretches are summarized in chunks that fit its context.
+func summarize(ctx context.Context, handler types.APIHandler, limiter types.ContextLimiter, model string, size int, previous string, messages []types.Message) (string, types.Usage, error) {
+	var usage types.Usage
+	summary := previous
+	ctx = WithToolConfirm(ctx, nil) // Summaries never call tools
+
+	for len(messages) > 0 {
+		var b strings.Builder
+		if summary != "" {
+			fmt.Fprintf(&b, "%s\n%s\n\n", summaryHeader, summary)
+		}
+
+		// Always take at least one message so the loop makes progress
+		budget := size - summaryMaxTokens - limiter.EstimateTokens(summaryPrompt+b.String())
+		n := 0
+		for n < len(messages) {
+			cost := limiter.EstimateTokens(messages[n].Content) + messageOverhead
+			if n > 0 && cost > budget {
+				break
+			}
+			budget -= cost
+			fmt.Fprintf(&b, "%s: %s\n\n", roleLabel(messages[n].Role), messages[n].Content)
+			n++
+		}
+		messages = messages[n:]
+
+		request := types.Request{
+			Messages: []types.Message{{Role: types.RoleUser, Content: b.String()}},
+			Model:    model,
+			Params:   types.Params{MaxTokens: summaryMaxTokens, SystemPrompt: summaryPrompt},
+		}
+
+		var response types.Response
+		var err error
+		if streamer, ok := handler.(types.StreamingAPIHandler); ok {
+			response, err = streamer.StreamQuery(ctx, request, func(string) {})
+		} else {
+			response, err = handler.HandleQuery(ctx, request)
+		}
+		usage.InputTokens += response.Usage.InputTokens
+		usage.OutputTokens += response.Usage.OutputTokens
+		if err != nil {
+			return "", usage, err
+		}
+		summary = strings.TrimSpace(response.Text)
+	}
+
+	return summary, usage, nil
+}
+
+func roleLabel(role types.Role) string {
+	if role == types.RoleAssistant {
+		return "Assistant"
+	}
+	return "Human"
+}
+
+// modelFor returns the model a request will be sent to
+func modelFor(api types.APIInfo, query types.Request) string {
+	if query.Model != "" {
+		return query.Model
+	}
+	if lister, ok := api.Handler.(types.ModelLister); ok {
+		return lister.DefaultModel()
+	}
+	return ""
+}
+
+// estimateTokens roughly counts the tokens in text. English averages about
+// four characters per token, while other scripts often take a token or more
+// per character.
+func estimateTokens(text string) int {
+	ascii, other := 0, 0
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + other
+}
+
+// contextSizeFor looks up the context size of model in a table keyed by
+// model name prefix, the longest match winning. An empty prefix matches
+// every model.
+func contextSizeFor(sizes map[string]int, model string) int {
+	best, size := -1, 0
+	for prefix, n := range sizes {
+		if strings.HasPrefix(model, prefix) && len(prefix) > best {
+			best, size = len(prefix), n
+		}
+	}
+	return size
+}
@@ -0,0 +1,200 @@
+package api
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Utility-Gods/gottem/pkg/types"
+)
+
+// contextHandler counts a token per character and answers every query,
+// which fitContext only sends to write summaries, with "summary"
+type contextHandler struct {
+	size    int
+	queries int
+}
+
+func (h *contextHandler) HandleQuery(ctx context.Context, req types.Request) (types.Response, error) {
+	h.queries++
+	return types.Response{Text: "summary", Usage: types.Usage{InputTokens: 10, OutputTokens: 2}}, nil
+}
+
+func (h *contextHandler) ContextSize(model string) int   { return h.size }
+func (h *contextHandler) EstimateTokens(text string) int { return len(text) }
+
+// alternatingTurns returns n user and assistant messages, starting with a
+// user message, each costing length tokens plus the message overhead
+func alternatingTurns(n, length int) []types.Message {
+	messages := make([]types.Message, n)
+	for i := range messages {
+		role := types.RoleUser
+		if i%2 == 1 {
+			role = types.RoleAssistant
+		}
+		content := string(rune('a'+i)) + strings.Repeat(".", length-1)
+		messages[i] = types.Message{Role: role, Content: content}
+	}
+	return messages
+}
+
+func TestFitContext(t *testing.T) {
+	// 16 characters cost 20 tokens with the overhead
+	history := alternatingTurns(5, 16)
+	system := types.Message{Role: types.RoleSystem, Content: strings.Repeat("s", 16)}
+
+	tests := []struct {
+		name    string
+		size    int
+		query   types.Request
+		want    []types.Message
+		wantErr bool
+	}{
+		{
+			name:  "fits",
+			size:  100,
+			query: types.Request{Messages: history[:3], Params: types.Params{MaxTokens: 20}},
+			want:  history[:3],
+		},
+		{
+			name:  "oldest turns are dropped, starting on a user turn",
+			size:  100,
+			query: types.Request{Messages: history, Params: types.Params{MaxTokens: 20}},
+			want:  history[2:],
+		},
+		{
+			name:  "system messages are kept",
+			size:  100,
+			query: types.Request{Messages: append([]types.Message{system}, history...), Params: types.Params{MaxTokens: 20}},
+			want:  append([]types.Message{system}, history[2:]...),
+		},
+		{
+			name:  "policy off",
+			size:  100,
+			query: types.Request{Messages: history, Params: types.Params{MaxTokens: 20, ContextPolicy: ContextOff}},
+			want:  history,
+		},
+		{
+			name:  "unknown context size",
+			size:  0,
+			query: types.Request{Messages: history, Params: types.Params{MaxTokens: 20}},
+			want:  history,
+		},
+		{
+			name:    "last message too long",
+			size:    100,
+			query:   types.Request{Messages: alternatingTurns(1, 90), Params: types.Params{MaxTokens: 20}},
+			wantErr: true,
+		},
+		{
+			name:    "max_tokens fills the context",
+			size:    100,
+			query:   types.Request{Messages: history[:1], Params: types.Params{MaxTokens: 100}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &contextHandler{size: tt.size}
+			api := types.APIInfo{Name: "Test API", Handler: handler}
+			prepared, err := fitContext(context.Background(), api, tt.query)
+			if tt.wantErr {
+				if types.ErrorKindOf(err) != types.ErrBadRequest {
+					t.Fatalf("fitContext error = %v, want a bad request", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("fitContext: %v", err)
+			}
+			if !reflect.DeepEqual(prepared.Messages, tt.want) {
+				t.Errorf("fitContext kept %+v, want %+v", prepared.Messages, tt.want)
+			}
+			if prepared.summary != nil || handler.queries != 0 {
+				t.Errorf("truncating wrote a summary")
+			}
+		})
+	}
+}
+
+func TestFitContextSummarize(t *testing.T) {
+	// 96 characters cost 100 tokens with the overhead, so ten turns do not
+	// fit in 980 tokens and the summary needs room for four of them
+	history := alternatingTurns(10, 96)
+	handler := &contextHandler{size: 1000}
+	api := types.APIInfo{Name: "Test API", Handler: handler}
+	query := types.Request{Messages: history, Params: types.Params{MaxTokens: 20, ContextPolicy: ContextSummarize}}
+
+	prepared, err := fitContext(context.Background(), api, query)
+	if err != nil {
+		t.Fatalf("fitContext: %v", err)
+	}
+	// Six turns do not fit next to the summary prompt in one query, so they
+	// are summarized in chunks
+	if handler.queries < 2 {
+		t.Errorf("wrote the summary in %d queries, want it in chunks", handler.queries)
+	}
+	if want := (types.Summary{Text: "summary", Messages: 6}); prepared.summary == nil || *prepared.summary != want {
+		t.Fatalf("summary = %+v, want %+v", prepared.summary, want)
+	}
+	want := append([]types.Message{{Role: types.RoleSystem, Content: summaryHeader + "\nsummary"}}, history[6:]...)
+	if !reflect.DeepEqual(prepared.Messages, want) {
+		t.Errorf("fitContext sent %+v, want %+v", prepared.Messages, want)
+	}
+
+	var response types.Response
+	prepared.finish(&response)
+	if response.Summary != prepared.summary || response.Usage.InputTokens != 10*handler.queries || response.Usage.OutputTokens != 2*handler.queries {
+		t.Errorf("finish left %+v", response)
+	}
+
+	// The saved summary is used again while the rest still fits
+	query.Messages = history[:8]
+	query.Summary = *prepared.summary
+	handler.queries = 0
+	prepared, err = fitContext(context.Background(), api, query)
+	if err != nil {
+		t.Fatalf("fitContext with a saved summary: %v", err)
+	}
+	if handler.queries != 0 || prepared.summary != nil {
+		t.Errorf("a saved summary that still fits was written again")
+	}
+	want = append([]types.Message{{Role: types.RoleSystem, Content: summaryHeader + "\nsummary"}}, history[6:8]...)
+	if !reflect.DeepEqual(prepared.Messages, want) {
+		t.Errorf("fitContext with a saved summary sent %+v, want %+v", prepared.Messages, want)
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"abcd", 1},
+		{"abcde", 2},
+		{"héllo", 2},
+		{"日本語", 3},
+	}
+	for _, tt := range tests {
+		if got := estimateTokens(tt.text); got != tt.want {
+			t.Errorf("estimateTokens(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestContextSizeFor(t *testing.T) {
+	sizes := map[string]int{"": 4096, "gpt-4": 8192, "gpt-4-turbo": 128000}
+	tests := map[string]int{
+		"gpt-4-turbo-preview": 128000,
+		"gpt-4-0613":          8192,
+		"other":               4096,
+	}
+	for model, want := range tests {
+		if got := contextSizeFor(sizes, model); got != want {
+			t.Errorf("contextSizeFor(%q) = %d, want %d", model, got, want)
+		}
+	}
+}
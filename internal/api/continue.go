@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+
+	"github.com/Utility-Gods/gottem/pkg/types"
+)
+
+// maxContinuations caps the continue parameter
+const maxContinuations = 10
+
+// continuePrompt asks the model to carry on with an answer that was cut off
+const continuePrompt = "Your answer was cut off. Continue exactly where it stopped, without repeating anything or adding an introduction."
+
+// ContinueNotice reports that an answer cut off by max_tokens is being
+// continued
+type ContinueNotice struct {
+	Provider string
+	Part     int // The continuation being requested, from 1
+	MaxParts int // The chat's continue parameter
+}
+
+type continueNotifyKey struct{}
+
+// WithContinueNotify returns a context that reports continuations to notify,
+// so callers can show that more of the answer is on its way
+func WithContinueNotify(ctx context.Context, notify func(ContinueNotice)) context.Context {
+	return context.WithValue(ctx, continueNotifyKey{}, notify)
+}
+
+func notifyContinue(ctx context.Context, notice ContinueNotice) {
+	if notify, ok := ctx.Value(continueNotifyKey{}).(func(ContinueNotice)); ok {
+		notify(notice)
+	}
+}
+
+// send sends query to handler. With onDelta set the answer is streamed if
+// the handler can, and otherwise delivered as a single delta.
+func send(ctx context.Context, handler types.APIHandler, query types.Request, onDelta func(delta string)) (types.Response, error) {
+	if onDelta == nil {
+		return handler.HandleQuery(ctx, query)
+	}
+	if streamer, ok := handler.(types.StreamingAPIHandler); ok {
+		return streamer.StreamQuery(ctx, query, onDelta)
+	}
+	response, err := handler.HandleQuery(ctx, query)
+	if err == nil {
+		onDelta(response.Text)
+	}
+	return response, err
+}
+
+// continueAnswer asks for the rest of an answer cut off by max_tokens, as
+// many times as the chat's continue parameter allows, and stitches the parts
+// together. Each request sends the answer so far followed by a request to
+// carry on. query is the prepared request that produced response.
+func continueAnswer(ctx context.Context, api types.APIInfo, query types.Request, response types.Response, onDelta func(delta string)) (types.Response, error) {
+	if _, ok := api.Handler.(*FallbackAPI); ok {
+		// Chains continue with the member that answered
+		return response, nil
+	}
+
+	for response.Truncated && response.Continuations < query.Params.Continue {
+		next := query
+		next.Messages = append(append([]types.Message(nil), query.Messages...),
+			types.Message{Role: types.RoleAssistant, Content: response.Text},
+			types.Message{Role: types.RoleUser, Content: continuePrompt},
+		)
+		// The conversation has been prepared once already, so it is only
+		// trimmed from here on rather than summarized again
+		next.Summary = types.Summary{}
+		next.Params.ContextPolicy = ContextTruncate
+
+		prepared, err := prepareQuery(ctx, api, next)
+		if err != nil {
+			return response, err
+		}
+
+		notifyContinue(ctx, ContinueNotice{Provider: api.Name, Part: response.Continuations + 1, MaxParts: query.Params.Continue})
+		part, err := send(ctx, api.Handler, prepared.Request, onDelta)
+		response.Text += part.Text
+		response.Usage.InputTokens += part.Usage.InputTokens
+		response.Usage.OutputTokens += part.Usage.OutputTokens
+		response.Tools += part.Tools
+		response.StopReason = part.StopReason
+		response.Truncated = part.Truncated
+		response.Continuations++
+		if err != nil {
+			return response, err
+		}
+	}
+
+	return response, nil
+}
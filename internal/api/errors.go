@@ -0,0 +1,75 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Utility-Gods/gottem/pkg/types"
+)
+
+// statusError builds an APIError from a non-200 HTTP response
+func statusError(provider string, resp *http.Response) error {
+	body, _ := io.ReadAll(resp.Body)
+	return &types.APIError{
+		Kind:       kindForStatus(resp.StatusCode),
+		Provider:   provider,
+		StatusCode: resp.StatusCode,
+		Message:    errorMessage(body),
+	}
+}
+
+// requestError wraps a failure to reach the API or to read its response.
+// Cancellation is passed through untouched so callers can tell it apart from
+// network problems, as are errors that are already classified.
+func requestError(ctx context.Context, provider string, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	var apiErr *types.APIError
+	if errors.As(err, &apiErr) {
+		return err
+	}
+	return &types.APIError{Kind: types.ErrNetwork, Provider: provider, Err: err}
+}
+
+func kindForStatus(code int) types.ErrorKind {
+	switch {
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return types.ErrAuth
+	case code == http.StatusTooManyRequests:
+		return types.ErrRateLimit
+	case code >= 500:
+		// Includes Anthropic's 529 "overloaded"
+		return types.ErrServer
+	case code >= 400:
+		return types.ErrBadRequest
+	default:
+		return types.ErrUnknown
+	}
+}
+
+// errorMessage extracts the human readable message from an error body. Both
+// Anthropic and OpenAI-style APIs nest it under error.message, while Ollama
+// sends error as a plain string.
+func errorMessage(body []byte) string {
+	var payload struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(body, &payload); err == nil && len(payload.Error) > 0 {
+		var nested struct {
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(payload.Error, &nested); err == nil && nested.Message != "" {
+			return nested.Message
+		}
+		var plain string
+		if err := json.Unmarshal(payload.Error, &plain); err == nil && plain != "" {
+			return plain
+		}
+	}
+	return strings.TrimSpace(string(body))
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Utility-Gods/gottem/internal/db"
+	"github.com/Utility-Gods/gottem/pkg/types"
+)
+
+// FallbackAPI is a virtual API that tries an ordered list of APIs in turn.
+// It moves on to the next API only when a request fails with an error worth
+// retrying elsewhere, such as an outage or a rate limit.
+type FallbackAPI struct {
+	Name    string
+	Members []types.APIInfo
+}
+
+func (f *FallbackAPI) HandleQuery(ctx context.Context, query types.Request) (types.Response, error) {
+	return f.run(ctx, query, nil)
+}
+
+// StreamQuery streams from the first API that starts answering. Once text
+// has been delivered the chain sticks with that API, since the partial
+// answer cannot be taken back.
+func (f *FallbackAPI) StreamQuery(ctx context.Context, query types.Request, onDelta func(delta string)) (types.Response, error) {
+	return f.run(ctx, query, onDelta)
+}
+
+// Capabilities combines the members' capabilities. Members that cannot take
+// a request are skipped, so the chain supports whatever any member does.
+// Members' context sizes differ, so the chain's is unknown.
+func (f *FallbackAPI) Capabilities() types.Capabilities {
+	var caps types.Capabilities
+	for _, member := range f.Members {
+		m := member.Capabilities
+		caps.Streaming = caps.Streaming || m.Streaming
+		caps.Vision = caps.Vision || m.Vision
+		caps.Tools = caps.Tools || m.Tools
+		caps.SystemPrompt = caps.SystemPrompt || m.SystemPrompt
+		caps.JSONMode = caps.JSONMode || m.JSONMode
+	}
+	return caps
+}
+
+func (f *FallbackAPI) run(ctx context.Context, query types.Request, onDelta func(delta string)) (types.Response, error) {
+	if len(f.Members) == 0 {
+		return types.Response{}, fmt.Errorf("%s has no available APIs", f.Name)
+	}
+
+	// Each member uses its own default model, since a model name chosen for
+	// one provider rarely exists on another
+	query.Model = ""
+
+	var lastErr error
+	for i, member := range f.Members {
+		prepared, err := prepareQuery(ctx, member, query)
+		if err != nil {
+			if ctx.Err() != nil {
+				return types.Response{}, ctx.Err()
+			}
+			debugf("%s: skipping %s: %v", f.Name, member.Name, err)
+			lastErr = err
+			continue
+		}
+
+		started := false
+		var tracked func(delta string)
+		if onDelta != nil {
+			tracked = func(delta string) {
+				started = true
+				onDelta(delta)
+			}
+		}
+
+		response, err := send(ctx, member.Handler, prepared.Request, tracked)
+		if err == nil {
+			response, err = continueAnswer(ctx, member, prepared.Request, response, tracked)
+		}
+
+		prepared.finish(&response)
+		if response.Provider == "" {
+			response.Provider = member.Name
+		}
+		if err == nil || started || ctx.Err() != nil || !isRetryable(err) {
+			return response, err
+		}
+
+		lastErr = err
+		if i < len(f.Members)-1 {
+			debugf("%s: %s failed, falling back to %s: %v", f.Name, member.Name, f.Members[i+1].Name, err)
+		}
+	}
+
+	return types.Response{}, fmt.Errorf("%s: all APIs failed: %w", f.Name, lastErr)
+}
+
+// registerFallbackChains adds the fallback chains configured in Settings.
+// Members that are unknown or not configured are left out of the chain.
+func registerFallbackChains(handlers map[string]types.APIInfo) {
+	chains, err := db.GetFallbackChains()
+	if err != nil {
+		debugf("Failed to load fallback chains: %v", err)
+		return
+	}
+
+	for _, chain := range chains {
+		if _, taken := handlers[chain.Shortcut]; taken {
+			debugf("Skipping fallback chain %s: shortcut %q is already in use", chain.Name, chain.Shortcut)
+			continue
+		}
+
+		fallback := &FallbackAPI{Name: chain.Name}
+		for _, shortcut := range chain.Members {
+			member, ok := handlers[shortcut]
+			if !ok {
+				debugf("Fallback chain %s: no API with shortcut %q", chain.Name, shortcut)
+				continue
+			}
+			if _, broken := member.Handler.(*ErrorAPI); broken {
+				continue
+			}
+			fallback.Members = append(fallback.Members, member)
+		}
+
+		name := chain.Name + " (Fallback)"
+		if len(fallback.Members) == 0 {
+			name = chain.Name + " (Not Configured)"
+		}
+		handlers[chain.Shortcut] = newAPIInfo(name, chain.Shortcut, fallback)
+	}
+}
@@ -1,6 +1,10 @@
 package api
 
 import (
+	"context"
+	"fmt"
+
+	"github.com/Utility-Gods/gottem/internal/db"
 	"github.com/Utility-Gods/gottem/pkg/types"
 )
 
@@ -10,36 +14,87 @@ func GetAPIHandlers() map[string]types.APIInfo {
 
 	claudeAPI, err := NewClaudeAPI()
 	if err != nil {
-		// log.Printf("Failed to initialize Claude API: %v", err)
-		handlers["c"] = types.APIInfo{Name: "Claude API (Not Configured)", Shortcut: "c", Handler: &ErrorAPI{Err: err}}
+		handlers["c"] = newAPIInfo("Claude API (Not Configured)", "c", &ErrorAPI{Name: "Claude API", Err: err})
 	} else {
-		handlers["c"] = types.APIInfo{Name: "Claude API", Shortcut: "c", Handler: claudeAPI}
+		handlers["c"] = newAPIInfo("Claude API", "c", claudeAPI)
 	}
 
-	openAIAPI, err := NewOpenAIAPI()
-	if err != nil {
-		// log.Printf("Failed to initialize OpenAI API: %v", err)
-		handlers["o"] = types.APIInfo{Name: "OpenAI API (Not Configured)", Shortcut: "o", Handler: &ErrorAPI{Err: err}}
-	} else {
-		handlers["o"] = types.APIInfo{Name: "OpenAI API", Shortcut: "o", Handler: openAIAPI}
+	for _, config := range compatibleConfigs() {
+		if _, taken := handlers[config.Shortcut]; taken {
+			debugf("Skipping %s: shortcut %q is already in use", config.Name, config.Shortcut)
+			continue
+		}
+		registerCompatible(handlers, config)
+	}
+
+	registerLocal(handlers)
+
+	// Chains refer to the APIs above, so they are registered last
+	registerFallbackChains(handlers)
+
+	return handlers
+}
+
+// registerLocal adds the local model servers that are currently running.
+// Unlike the hosted APIs they are left out entirely when unavailable.
+func registerLocal(handlers map[string]types.APIInfo) {
+	if _, taken := handlers["l"]; !taken {
+		ollamaAPI, err := NewOllamaAPI("")
+		if err != nil {
+			debugf("Ollama not available: %v", err)
+		} else {
+			handlers["l"] = newAPIInfo(fmt.Sprintf("Ollama (%s)", ollamaAPI.model), "l", ollamaAPI)
+		}
+	}
+
+	if _, taken := handlers[LlamaCppConfig.Shortcut]; !taken && probeLlamaCpp() {
+		registerCompatible(handlers, LlamaCppConfig)
 	}
+}
+
+// compatibleConfigs returns the built-in OpenAI-compatible providers followed
+// by the ones the user added in Settings
+func compatibleConfigs() []CompatibleConfig {
+	configs := []CompatibleConfig{OpenAIConfig, GroqConfig}
 
-	groqAPI, err := NewGroqAPI()
+	providers, err := db.GetCompatibleProviders()
 	if err != nil {
-		// log.Printf("Failed to initialize Groq API: %v", err)
-		handlers["g"] = types.APIInfo{Name: "Groq API (Not Configured)", Shortcut: "g", Handler: &ErrorAPI{Err: err}}
-	} else {
-		handlers["g"] = types.APIInfo{Name: "Groq API", Shortcut: "g", Handler: groqAPI}
+		debugf("Failed to load compatible providers: %v", err)
+		return configs
 	}
 
-	return handlers
+	for _, p := range providers {
+		configs = append(configs, CompatibleConfig{
+			Name:         p.Name,
+			Shortcut:     p.Shortcut,
+			KeyName:      p.Name,
+			BaseURL:      p.BaseURL,
+			AuthHeader:   p.AuthHeader,
+			AuthScheme:   p.AuthScheme,
+			DefaultModel: p.DefaultModel,
+			Headers:      p.Headers,
+			KeyOptional:  true,
+		})
+	}
+
+	return configs
+}
+
+func registerCompatible(handlers map[string]types.APIInfo, config CompatibleConfig) {
+	handler, err := NewCompatibleAPI(config)
+	if err != nil {
+		handlers[config.Shortcut] = newAPIInfo(config.Name+" (Not Configured)", config.Shortcut, &ErrorAPI{Name: config.Name, Err: err})
+		return
+	}
+	handlers[config.Shortcut] = newAPIInfo(config.Name, config.Shortcut, handler)
 }
 
-// ErrorAPI is a placeholder API that returns an error message
+// ErrorAPI is a placeholder API that returns a configuration error
 type ErrorAPI struct {
-	Err error
+	Name string
+	Err  error
 }
 
-func (e *ErrorAPI) HandleQuery(query string) string {
-	return "API not properly configured: " + e.Err.Error()
+func (e *ErrorAPI) HandleQuery(ctx context.Context, query types.Request) (types.Response, error) {
+	return types.Response{}, &types.APIError{Kind: types.ErrAuth, Provider: e.Name, Message: "not properly configured", Err: e.Err}
 }
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/Utility-Gods/gottem/internal/config"
+	"github.com/Utility-Gods/gottem/internal/db"
+)
+
+// Where an API key was found, see resolveAPIKey
+const (
+	SourceEnvironment = "environment"
+	SourceConfigFile  = "config file"
+	SourceDatabase    = "database"
+)
+
+// KeySource is an API key and where it came from
+type KeySource struct {
+	Name     string // Name the key is stored under, e.g. "openai"
+	Key      string
+	Source   string // One of the Source constants, empty if there is no key
+	Variable string // The environment variable, when Source is SourceEnvironment
+	Locked   bool   // The key is in the database, which is locked
+}
+
+// String describes where the key came from, e.g. "environment
+// (OPENAI_API_KEY)"
+func (k KeySource) String() string {
+	switch {
+	case k.Source == "":
+		return "not set"
+	case k.Variable != "":
+		return fmt.Sprintf("%s (%s)", k.Source, k.Variable)
+	case k.Locked:
+		return k.Source + " (locked)"
+	}
+	return k.Source
+}
+
+// resolveAPIKey finds the key for an API. In order of precedence it comes
+// from GOTTEM_<NAME>_API_KEY, the provider's own environment variable such
+// as OPENAI_API_KEY, the config file's [keys] table and finally the
+// database. The database is only read, and so only needs unlocking, when
+// none of the others has a key.
+func resolveAPIKey(name, providerVariable string) (KeySource, error) {
+	key := KeySource{Name: name}
+	if value, variable, ok := config.EnvKey(config.KeyVariables(name, providerVariable)); ok {
+		key.Key, key.Source, key.Variable = value, SourceEnvironment, variable
+		return key, nil
+	}
+	if value, ok := config.FileKey(name); ok {
+		key.Key, key.Source = value, SourceConfigFile
+		return key, nil
+	}
+
+	value, err := db.GetAPIKey(name)
+	if errors.Is(err, db.ErrLocked) {
+		key.Source, key.Locked = SourceDatabase, true
+	}
+	if err != nil {
+		return key, err
+	}
+	if value != "" {
+		key.Key, key.Source = value, SourceDatabase
+	}
+	return key, nil
+}
+
+// handlerKey is the API key of a handler. It is looked up for every
+// request instead of being kept, so a key stored in the database can only
+// be used while the keys are unlocked, and each use restarts their idle
+// timeout.
+type handlerKey struct {
+	name     string // Name the key is stored under, empty for no key
+	variable string // The provider's own environment variable, if any
+}
+
+// get returns the key, or db.ErrLocked if it is in the database and the
+// keys have locked since the handler was created
+func (k handlerKey) get() (string, error) {
+	if k.name == "" {
+		return "", nil
+	}
+	key, err := resolveAPIKey(k.name, k.variable)
+	if err != nil {
+		return "", err
+	}
+	return key.Key, nil
+}
+
+// LookupAPIKey resolves the key stored under name the way handlers do
+func LookupAPIKey(name string) (KeySource, error) {
+	return resolveAPIKey(name, keyVariable(name))
+}
+
+// APIKeySources resolves the key of every known API and of every key saved
+// anywhere, for Settings to show. Keys in a locked database are reported
+// without their value.
+func APIKeySources() ([]KeySource, error) {
+	names := map[string]bool{claudeKeyName: true}
+	for _, c := range compatibleConfigs() {
+		if c.KeyName != "" {
+			names[c.KeyName] = true
+		}
+	}
+	for _, name := range config.FileKeyNames() {
+		names[name] = true
+	}
+	stored, err := db.GetAPIKeyNames()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range stored {
+		names[name] = true
+	}
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	keys := make([]KeySource, 0, len(sorted))
+	for _, name := range sorted {
+		key, err := LookupAPIKey(name)
+		if err != nil && !key.Locked {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// keyVariable returns the provider's own environment variable for the key
+// stored under name, if it has one
+func keyVariable(name string) string {
+	if name == claudeKeyName {
+		return claudeKeyEnv
+	}
+	for _, c := range []CompatibleConfig{OpenAIConfig, GroqConfig} {
+		if c.KeyName == name {
+			return c.KeyEnv
+		}
+	}
+	return ""
+}
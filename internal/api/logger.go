@@ -0,0 +1,57 @@
+package api
+
+import (
+	"bytes"
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+// logger records what happens while a query runs. The standard logger
+// writes to stderr, which would draw over the editor, so until the editor
+// hands over its log file with SetLogger, messages are kept in memory and
+// written to the log file when it is set. That way what happened while the
+// handlers were set up, before any editor was open, is not lost.
+var logger atomic.Pointer[log.Logger]
+
+// maxStartupLog bounds the messages kept before a log file is set
+const maxStartupLog = 64 << 10
+
+// startupLog holds the messages logged before SetLogger was first called
+var startupLog struct {
+	sync.Mutex
+	buf bytes.Buffer
+}
+
+type startupWriter struct{}
+
+func (startupWriter) Write(p []byte) (int, error) {
+	startupLog.Lock()
+	defer startupLog.Unlock()
+	if startupLog.buf.Len()+len(p) <= maxStartupLog {
+		startupLog.buf.Write(p)
+	}
+	return len(p), nil
+}
+
+func init() {
+	logger.Store(log.New(startupWriter{}, "", log.Ldate|log.Ltime|log.Lmicroseconds))
+}
+
+// SetLogger sends the messages logged during queries to l, starting with
+// the ones logged before a logger was set
+func SetLogger(l *log.Logger) {
+	logger.Store(l)
+
+	startupLog.Lock()
+	defer startupLog.Unlock()
+	if startupLog.buf.Len() > 0 {
+		l.Writer().Write(startupLog.buf.Bytes())
+		startupLog.buf.Reset()
+	}
+}
+
+// debugf logs to the logger set with SetLogger
+func debugf(format string, args ...interface{}) {
+	logger.Load().Printf(format, args...)
+}
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Utility-Gods/gottem/internal/db"
+	"github.com/Utility-Gods/gottem/pkg/types"
+)
+
+// LoadTranscript returns a chat's stored messages as an editor transcript
+func (a *App) LoadTranscript(chatID int) (string, error) {
+	messages, err := db.GetMessages(chatID)
+	if err != nil {
+		return "", err
+	}
+	return FormatTranscript(messages), nil
+}
+
+// SaveTranscript stores an editor transcript as a chat's messages. A turn
+// still in the same place as a stored message from the same role keeps what
+// was recorded about it, such as the model and token counts, even if it has
+// been edited. When response is given it is recorded against the final
+// answer in the transcript, which it produced.
+func (a *App) SaveTranscript(chatID int, transcript string, response *types.Response) error {
+	stored, err := db.GetMessages(chatID)
+	if err != nil {
+		return err
+	}
+
+	messages := transcriptMessages(stored, splitTurns(transcript))
+	if response != nil {
+		for i := len(messages) - 1; i >= 0; i-- {
+			if messages[i].Role != types.RoleAssistant {
+				continue
+			}
+			messages[i].Provider = response.Provider
+			messages[i].Model = response.Model
+			messages[i].InputTokens = response.Usage.InputTokens
+			messages[i].OutputTokens = response.Usage.OutputTokens
+			messages[i].CreatedAt = time.Now()
+			break
+		}
+	}
+
+	return db.ReplaceMessages(chatID, messages)
+}
+
+// transcriptMessages pairs the turns of a transcript with the stored
+// messages, see matchTurns, keeping the ID of each paired message and what
+// was recorded about it
+func transcriptMessages(stored []db.Message, turns []turn) []db.Message {
+	pairs := matchTurns(stored, turns)
+	messages := make([]db.Message, len(turns))
+	for i, t := range turns {
+		m := db.Message{Role: t.role}
+		if pairs[i] >= 0 {
+			m = stored[pairs[i]]
+		}
+		if m.Provider == "" {
+			m.Provider = labelProvider(t.label)
+		}
+		m.Content = t.content
+		messages[i] = m
+	}
+	return messages
+}
+
+// matchTurns returns the index of the stored message each turn continues,
+// or -1 for new turns. Turns with the same role and content as a stored
+// message are paired first, keeping their order, so adding or removing a
+// turn does not move the others off their messages. The turns left between
+// two pairs are edits: they are paired in order with the messages left
+// between the same pairs, as long as the roles agree.
+func matchTurns(stored []db.Message, turns []turn) []int {
+	same := func(i, j int) bool {
+		return stored[i].Role == turns[j].role && stored[i].Content == turns[j].content
+	}
+
+	// Longest common subsequence of unchanged turns
+	lengths := make([][]int, len(stored)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(turns)+1)
+	}
+	for i := len(stored) - 1; i >= 0; i-- {
+		for j := len(turns) - 1; j >= 0; j-- {
+			if same(i, j) {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+
+	pairs := make([]int, len(turns))
+	for j := range pairs {
+		pairs[j] = -1
+	}
+	// pairEdits pairs the turns from j up to but not including endJ with the
+	// messages from i up to endI
+	pairEdits := func(i, endI, j, endJ int) {
+		for ; i < endI && j < endJ; i, j = i+1, j+1 {
+			if stored[i].Role == turns[j].role {
+				pairs[j] = i
+			}
+		}
+	}
+
+	gapI, gapJ := 0, 0
+	for i, j := 0, 0; i < len(stored) && j < len(turns); {
+		switch {
+		case same(i, j):
+			pairEdits(gapI, i, gapJ, j)
+			pairs[j] = i
+			i, j = i+1, j+1
+			gapI, gapJ = i, j
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	pairEdits(gapI, len(stored), gapJ, len(turns))
+	return pairs
+}
+
+// FormatTranscript writes messages out as an editor transcript, naming the
+// API that gave each answer in its header
+func FormatTranscript(messages []db.Message) string {
+	turns := make([]string, 0, len(messages))
+	for _, m := range messages {
+		var header string
+		switch m.Role {
+		case types.RoleSystem:
+			header = SystemPrefix
+		case types.RoleAssistant:
+			header = AssistantHeader(m.Provider)
+		default:
+			header = HumanPrefix
+		}
+		turns = append(turns, header+" "+m.Content)
+	}
+	return strings.Join(turns, "\n\n")
+}
+
+// TranscriptLine returns the line of FormatTranscript(messages) where the
+// message with the given ID starts, moved on to the first of its lines that
+// contains one of terms, ignoring case. It returns 0 if there is no such
+// message.
+func TranscriptLine(messages []db.Message, messageID int, terms []string) int {
+	line := 0
+	for _, m := range messages {
+		lines := strings.Split(m.Content, "\n")
+		if m.ID != messageID {
+			// Turns are separated by a blank line
+			line += len(lines) + 1
+			continue
+		}
+		for i, text := range lines {
+			text = strings.ToLower(text)
+			for _, term := range terms {
+				if term != "" && strings.Contains(text, strings.ToLower(term)) {
+					return line + i
+				}
+			}
+		}
+		return line
+	}
+	return 0
+}
+
+// labelProvider takes the API name out of an assistant header's label,
+// dropping the note that the answer was cached
+func labelProvider(label string) string {
+	label = strings.TrimSuffix(label, "cached")
+	return strings.TrimSuffix(label, ", ")
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Utility-Gods/gottem/internal/db"
+	"github.com/Utility-Gods/gottem/pkg/types"
+)
+
+func TestMatchTurns(t *testing.T) {
+	stored := []db.Message{
+		{Role: types.RoleUser, Content: "q1"},
+		{Role: types.RoleAssistant, Content: "a1"},
+		{Role: types.RoleUser, Content: "q2"},
+		{Role: types.RoleAssistant, Content: "a2"},
+	}
+
+	tests := []struct {
+		name       string
+		transcript string
+		want       []int
+	}{
+		{
+			name:       "unchanged",
+			transcript: "Human: q1\nAssistant: a1\nHuman: q2\nAssistant: a2",
+			want:       []int{0, 1, 2, 3},
+		},
+		{
+			name:       "appended",
+			transcript: "Human: q1\nAssistant: a1\nHuman: q2\nAssistant: a2\nHuman: q3",
+			want:       []int{0, 1, 2, 3, -1},
+		},
+		{
+			name:       "edited",
+			transcript: "Human: q1\nAssistant: a1\nHuman: q2, edited\nAssistant: a2",
+			want:       []int{0, 1, 2, 3},
+		},
+		{
+			name:       "inserted",
+			transcript: "Human: q1\nHuman: new\nAssistant: a1\nHuman: q2\nAssistant: a2",
+			want:       []int{0, -1, 1, 2, 3},
+		},
+		{
+			name:       "removed",
+			transcript: "Human: q1\nAssistant: a2",
+			want:       []int{0, 3},
+		},
+		{
+			name:       "edited turn changed role",
+			transcript: "Human: q1\nHuman: a1\nHuman: q2\nAssistant: a2",
+			want:       []int{0, -1, 2, 3},
+		},
+		{
+			name:       "empty",
+			transcript: "",
+			want:       []int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := matchTurns(stored, splitTurns(tt.transcript))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("matchTurns = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
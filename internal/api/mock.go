@@ -1,8 +1,11 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"strings"
+
+	"github.com/Utility-Gods/gottem/pkg/types"
 )
 
 // MockAPI is a sample implementation of APIHandler
@@ -10,6 +13,7 @@ type MockAPI struct {
 	Name string
 }
 
-func (m *MockAPI) HandleQuery(query string) string {
-	return fmt.Sprintf("Response from %s: %s", m.Name, strings.ToUpper(query))
+func (m *MockAPI) HandleQuery(ctx context.Context, query types.Request) (types.Response, error) {
+	last, _ := LastUserMessage(query.Messages)
+	return types.Response{Text: fmt.Sprintf("Response from %s: %s", m.Name, strings.ToUpper(last.Content))}, nil
 }
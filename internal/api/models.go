@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Utility-Gods/gottem/pkg/types"
+)
+
+// modelCacheTTL controls how long a discovered model list is reused before
+// the provider is asked again
+const modelCacheTTL = 10 * time.Minute
+
+type modelCacheEntry struct {
+	models    []string
+	fetchedAt time.Time
+}
+
+// modelCache remembers model lists per API shortcut so the model picker does
+// not hit the network every time it is opened
+type modelCache struct {
+	mu      sync.Mutex
+	entries map[string]modelCacheEntry
+}
+
+func newModelCache() *modelCache {
+	return &modelCache{entries: make(map[string]modelCacheEntry)}
+}
+
+func (c *modelCache) get(shortcut string) ([]string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[shortcut]
+	if !ok || time.Since(entry.fetchedAt) > modelCacheTTL {
+		return nil, false
+	}
+	return entry.models, true
+}
+
+func (c *modelCache) set(shortcut string, models []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[shortcut] = modelCacheEntry{models: models, fetchedAt: time.Now()}
+}
+
+// ListModels returns the models available for an API. Lists come from the
+// provider's models endpoint when it can be reached and from a built-in list
+// otherwise. Either way the result is cached.
+func (a *App) ListModels(ctx context.Context, apiShortcut string) ([]string, error) {
+	api, exists := a.APIs[apiShortcut]
+	if !exists {
+		return nil, fmt.Errorf("no API found for shortcut '%s'", apiShortcut)
+	}
+
+	if models, ok := a.models.get(apiShortcut); ok {
+		return models, nil
+	}
+
+	lister, ok := api.Handler.(types.ModelLister)
+	if !ok {
+		return nil, fmt.Errorf("%s does not support model selection", api.Name)
+	}
+
+	models, err := lister.ListModels(ctx)
+	if err != nil || len(models) == 0 {
+		fallback := fallbackModels(api.Handler)
+		if len(fallback) == 0 {
+			if err == nil {
+				err = fmt.Errorf("%s reported no models", api.Name)
+			}
+			return nil, err
+		}
+		debugf("Using built-in model list for %s: %v", api.Name, err)
+		models = fallback
+	}
+
+	a.models.set(apiShortcut, models)
+	return models, nil
+}
+
+// DefaultModel returns the model an API uses when a chat has not picked one
+func (a *App) DefaultModel(apiShortcut string) string {
+	api, exists := a.APIs[apiShortcut]
+	if !exists {
+		return ""
+	}
+	if lister, ok := api.Handler.(types.ModelLister); ok {
+		return lister.DefaultModel()
+	}
+	return ""
+}
+
+// fallbackModels returns the static model list shipped for a handler
+func fallbackModels(handler types.APIHandler) []string {
+	switch h := handler.(type) {
+	case *ClaudeAPI:
+		return claudeModels
+	case *CompatibleAPI:
+		return h.config.Models
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Utility-Gods/gottem/internal/db"
+)
+
+const (
+	// hostedTimeout bounds the wait for a hosted API to start answering.
+	// Streams may then run for as long as the model keeps generating.
+	hostedTimeout = 2 * time.Minute
+	// localTimeout is longer, since local servers may first load the model
+	localTimeout = 5 * time.Minute
+)
+
+// NetworkProviders returns the names that network settings and rate limits
+// can be saved under: the built-in providers, then the compatible providers added in
+// Settings
+func NetworkProviders() []string {
+	names := []string{claudeName, OpenAIConfig.Name, GroqConfig.Name, ollamaName, LlamaCppConfig.Name}
+
+	providers, err := db.GetCompatibleProviders()
+	if err != nil {
+		debugf("Failed to load compatible providers: %v", err)
+		return names
+	}
+	for _, p := range providers {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// SaveNetworkSettings checks that the proxy and CA bundle can be used and
+// stores the settings. They apply the next time the CLI starts.
+func SaveNetworkSettings(settings db.NetworkSettings) error {
+	if _, err := newTransport(settings, hostedTimeout); err != nil {
+		return err
+	}
+	if settings.BaseURL != "" {
+		if u, err := url.Parse(settings.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid base URL %q, expected something like https://host/v1", settings.BaseURL)
+		}
+	}
+	return db.SaveNetworkSettings(settings)
+}
+
+// loadNetworkSettings returns a provider's saved settings. A broken row is
+// logged and ignored so the provider still works with its defaults.
+func loadNetworkSettings(provider string) db.NetworkSettings {
+	settings, err := db.GetNetworkSettings(provider)
+	if err != nil {
+		debugf("Ignoring network settings for %s: %v", provider, err)
+		return db.NetworkSettings{Provider: provider}
+	}
+	return settings
+}
+
+// baseURLFor returns the saved base URL override, or fallback without a
+// trailing slash
+func baseURLFor(settings db.NetworkSettings, fallback string) string {
+	if settings.BaseURL != "" {
+		return strings.TrimSuffix(settings.BaseURL, "/")
+	}
+	return strings.TrimSuffix(fallback, "/")
+}
+
+// newTransport builds the transport for a provider's settings. timeout is
+// used when the settings do not set one.
+func newTransport(settings db.NetworkSettings, timeout time.Duration) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	transport.ResponseHeaderTimeout = timeout
+	if settings.Timeout > 0 {
+		transport.ResponseHeaderTimeout = settings.Timeout
+	}
+
+	if settings.Proxy != "" {
+		proxy, err := url.Parse(settings.Proxy)
+		if err != nil || proxy.Scheme == "" || proxy.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q, expected something like http://proxy:8080", settings.Proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	if settings.CAFile != "" {
+		pool, err := loadCertPool(settings.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	return transport, nil
+}
+
+// loadCertPool adds the certificates in a PEM file to the system roots
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading CA bundle: %w", err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in CA bundle %s", path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,363 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Utility-Gods/gottem/pkg/types"
+)
+
+const (
+	ollamaName         = "Ollama"
+	ollamaDefaultURL   = "http://localhost:11434"
+	llamaCppDefaultURL = "http://localhost:8080"
+	ollamaContextSize  = 2048 // Ollama's default num_ctx
+
+	// localProbeTimeout keeps startup fast when no local server is running
+	localProbeTimeout = 500 * time.Millisecond
+	// modelInfoTimeout bounds asking the server about a model before a send
+	modelInfoTimeout = 5 * time.Second
+)
+
+// OllamaAPI implements the APIHandler interface for a local Ollama server.
+// It needs no API key and uses the first installed model by default.
+type OllamaAPI struct {
+	baseURL string
+	model   string
+	http    *httpClient
+
+	visionMu sync.Mutex
+	vision   map[string]bool // Whether each model takes images, see SupportsVision
+}
+
+// NewOllamaAPI connects to the Ollama server at baseURL. When baseURL is
+// empty it uses the base URL from the network settings, $OLLAMA_HOST or the
+// default local address. It fails if the server does not respond or has no
+// models installed.
+func NewOllamaAPI(baseURL string) (*OllamaAPI, error) {
+	network := loadNetworkSettings(ollamaName)
+	if baseURL == "" {
+		baseURL = baseURLFor(network, ollamaBaseURL())
+	}
+
+	client, err := newHTTPClient(ollamaName, network, localTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	o := &OllamaAPI{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		http:    client,
+		vision:  make(map[string]bool),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), localProbeTimeout)
+	defer cancel()
+
+	models, err := o.listModels(ctx, o.http.withoutRetries())
+	if err != nil {
+		return nil, fmt.Errorf("Ollama not reachable at %s: %w", o.baseURL, err)
+	}
+	if len(models) == 0 {
+		return nil, fmt.Errorf("Ollama at %s has no models installed", o.baseURL)
+	}
+	o.model = models[0]
+
+	return o, nil
+}
+
+// ollamaBaseURL honours OLLAMA_HOST, which may omit the scheme
+func ollamaBaseURL() string {
+	host := os.Getenv("OLLAMA_HOST")
+	if host == "" {
+		return ollamaDefaultURL
+	}
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+	return host
+}
+
+// ListModels returns the names of the models installed on the server
+func (o *OllamaAPI) ListModels(ctx context.Context) ([]string, error) {
+	return o.listModels(ctx, o.http)
+}
+
+func (o *OllamaAPI) listModels(ctx context.Context, client *httpClient) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", o.baseURL+"/api/tags", nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	resp, err := client.Do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error parsing model list: %w", err)
+	}
+
+	models := make([]string, 0, len(result.Models))
+	for _, m := range result.Models {
+		models = append(models, m.Name)
+	}
+	return models, nil
+}
+
+// ContextSize returns Ollama's default context window. Models may support
+// more, but Ollama truncates prompts to this unless num_ctx is raised.
+func (o *OllamaAPI) ContextSize(model string) int {
+	return ollamaContextSize
+}
+
+func (o *OllamaAPI) EstimateTokens(text string) int {
+	return estimateTokens(text)
+}
+
+// Capabilities reports what Ollama supports. Vision depends on the model,
+// see SupportsVision.
+func (o *OllamaAPI) Capabilities() types.Capabilities {
+	return types.Capabilities{
+		Streaming:    true,
+		SystemPrompt: true,
+		JSONMode:     true,
+		ContextSize:  ollamaContextSize,
+	}
+}
+
+// Local reports that Ollama runs on the user's machine, so its requests are
+// free
+func (o *OllamaAPI) Local() bool {
+	return true
+}
+
+// KnownVision returns what SupportsVision last found out about model,
+// without asking the server
+func (o *OllamaAPI) KnownVision(model string) (vision, known bool) {
+	o.visionMu.Lock()
+	defer o.visionMu.Unlock()
+	vision, known = o.vision[model]
+	return vision, known
+}
+
+// SupportsVision asks the server whether model takes images. Ollama lists a
+// "vision" capability for such models, and older versions a "clip" model
+// family. The answer is remembered, except when the server cannot be asked.
+func (o *OllamaAPI) SupportsVision(model string) bool {
+	if vision, known := o.KnownVision(model); known {
+		return vision
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), modelInfoTimeout)
+	defer cancel()
+
+	body, err := json.Marshal(map[string]string{"model": model})
+	if err != nil {
+		return false
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", o.baseURL+"/api/show", bytes.NewBuffer(body))
+	if err != nil {
+		return false
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := o.http.withoutRetries().Do(ctx, req)
+	if err != nil {
+		debugf("Could not check whether %s takes images: %v", model, err)
+		return false
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Capabilities []string `json:"capabilities"`
+		Details      struct {
+			Families []string `json:"families"`
+		} `json:"details"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		debugf("Could not check whether %s takes images: %v", model, err)
+		return false
+	}
+
+	vision := false
+	for _, c := range append(result.Capabilities, result.Details.Families...) {
+		if c == "vision" || c == "clip" {
+			vision = true
+		}
+	}
+	o.visionMu.Lock()
+	o.vision[model] = vision
+	o.visionMu.Unlock()
+	return vision
+}
+
+// DefaultModel returns the model used when a chat has not picked one
+func (o *OllamaAPI) DefaultModel() string {
+	return o.model
+}
+
+func (o *OllamaAPI) HandleQuery(ctx context.Context, query types.Request) (types.Response, error) {
+	return o.StreamQuery(ctx, query, func(string) {})
+}
+
+// StreamQuery sends the conversation to /api/chat and calls onDelta for every
+// chunk of the newline-delimited JSON stream
+func (o *OllamaAPI) StreamQuery(ctx context.Context, query types.Request, onDelta func(delta string)) (types.Response, error) {
+	model := o.model
+	if query.Model != "" {
+		model = query.Model
+	}
+
+	options := map[string]interface{}{
+		"num_predict": maxTokens(query.Params),
+	}
+	if query.Params.Temperature != nil {
+		options["temperature"] = *query.Params.Temperature
+	}
+	if query.Params.TopP != nil {
+		options["top_p"] = *query.Params.TopP
+	}
+	if len(query.Params.Stop) > 0 {
+		options["stop"] = query.Params.Stop
+	}
+
+	body := map[string]interface{}{
+		"model":    model,
+		"messages": ollamaMessages(withSystemPrompt(query)),
+		"stream":   true,
+		"options":  options,
+	}
+	if query.Params.JSON {
+		body["format"] = "json"
+	}
+
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		return types.Response{}, fmt.Errorf("error creating request body: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", o.baseURL+"/api/chat", bytes.NewBuffer(requestBody))
+	if err != nil {
+		return types.Response{}, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := o.http.DoQuery(ctx, req, requestTokens(query))
+	if err != nil {
+		return types.Response{}, err
+	}
+	defer resp.Body.Close()
+
+	var text strings.Builder
+	var usage types.Usage
+	var stopReason string
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var chunk struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+			Done            bool   `json:"done"`
+			DoneReason      string `json:"done_reason"`
+			Error           string `json:"error"`
+			PromptEvalCount int    `json:"prompt_eval_count"`
+			EvalCount       int    `json:"eval_count"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &chunk); err != nil {
+			return types.Response{Text: text.String(), Model: model}, fmt.Errorf("error parsing stream chunk: %w", err)
+		}
+		if chunk.Error != "" {
+			return types.Response{Text: text.String(), Model: model}, &types.APIError{Kind: types.ErrServer, Provider: ollamaName, Message: chunk.Error}
+		}
+		if chunk.Message.Content != "" {
+			text.WriteString(chunk.Message.Content)
+			onDelta(chunk.Message.Content)
+		}
+		if chunk.Done {
+			// The final chunk carries the token counts
+			usage = types.Usage{InputTokens: chunk.PromptEvalCount, OutputTokens: chunk.EvalCount}
+			stopReason = chunk.DoneReason
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return types.Response{Text: text.String(), Model: model}, requestError(ctx, ollamaName, err)
+	}
+
+	// Ollama reports "length" like OpenAI when num_predict runs out
+	return types.Response{Text: text.String(), Model: model, Usage: usage, StopReason: stopReason, Truncated: stopReason == finishLength}, nil
+}
+
+// ollamaMessages maps a conversation onto /api/chat messages, which carry
+// images as a list of base64 strings
+func ollamaMessages(messages []types.Message) []map[string]interface{} {
+	result := make([]map[string]interface{}, 0, len(messages))
+	for _, m := range messages {
+		message := map[string]interface{}{"role": string(m.Role), "content": messageText(m)}
+		if images := messageImages(m); len(images) > 0 {
+			encoded := make([]string, 0, len(images))
+			for _, image := range images {
+				encoded = append(encoded, base64.StdEncoding.EncodeToString(image.Data))
+			}
+			message["images"] = encoded
+		}
+		result = append(result, message)
+	}
+	return result
+}
+
+// LlamaCppConfig describes a local llama.cpp server, which serves an
+// OpenAI-compatible API and needs no key
+var LlamaCppConfig = CompatibleConfig{
+	Name:         "llama.cpp (Local)",
+	Shortcut:     "L",
+	BaseURL:      llamaCppDefaultURL + "/v1",
+	KeyOptional:  true,
+	Local:        true,
+	ContextSizes: map[string]int{"": 4096}, // The server's default --ctx-size
+}
+
+// probeLlamaCpp reports whether a llama.cpp server answers on its health
+// endpoint. It uses the network settings saved for llama.cpp, so the probe
+// goes through the same base URL, proxy and TLS settings as queries do.
+func probeLlamaCpp() bool {
+	network := loadNetworkSettings(LlamaCppConfig.Name)
+	client, err := newHTTPClient(LlamaCppConfig.Name, network, localTimeout)
+	if err != nil {
+		debugf("llama.cpp not probed: %v", err)
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), localProbeTimeout)
+	defer cancel()
+
+	baseURL := strings.TrimSuffix(baseURLFor(network, LlamaCppConfig.BaseURL), "/v1")
+	req, err := http.NewRequestWithContext(ctx, "GET", baseURL+"/health", nil)
+	if err != nil {
+		return false
+	}
+
+	resp, err := client.withoutRetries().Do(ctx, req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return true
+}
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Utility-Gods/gottem/pkg/types"
+)
+
+// defaultMaxTokens is sent when a chat has not set max_tokens. Claude
+// requires a value, so every provider gets the same one for consistency.
+const defaultMaxTokens = 1000
+
+// ParamNames lists the parameters that can be changed with SetParam
+var ParamNames = []string{"max_tokens", "temperature", "top_p", "stop", "system", "context", "cache", "json", "continue"}
+
+// Context policies, see types.Params.ContextPolicy
+const (
+	ContextTruncate  = "truncate"
+	ContextSummarize = "summarize"
+	ContextOff       = "off"
+)
+
+// SetParam parses value and stores it in the named parameter
+func SetParam(params *types.Params, name, value string) error {
+	value = strings.TrimSpace(value)
+
+	switch name {
+	case "max_tokens":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return fmt.Errorf("max_tokens must be a positive integer")
+		}
+		params.MaxTokens = n
+	case "temperature":
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || f < 0 || f > 2 {
+			return fmt.Errorf("temperature must be a number between 0 and 2")
+		}
+		params.Temperature = &f
+	case "top_p":
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || f <= 0 || f > 1 {
+			return fmt.Errorf("top_p must be a number greater than 0 and at most 1")
+		}
+		params.TopP = &f
+	case "stop":
+		params.Stop = nil
+		for _, seq := range strings.Split(value, ",") {
+			if seq = strings.TrimSpace(seq); seq != "" {
+				params.Stop = append(params.Stop, seq)
+			}
+		}
+	case "system":
+		params.SystemPrompt = value
+	case "context":
+		switch value {
+		case ContextTruncate, ContextSummarize, ContextOff:
+			params.ContextPolicy = value
+		default:
+			return fmt.Errorf("context must be %s, %s or %s", ContextTruncate, ContextSummarize, ContextOff)
+		}
+	case "cache":
+		switch value {
+		case "on":
+			params.Cache = true
+		case "off":
+			params.Cache = false
+		default:
+			return fmt.Errorf("cache must be on or off")
+		}
+	case "json":
+		switch value {
+		case "on":
+			params.JSON = true
+		case "off":
+			params.JSON = false
+		default:
+			return fmt.Errorf("json must be on or off")
+		}
+	case "continue":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || n > maxContinuations {
+			return fmt.Errorf("continue must be a whole number from 0 to %d", maxContinuations)
+		}
+		params.Continue = n
+	default:
+		return fmt.Errorf("unknown parameter %q, expected one of %s", name, strings.Join(ParamNames, ", "))
+	}
+
+	return nil
+}
+
+// UnsetParam restores the provider default for the named parameter
+func UnsetParam(params *types.Params, name string) error {
+	switch name {
+	case "max_tokens":
+		params.MaxTokens = 0
+	case "temperature":
+		params.Temperature = nil
+	case "top_p":
+		params.TopP = nil
+	case "stop":
+		params.Stop = nil
+	case "system":
+		params.SystemPrompt = ""
+	case "context":
+		params.ContextPolicy = ""
+	case "cache":
+		params.Cache = false
+	case "json":
+		params.JSON = false
+	case "continue":
+		params.Continue = 0
+	default:
+		return fmt.Errorf("unknown parameter %q, expected one of %s", name, strings.Join(ParamNames, ", "))
+	}
+	return nil
+}
+
+// FormatParam returns the named parameter as text, or "default" when unset
+func FormatParam(params types.Params, name string) string {
+	switch name {
+	case "max_tokens":
+		if params.MaxTokens > 0 {
+			return strconv.Itoa(params.MaxTokens)
+		}
+		return fmt.Sprintf("default (%d)", defaultMaxTokens)
+	case "temperature":
+		if params.Temperature != nil {
+			return strconv.FormatFloat(*params.Temperature, 'g', -1, 64)
+		}
+	case "top_p":
+		if params.TopP != nil {
+			return strconv.FormatFloat(*params.TopP, 'g', -1, 64)
+		}
+	case "stop":
+		if len(params.Stop) > 0 {
+			return strings.Join(params.Stop, ",")
+		}
+	case "system":
+		if params.SystemPrompt != "" {
+			return params.SystemPrompt
+		}
+	case "context":
+		if params.ContextPolicy != "" {
+			return params.ContextPolicy
+		}
+		return fmt.Sprintf("default (%s)", ContextTruncate)
+	case "cache":
+		if params.Cache {
+			return "on"
+		}
+		return "default (off)"
+	case "json":
+		if params.JSON {
+			return "on"
+		}
+		return "default (off)"
+	case "continue":
+		if params.Continue > 0 {
+			return strconv.Itoa(params.Continue)
+		}
+		return "default (off)"
+	}
+	return "default"
+}
+
+// FormatParams summarises all parameters on a single line
+func FormatParams(params types.Params) string {
+	parts := make([]string, 0, len(ParamNames))
+	for _, name := range ParamNames {
+		parts = append(parts, name+"="+FormatParam(params, name))
+	}
+	return strings.Join(parts, " ")
+}
+
+func maxTokens(params types.Params) int {
+	if params.MaxTokens > 0 {
+		return params.MaxTokens
+	}
+	return defaultMaxTokens
+}
+
+// withSystemPrompt prepends the chat's system prompt to the conversation so
+// providers can map it like any other system message
+func withSystemPrompt(query types.Request) []types.Message {
+	if query.Params.SystemPrompt == "" {
+		return query.Messages
+	}
+	messages := make([]types.Message, 0, len(query.Messages)+1)
+	messages = append(messages, types.Message{Role: types.RoleSystem, Content: query.Params.SystemPrompt})
+	return append(messages, query.Messages...)
+}
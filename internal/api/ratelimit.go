@@ -0,0 +1,233 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/Utility-Gods/gottem/internal/db"
+	"github.com/Utility-Gods/gottem/pkg/types"
+)
+
+// RateLimitNotice reports that a request is waiting for a provider's
+// client-side rate limits
+type RateLimitNotice struct {
+	Provider string
+	Limit    string        // The limit being waited for, e.g. "requests per minute"
+	Delay    time.Duration // Zero when waiting for a request in flight to finish
+}
+
+type rateLimitNotifyKey struct{}
+
+// WithRateLimitNotify returns a context that reports waits for a rate limit
+// to notify, so callers can show why a request has not been sent yet
+func WithRateLimitNotify(ctx context.Context, notify func(RateLimitNotice)) context.Context {
+	return context.WithValue(ctx, rateLimitNotifyKey{}, notify)
+}
+
+func notifyRateLimit(ctx context.Context, notice RateLimitNotice) {
+	if notify, ok := ctx.Value(rateLimitNotifyKey{}).(func(RateLimitNotice)); ok {
+		notify(notice)
+	}
+}
+
+// SaveRateLimits stores a provider's rate limits. Unlike network settings
+// they apply at once.
+func SaveRateLimits(limits db.RateLimits) error {
+	if limits.RequestsPerMinute < 0 || limits.TokensPerMinute < 0 || limits.MaxConcurrent < 0 {
+		return fmt.Errorf("limits cannot be negative")
+	}
+	if err := db.SaveRateLimits(limits); err != nil {
+		return err
+	}
+	limiterFor(limits.Provider).setLimits(limits)
+	return nil
+}
+
+// ResetRateLimits removes a provider's rate limits
+func ResetRateLimits(provider string) error {
+	if err := db.DeleteRateLimits(provider); err != nil {
+		return err
+	}
+	limiterFor(provider).setLimits(db.RateLimits{Provider: provider})
+	return nil
+}
+
+var (
+	limitersMu sync.Mutex
+	limiters   = make(map[string]*rateLimiter)
+)
+
+// limiterFor returns the limiter shared by every client of a provider, so
+// queries, summaries and broadcasts all count against the same limits
+func limiterFor(provider string) *rateLimiter {
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+
+	if l, ok := limiters[provider]; ok {
+		return l
+	}
+
+	limits, err := db.GetRateLimits(provider)
+	if err != nil {
+		debugf("Ignoring rate limits for %s: %v", provider, err)
+		limits = db.RateLimits{Provider: provider}
+	}
+	l := &rateLimiter{}
+	l.setLimits(limits)
+	limiters[provider] = l
+	return l
+}
+
+// rateLimiter holds a provider's requests and tokens per minute as token
+// buckets, and caps the requests in flight
+type rateLimiter struct {
+	mu       sync.Mutex
+	provider string
+	requests bucket
+	tokens   bucket
+	slots    chan struct{} // One entry per request in flight, nil if unlimited
+}
+
+func (l *rateLimiter) setLimits(limits db.RateLimits) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.provider = limits.Provider
+	l.requests.reset(limits.RequestsPerMinute, now)
+	l.tokens.reset(limits.TokensPerMinute, now)
+
+	l.slots = nil
+	if limits.MaxConcurrent > 0 {
+		l.slots = make(chan struct{}, limits.MaxConcurrent)
+	}
+}
+
+// wait blocks until a request of the given number of tokens may be sent and
+// returns a function that marks it finished. Each caller takes its share of
+// the buckets as soon as it arrives and then waits for them to refill, so
+// requests go out in the order they were made.
+func (l *rateLimiter) wait(ctx context.Context, tokens int) (func(), error) {
+	l.mu.Lock()
+	now := time.Now()
+	delay, limit := l.requests.take(1, now), "requests per minute"
+	if d := l.tokens.take(float64(tokens), now); d > delay {
+		delay, limit = d, "tokens per minute"
+	}
+	slots, provider := l.slots, l.provider
+	l.mu.Unlock()
+
+	if delay > 0 {
+		debugf("%s: waiting %s for the %s limit", provider, delay.Round(time.Millisecond), limit)
+		notifyRateLimit(ctx, RateLimitNotice{Provider: provider, Limit: limit, Delay: delay})
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			l.giveBack(tokens)
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	if slots == nil {
+		return func() {}, nil
+	}
+
+	// Waiting senders on a channel are served in order, which keeps the
+	// queue for a free slot fair as well
+	select {
+	case slots <- struct{}{}:
+	default:
+		notifyRateLimit(ctx, RateLimitNotice{Provider: provider, Limit: fmt.Sprintf("%d concurrent requests", cap(slots))})
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			l.giveBack(tokens)
+			return nil, ctx.Err()
+		}
+	}
+	return sync.OnceFunc(func() { <-slots }), nil
+}
+
+// giveBack returns the shares of a request that was cancelled before it was
+// sent, so it does not count against the per-minute limits
+func (l *rateLimiter) giveBack(tokens int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.requests.give(1)
+	l.tokens.give(float64(tokens))
+}
+
+// bucket is a token bucket that refills its whole capacity once a minute.
+// Its level may go below zero while requests queue for it.
+type bucket struct {
+	perMinute float64 // Zero means unlimited
+	level     float64
+	updated   time.Time
+}
+
+func (b *bucket) reset(perMinute int, now time.Time) {
+	b.perMinute = float64(perMinute)
+	b.level = b.perMinute
+	b.updated = now
+}
+
+// take removes n from the bucket and returns how long until the bucket has
+// refilled enough to cover it
+func (b *bucket) take(n float64, now time.Time) time.Duration {
+	if b.perMinute <= 0 {
+		return 0
+	}
+
+	b.level = min(b.perMinute, b.level+now.Sub(b.updated).Minutes()*b.perMinute)
+	b.updated = now
+
+	b.level -= b.clamp(n)
+	if b.level >= 0 {
+		return 0
+	}
+	return time.Duration(-b.level / b.perMinute * float64(time.Minute))
+}
+
+// give returns n to the bucket when a queued request is cancelled
+func (b *bucket) give(n float64) {
+	if b.perMinute <= 0 {
+		return
+	}
+	b.level = min(b.perMinute, b.level+b.clamp(n))
+}
+
+// clamp caps n at the bucket's capacity, since a request larger than a
+// minute's allowance would otherwise never be sent
+func (b *bucket) clamp(n float64) float64 {
+	return min(n, b.perMinute)
+}
+
+// releaseBody frees a request's concurrency slot once its response body is
+// closed, which for streams is when the answer is complete
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (r *releaseBody) Close() error {
+	err := r.ReadCloser.Close()
+	r.release()
+	return err
+}
+
+// requestTokens estimates what a query counts against a tokens-per-minute
+// limit: its input plus the whole max_tokens allowance, which is how
+// providers count it too
+func requestTokens(query types.Request) int {
+	tokens := maxTokens(query.Params)
+	for _, m := range withSystemPrompt(query) {
+		tokens += messageTokens(estimateTokens, m)
+	}
+	return tokens
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Utility-Gods/gottem/internal/db"
+)
+
+func TestBucket(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	type step struct {
+		after time.Duration // Since start
+		take  float64
+		want  time.Duration
+	}
+	tests := []struct {
+		name      string
+		perMinute int
+		steps     []step
+	}{
+		{"unlimited", 0, []step{{0, 1000, 0}, {0, 1000, 0}}},
+		{"within the allowance", 60, []step{{0, 30, 0}, {0, 30, 0}}},
+		{"over the allowance waits for the refill", 60, []step{{0, 60, 0}, {0, 1, time.Second}, {0, 1, 2 * time.Second}}},
+		{"refills over time", 60, []step{{0, 60, 0}, {30 * time.Second, 30, 0}, {30 * time.Second, 1, time.Second}}},
+		{"refills no further than its capacity", 60, []step{{0, 1, 0}, {time.Hour, 60, 0}, {time.Hour, 1, time.Second}}},
+		{"oversized requests are capped at the capacity", 60, []step{{0, 600, 0}, {0, 600, time.Minute}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bucket
+			b.reset(tt.perMinute, start)
+			for i, s := range tt.steps {
+				if got := b.take(s.take, start.Add(s.after)); got != s.want {
+					t.Errorf("step %d: take(%v) = %v, want %v", i, s.take, got, s.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBucketGive(t *testing.T) {
+	start := time.Now()
+	var b bucket
+	b.reset(60, start)
+	b.take(60, start)
+	if d := b.take(30, start); d != 30*time.Second {
+		t.Fatalf("take = %v, want 30s", d)
+	}
+	b.give(30)
+	if d := b.take(1, start); d != time.Second {
+		t.Errorf("after giving back the queued share, take = %v, want 1s", d)
+	}
+	b.give(60)
+	b.give(60)
+	if b.level != 60 {
+		t.Errorf("giving back filled the bucket to %v, past its capacity of 60", b.level)
+	}
+}
+
+func TestRateLimiterCancelGivesBack(t *testing.T) {
+	l := &rateLimiter{}
+	l.setLimits(db.RateLimits{Provider: "Test API", RequestsPerMinute: 1, TokensPerMinute: 1000})
+
+	release, err := l.wait(context.Background(), 500)
+	if err != nil {
+		t.Fatalf("first wait: %v", err)
+	}
+	release()
+
+	// The second request has to wait a minute for the request limit, and
+	// gives its shares back when it is cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := l.wait(ctx, 500); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("cancelled wait = %v, want the deadline", err)
+	}
+	l.mu.Lock()
+	requests, tokens := l.requests.level, l.tokens.level
+	l.mu.Unlock()
+	if requests < -0.01 || requests > 0.01 || tokens < 500 {
+		t.Errorf("after cancelling, the buckets are at %v requests and %v tokens, want about 0 and 500", requests, tokens)
+	}
+}
+
+func TestRateLimiterConcurrency(t *testing.T) {
+	l := &rateLimiter{}
+	l.setLimits(db.RateLimits{Provider: "Test API", MaxConcurrent: 1, TokensPerMinute: 1000})
+
+	release, err := l.wait(context.Background(), 100)
+	if err != nil {
+		t.Fatalf("first wait: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := l.wait(ctx, 100); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wait for a busy slot = %v, want the deadline", err)
+	}
+	l.mu.Lock()
+	tokens := l.tokens.level
+	l.mu.Unlock()
+	if tokens < 900 {
+		t.Errorf("a request cancelled waiting for a slot kept its tokens, %v left", tokens)
+	}
+
+	// Releasing twice frees the slot only once
+	release()
+	release()
+	second, err := l.wait(context.Background(), 100)
+	if err != nil {
+		t.Fatalf("wait after release: %v", err)
+	}
+	defer second()
+	if len(l.slots) != 1 {
+		t.Errorf("%d slots in use, want 1", len(l.slots))
+	}
+}
@@ -0,0 +1,266 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Utility-Gods/gottem/internal/db"
+)
+
+const (
+	// maxToolRounds bounds how many times a model may call tools before it
+	// has to answer
+	maxToolRounds = 10
+	// maxToolOutput caps what a tool returns to the model, in bytes
+	maxToolOutput = 64 * 1024
+	// maxRecordedOutput caps the tool output copied into the transcript
+	maxRecordedOutput = 500
+	// commandTimeout bounds how long run_command may take
+	commandTimeout = 30 * time.Second
+
+	// Labels for tool calls and their results in the transcript
+	toolCallLabel   = "Tool call"
+	toolResultLabel = "Tool result:"
+)
+
+// Tool is a local function that models can call. Every call is confirmed by
+// the user before it runs.
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  map[string]interface{} // JSON schema of the input object
+	Run         func(ctx context.Context, input map[string]interface{}) (string, error)
+}
+
+// ToolCall is a model's request to run a tool
+type ToolCall struct {
+	ID        string
+	Name      string
+	Arguments string // JSON object
+}
+
+// toolResult is the outcome of a tool call, sent back to the model
+type toolResult struct {
+	call    ToolCall
+	content string
+	isError bool
+}
+
+var tools []Tool
+
+func init() {
+	RegisterTool(Tool{
+		Name:        "read_file",
+		Description: "Read a text file from the user's computer.",
+		Parameters:  objectSchema(map[string]string{"path": "Path of the file to read"}, "path"),
+		Run:         readFileTool,
+	})
+	RegisterTool(Tool{
+		Name:        "list_directory",
+		Description: "List the files in a directory on the user's computer. Directories end with a slash.",
+		Parameters:  objectSchema(map[string]string{"path": "Path of the directory, defaults to the current directory"}),
+		Run:         listDirectoryTool,
+	})
+	RegisterTool(Tool{
+		Name:        "run_command",
+		Description: "Run a shell command on the user's computer and return its combined output.",
+		Parameters:  objectSchema(map[string]string{"command": "Command line to run with sh -c"}, "command"),
+		Run:         runCommandTool,
+	})
+	RegisterTool(Tool{
+		Name:        "search_chats",
+		Description: "Search the user's previous chats for text and return matching excerpts.",
+		Parameters:  objectSchema(map[string]string{"query": "Text to search for"}, "query"),
+		Run:         searchChatsTool,
+	})
+}
+
+// RegisterTool makes a tool available to models. A tool with the same name
+// is replaced.
+func RegisterTool(tool Tool) {
+	for i, t := range tools {
+		if t.Name == tool.Name {
+			tools[i] = tool
+			return
+		}
+	}
+	tools = append(tools, tool)
+}
+
+// Tools returns the registered tools
+func Tools() []Tool {
+	return tools
+}
+
+func findTool(name string) (Tool, bool) {
+	for _, t := range tools {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return Tool{}, false
+}
+
+func objectSchema(properties map[string]string, required ...string) map[string]interface{} {
+	props := make(map[string]interface{}, len(properties))
+	for name, description := range properties {
+		props[name] = map[string]string{"type": "string", "description": description}
+	}
+	schema := map[string]interface{}{"type": "object", "properties": props}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+type toolConfirmKey struct{}
+
+// WithToolConfirm returns a context that lets models call tools. confirm is
+// asked before every call and the call only runs if it returns true. Without
+// it, or with a nil confirm, no tools are offered.
+func WithToolConfirm(ctx context.Context, confirm func(ToolCall) bool) context.Context {
+	return context.WithValue(ctx, toolConfirmKey{}, confirm)
+}
+
+// toolsEnabled reports whether the caller can confirm tool calls
+func toolsEnabled(ctx context.Context) bool {
+	confirm, _ := ctx.Value(toolConfirmKey{}).(func(ToolCall) bool)
+	return confirm != nil
+}
+
+// toolCallText records a tool call in the transcript
+func toolCallText(call ToolCall) string {
+	return fmt.Sprintf("\n\n%s (%s): %s\n", toolCallLabel, call.Name, call.Arguments)
+}
+
+// runToolCalls confirms and runs each call in turn. The calls and a short
+// form of their results are streamed through onDelta so they end up in the
+// transcript.
+func runToolCalls(ctx context.Context, calls []ToolCall, onDelta func(string)) []toolResult {
+	confirm, _ := ctx.Value(toolConfirmKey{}).(func(ToolCall) bool)
+
+	results := make([]toolResult, 0, len(calls))
+	for _, call := range calls {
+		onDelta(toolCallText(call))
+
+		result := toolResult{call: call}
+		tool, ok := findTool(call.Name)
+		switch {
+		case !ok:
+			result.content, result.isError = fmt.Sprintf("unknown tool %q", call.Name), true
+		case confirm == nil || !confirm(call):
+			result.content, result.isError = "The user declined to run this tool.", true
+		default:
+			var input map[string]interface{}
+			if err := json.Unmarshal([]byte(call.Arguments), &input); err != nil && call.Arguments != "" {
+				result.content, result.isError = fmt.Sprintf("invalid arguments: %v", err), true
+				break
+			}
+			output, err := tool.Run(ctx, input)
+			if err != nil {
+				result.content, result.isError = fmt.Sprintf("error: %v", err), true
+			} else {
+				result.content = output
+			}
+		}
+		result.content = truncateOutput(result.content, maxToolOutput)
+
+		onDelta(fmt.Sprintf("%s %s\n\n", toolResultLabel, strings.TrimSpace(truncateOutput(result.content, maxRecordedOutput))))
+		results = append(results, result)
+	}
+	return results
+}
+
+// truncateOutput shortens s to at most n bytes without splitting a character
+func truncateOutput(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	cut := n
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + fmt.Sprintf("... [%d more bytes]", len(s)-cut)
+}
+
+func stringInput(input map[string]interface{}, name string) string {
+	s, _ := input[name].(string)
+	return s
+}
+
+func readFileTool(ctx context.Context, input map[string]interface{}) (string, error) {
+	path := stringInput(input, "path")
+	if path == "" {
+		return "", fmt.Errorf("path is required")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func listDirectoryTool(ctx context.Context, input map[string]interface{}) (string, error) {
+	path := stringInput(input, "path")
+	if path == "" {
+		path = "."
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, entry := range entries {
+		b.WriteString(entry.Name())
+		if entry.IsDir() {
+			b.WriteString("/")
+		}
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
+
+func runCommandTool(ctx context.Context, input map[string]interface{}) (string, error) {
+	command := stringInput(input, "command")
+	if command == "" {
+		return "", fmt.Errorf("command is required")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, "sh", "-c", command).CombinedOutput()
+	if err != nil {
+		// The output usually explains the failure, so the model gets both
+		return fmt.Sprintf("%s\n[%v]", output, err), nil
+	}
+	return string(output), nil
+}
+
+func searchChatsTool(ctx context.Context, input map[string]interface{}) (string, error) {
+	query := stringInput(input, "query")
+	if query == "" {
+		return "", fmt.Errorf("query is required")
+	}
+
+	matches, err := db.SearchChats(query, 10)
+	if err != nil {
+		return "", err
+	}
+	if len(matches) == 0 {
+		return "No chats found.", nil
+	}
+
+	var b strings.Builder
+	for _, m := range matches {
+		fmt.Fprintf(&b, "Chat %d (%s): %s\n", m.ChatID, m.Title, m.Highlight("", ""))
+	}
+	return b.String(), nil
+}
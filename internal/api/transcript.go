@@ -0,0 +1,129 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Utility-Gods/gottem/pkg/types"
+)
+
+// Prefixes that mark the start of a turn in an editor transcript
+const (
+	SystemPrefix    = "System:"
+	HumanPrefix     = "Human:"
+	AssistantPrefix = "Assistant:"
+)
+
+// ParseTranscript splits an editor transcript into role-tagged messages. A
+// line starting with one of the turn prefixes begins a new message and every
+// following line belongs to it until the next prefix. Text before the first
+// prefix is treated as a user message so older chats still parse. Empty
+// messages are dropped and consecutive messages from the same role are merged.
+func ParseTranscript(transcript string) []types.Message {
+	turns := splitTurns(transcript)
+	messages := make([]types.Message, len(turns))
+	for i, t := range turns {
+		messages[i] = types.Message{Role: t.role, Content: t.content}
+	}
+	return mergeConsecutive(messages)
+}
+
+// turn is a message as written in a transcript, with the label its header
+// gave, e.g. "OpenAI API, cached"
+type turn struct {
+	role    types.Role
+	label   string
+	content string
+}
+
+func splitTurns(transcript string) []turn {
+	var turns []turn
+	var current *turn
+	var lines []string
+
+	flush := func() {
+		if current == nil {
+			return
+		}
+		current.content = strings.TrimSpace(strings.Join(lines, "\n"))
+		if current.content != "" {
+			turns = append(turns, *current)
+		}
+		current = nil
+		lines = nil
+	}
+
+	for _, line := range strings.Split(transcript, "\n") {
+		role, label, rest, ok := cutTurnPrefix(line)
+		if ok {
+			flush()
+			current = &turn{role: role, label: label}
+			lines = append(lines, rest)
+			continue
+		}
+		if current == nil {
+			current = &turn{role: types.RoleUser}
+		}
+		lines = append(lines, line)
+	}
+	flush()
+
+	return turns
+}
+
+// AssistantHeader returns the prefix for a response, naming the API that
+// produced it when one is given, e.g. "Assistant (OpenAI API):"
+func AssistantHeader(provider string) string {
+	if provider == "" {
+		return AssistantPrefix
+	}
+	return fmt.Sprintf("Assistant (%s):", provider)
+}
+
+func cutTurnPrefix(line string) (types.Role, string, string, bool) {
+	// Responses may name the API that answered, see AssistantHeader
+	if rest, ok := strings.CutPrefix(line, "Assistant ("); ok {
+		if i := strings.Index(rest, "):"); i >= 0 {
+			return types.RoleAssistant, rest[:i], strings.TrimPrefix(rest[i+2:], " "), true
+		}
+	}
+
+	prefixes := []struct {
+		prefix string
+		role   types.Role
+	}{
+		{SystemPrefix, types.RoleSystem},
+		{HumanPrefix, types.RoleUser},
+		{AssistantPrefix, types.RoleAssistant},
+	}
+
+	for _, p := range prefixes {
+		if rest, ok := strings.CutPrefix(line, p.prefix); ok {
+			return p.role, "", strings.TrimPrefix(rest, " "), true
+		}
+	}
+	return "", "", "", false
+}
+
+// mergeConsecutive joins adjacent messages that share a role, since most
+// providers expect user and assistant turns to alternate
+func mergeConsecutive(messages []types.Message) []types.Message {
+	merged := make([]types.Message, 0, len(messages))
+	for _, m := range messages {
+		if n := len(merged); n > 0 && merged[n-1].Role == m.Role {
+			merged[n-1].Content += "\n\n" + m.Content
+			merged[n-1].Attachments = append(merged[n-1].Attachments, m.Attachments...)
+			continue
+		}
+		merged = append(merged, m)
+	}
+	return merged
+}
+
+// LastUserMessage returns the final message if it was written by the user
+func LastUserMessage(messages []types.Message) (types.Message, bool) {
+	if len(messages) == 0 || messages[len(messages)-1].Role != types.RoleUser {
+		return types.Message{}, false
+	}
+	return messages[len(messages)-1], true
+}
@@ -0,0 +1,313 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Utility-Gods/gottem/internal/db"
+	"github.com/Utility-Gods/gottem/pkg/types"
+)
+
+// RetryPolicy controls how failed requests are retried
+type RetryPolicy struct {
+	MaxAttempts int           // Total attempts including the first one
+	BaseDelay   time.Duration // Backoff before the second attempt
+	MaxDelay    time.Duration // Upper bound for any single wait
+}
+
+// DefaultRetryPolicy is used when no retry settings have been saved
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   time.Second,
+	MaxDelay:    60 * time.Second,
+}
+
+// Keys the retry policy is stored under in the settings table
+const (
+	retryAttemptsSetting  = "retry.max_attempts"
+	retryBaseDelaySetting = "retry.base_delay"
+	retryMaxDelaySetting  = "retry.max_delay"
+)
+
+// LoadRetryPolicy reads the retry settings, falling back to the defaults for
+// any that are unset or invalid
+func LoadRetryPolicy() RetryPolicy {
+	policy := DefaultRetryPolicy
+
+	if value, err := db.GetSetting(retryAttemptsSetting); err == nil && value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			policy.MaxAttempts = n
+		}
+	}
+	if value, err := db.GetSetting(retryBaseDelaySetting); err == nil && value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			policy.BaseDelay = d
+		}
+	}
+	if value, err := db.GetSetting(retryMaxDelaySetting); err == nil && value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			policy.MaxDelay = d
+		}
+	}
+
+	return policy
+}
+
+// SaveRetryPolicy stores the retry settings
+func SaveRetryPolicy(policy RetryPolicy) error {
+	if policy.MaxAttempts < 1 {
+		return fmt.Errorf("max attempts must be at least 1")
+	}
+	if policy.BaseDelay <= 0 || policy.MaxDelay < policy.BaseDelay {
+		return fmt.Errorf("delays must be positive and the max delay at least the base delay")
+	}
+
+	if err := db.SetSetting(retryAttemptsSetting, strconv.Itoa(policy.MaxAttempts)); err != nil {
+		return err
+	}
+	if err := db.SetSetting(retryBaseDelaySetting, policy.BaseDelay.String()); err != nil {
+		return err
+	}
+	return db.SetSetting(retryMaxDelaySetting, policy.MaxDelay.String())
+}
+
+// RetryNotice describes a retry that is about to happen
+type RetryNotice struct {
+	Provider    string
+	Attempt     int // The attempt that will be made after the wait
+	MaxAttempts int
+	Delay       time.Duration
+	Err         error
+}
+
+type retryNotifyKey struct{}
+
+// WithRetryNotify returns a context that reports retries to notify, so
+// callers can tell the user why a request is taking longer
+func WithRetryNotify(ctx context.Context, notify func(RetryNotice)) context.Context {
+	return context.WithValue(ctx, retryNotifyKey{}, notify)
+}
+
+func notifyRetry(ctx context.Context, notice RetryNotice) {
+	if notify, ok := ctx.Value(retryNotifyKey{}).(func(RetryNotice)); ok {
+		notify(notice)
+	}
+}
+
+// httpClient is the HTTP layer shared by all providers. It retries transient
+// failures and turns unsuccessful responses into typed errors.
+type httpClient struct {
+	provider string
+	client   *http.Client
+	retry    RetryPolicy
+}
+
+// newHTTPClient builds the client for a provider from its network settings.
+// timeout is how long to wait for a response to start unless the settings
+// say otherwise. There is no limit on the whole request, so long streams are
+// not cut off.
+func newHTTPClient(provider string, settings db.NetworkSettings, timeout time.Duration) (*httpClient, error) {
+	transport, err := newTransport(settings, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("%s network settings: %w", provider, err)
+	}
+
+	return &httpClient{
+		provider: provider,
+		client:   &http.Client{Transport: transport},
+		retry:    LoadRetryPolicy(),
+	}, nil
+}
+
+// withoutRetries returns a copy of the client that makes a single attempt
+func (h *httpClient) withoutRetries() *httpClient {
+	c := *h
+	c.retry.MaxAttempts = 1
+	return &c
+}
+
+// Do sends req, retrying network errors, rate limits and server errors. The
+// returned response always has a 200 status; anything else becomes an error.
+func (h *httpClient) Do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	return h.do(ctx, req, nil, 0)
+}
+
+// DoQuery sends a model query like Do, but every attempt first waits until
+// the provider's rate limits allow it. tokens is the estimated size of the
+// query and its answer.
+func (h *httpClient) DoQuery(ctx context.Context, req *http.Request, tokens int) (*http.Response, error) {
+	return h.do(ctx, req, limiterFor(h.provider), tokens)
+}
+
+func (h *httpClient) do(ctx context.Context, req *http.Request, limiter *rateLimiter, tokens int) (*http.Response, error) {
+	attempts := h.retry.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := h.sendLimited(ctx, req, limiter, tokens)
+		if err == nil {
+			return resp, nil
+		}
+		if attempt >= attempts || !isRetryable(err) {
+			return nil, err
+		}
+
+		var header http.Header
+		if resp != nil {
+			header = resp.Header
+		}
+		delay := h.retryDelay(attempt, header, types.ErrorKindOf(err) == types.ErrRateLimit)
+
+		debugf("%s request failed (attempt %d/%d), retrying in %s: %v", h.provider, attempt, attempts, delay, err)
+		notifyRetry(ctx, RetryNotice{
+			Provider:    h.provider,
+			Attempt:     attempt + 1,
+			MaxAttempts: attempts,
+			Delay:       delay,
+			Err:         err,
+		})
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// sendLimited makes a single attempt once limiter allows it. The request
+// counts as in flight until its response body is closed.
+func (h *httpClient) sendLimited(ctx context.Context, req *http.Request, limiter *rateLimiter, tokens int) (*http.Response, error) {
+	if limiter == nil {
+		return h.send(ctx, req)
+	}
+
+	release, err := limiter.wait(ctx, tokens)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := h.send(ctx, req)
+	if err != nil {
+		release()
+		return resp, err
+	}
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// send makes a single attempt. On a failed status the response is returned
+// along with the error so its headers can be inspected; its body is closed.
+func (h *httpClient) send(ctx context.Context, req *http.Request) (*http.Response, error) {
+	attempt := req.Clone(ctx)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("error preparing request body: %w", err)
+		}
+		attempt.Body = body
+	}
+
+	resp, err := h.client.Do(attempt)
+	if err != nil {
+		return nil, requestError(ctx, h.provider, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		err := statusError(h.provider, resp)
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp, err
+	}
+
+	return resp, nil
+}
+
+func isRetryable(err error) bool {
+	switch types.ErrorKindOf(err) {
+	case types.ErrNetwork, types.ErrRateLimit, types.ErrServer:
+		return true
+	default:
+		return false
+	}
+}
+
+// retryDelay picks how long to wait before the next attempt. Server hints
+// win over exponential backoff, but every wait is capped at MaxDelay.
+func (h *httpClient) retryDelay(attempt int, header http.Header, rateLimited bool) time.Duration {
+	delay, ok := retryAfter(header, rateLimited, time.Now())
+	if !ok {
+		// Full jitter: a random wait between zero and the exponential bound
+		bound := h.retry.BaseDelay << (attempt - 1)
+		if bound <= 0 || bound > h.retry.MaxDelay {
+			bound = h.retry.MaxDelay
+		}
+		delay = time.Duration(rand.Int63n(int64(bound)) + 1)
+	}
+
+	if delay > h.retry.MaxDelay {
+		delay = h.retry.MaxDelay
+	}
+	return delay.Round(time.Millisecond)
+}
+
+// retryAfter reads the wait requested by the server. It understands the
+// standard Retry-After header and, for rate-limited responses, Anthropic's
+// anthropic-ratelimit-*-reset timestamps and OpenAI-style
+// x-ratelimit-reset-* durations. The reset headers are sent on every
+// response, so they only say when to retry once a limit has been hit.
+func retryAfter(header http.Header, rateLimited bool, now time.Time) (time.Duration, bool) {
+	if header == nil {
+		return 0, false
+	}
+
+	if value := header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second, true
+		}
+		if t, err := http.ParseTime(value); err == nil {
+			return positive(t.Sub(now)), true
+		}
+	}
+
+	if !rateLimited {
+		return 0, false
+	}
+
+	var wait time.Duration
+	found := false
+	for name, values := range header {
+		if len(values) == 0 {
+			continue
+		}
+		name = strings.ToLower(name)
+		switch {
+		case strings.HasPrefix(name, "anthropic-ratelimit-") && strings.HasSuffix(name, "-reset"):
+			if t, err := time.Parse(time.RFC3339, values[0]); err == nil {
+				wait, found = max(wait, positive(t.Sub(now))), true
+			}
+		case strings.HasPrefix(name, "x-ratelimit-reset"):
+			if d, err := time.ParseDuration(values[0]); err == nil {
+				wait, found = max(wait, d), true
+			}
+		}
+	}
+
+	return wait, found
+}
+
+func positive(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return d
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Utility-Gods/gottem/pkg/types"
+)
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		header      http.Header
+		rateLimited bool
+		want        time.Duration
+		found       bool
+	}{
+		{"no header", nil, true, 0, false},
+		{"seconds", http.Header{"Retry-After": {"7"}}, false, 7 * time.Second, true},
+		{"http date", http.Header{"Retry-After": {now.Add(30 * time.Second).Format(http.TimeFormat)}}, false, 30 * time.Second, true},
+		{"date in the past", http.Header{"Retry-After": {now.Add(-time.Minute).Format(http.TimeFormat)}}, false, 0, true},
+		{"invalid", http.Header{"Retry-After": {"soon"}}, false, 0, false},
+		{
+			name: "anthropic resets take the latest",
+			header: http.Header{
+				"Anthropic-Ratelimit-Requests-Reset": {now.Add(5 * time.Second).Format(time.RFC3339)},
+				"Anthropic-Ratelimit-Tokens-Reset":   {now.Add(20 * time.Second).Format(time.RFC3339)},
+			},
+			rateLimited: true,
+			want:        20 * time.Second,
+			found:       true,
+		},
+		{
+			name: "openai resets",
+			header: http.Header{
+				"X-Ratelimit-Reset-Requests": {"1s"},
+				"X-Ratelimit-Reset-Tokens":   {"6m0s"},
+			},
+			rateLimited: true,
+			want:        6 * time.Minute,
+			found:       true,
+		},
+		{
+			name:        "resets are ignored unless rate limited",
+			header:      http.Header{"X-Ratelimit-Reset-Tokens": {"10s"}},
+			rateLimited: false,
+			want:        0,
+			found:       false,
+		},
+		{
+			name: "retry-after wins over resets",
+			header: http.Header{
+				"Retry-After":              {"3"},
+				"X-Ratelimit-Reset-Tokens": {"10s"},
+			},
+			rateLimited: true,
+			want:        3 * time.Second,
+			found:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := retryAfter(tt.header, tt.rateLimited, now)
+			if got != tt.want || found != tt.found {
+				t.Errorf("retryAfter = %v, %v, want %v, %v", got, found, tt.want, tt.found)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	h := &httpClient{retry: RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second, MaxDelay: 10 * time.Second}}
+
+	for attempt := 1; attempt <= 8; attempt++ {
+		bound := time.Second << (attempt - 1)
+		if bound > h.retry.MaxDelay {
+			bound = h.retry.MaxDelay
+		}
+		for i := 0; i < 20; i++ {
+			if delay := h.retryDelay(attempt, nil, false); delay < 0 || delay > bound {
+				t.Fatalf("attempt %d waited %v, want at most %v", attempt, delay, bound)
+			}
+		}
+	}
+
+	if delay := h.retryDelay(1, http.Header{"Retry-After": {"4"}}, false); delay != 4*time.Second {
+		t.Errorf("with Retry-After: 4 waited %v", delay)
+	}
+	if delay := h.retryDelay(1, http.Header{"Retry-After": {"3600"}}, false); delay != h.retry.MaxDelay {
+		t.Errorf("a server hint over MaxDelay waited %v, want %v", delay, h.retry.MaxDelay)
+	}
+}
+
+func TestDoRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		wantErr  bool
+		kind     types.ErrorKind
+		calls    int
+	}{
+		{"rate limited then ok", []int{http.StatusTooManyRequests, http.StatusOK}, false, 0, 2},
+		{"server errors until out of attempts", []int{500, 502, 503}, true, types.ErrServer, 3},
+		{"client errors are not retried", []int{http.StatusBadRequest, http.StatusOK}, true, types.ErrBadRequest, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := tt.statuses[min(calls, len(tt.statuses)-1)]
+				calls++
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(status)
+				io.WriteString(w, `{}`)
+			}))
+			defer server.Close()
+
+			h := &httpClient{
+				provider: "Test API",
+				client:   server.Client(),
+				retry:    RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond},
+			}
+			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			if err != nil {
+				t.Fatalf("NewRequest: %v", err)
+			}
+			resp, err := h.Do(context.Background(), req)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err != nil) != tt.wantErr || (err != nil && types.ErrorKindOf(err) != tt.kind) {
+				t.Errorf("Do returned %v, want an error: %v, of kind %v", err, tt.wantErr, tt.kind)
+			}
+			if calls != tt.calls {
+				t.Errorf("server was called %d times, want %d", calls, tt.calls)
+			}
+		})
+	}
+}
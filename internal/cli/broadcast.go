@@ -0,0 +1,431 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Utility-Gods/gottem/internal/api"
+	"github.com/Utility-Gods/gottem/pkg/types"
+	"github.com/gdamore/tcell/v2"
+	"github.com/mattn/go-runewidth"
+)
+
+// comparisonColumn holds one API's answer in the comparison view
+type comparisonColumn struct {
+	api       types.APIInfo
+	provider  string
+	text      string
+	done      bool
+	err       error
+	latency   time.Duration
+	cached    bool
+	truncated bool           // Cut off by max_tokens
+	response  types.Response // Recorded with the answer if it is kept
+}
+
+// comparison is the state of the side-by-side view of a broadcast query
+type comparison struct {
+	columns  []comparisonColumn
+	selected int
+	scroll   int
+	pending  int
+}
+
+// broadcastDeltaEvent carries streamed text from one of the broadcast APIs
+type broadcastDeltaEvent struct {
+	tcell.EventTime
+	index int
+	delta string
+}
+
+// broadcastDoneEvent signals that one of the broadcast APIs has finished
+type broadcastDoneEvent struct {
+	tcell.EventTime
+	index  int
+	result api.BroadcastResult
+}
+
+func newBroadcastDeltaEvent(index int, delta string) *broadcastDeltaEvent {
+	ev := &broadcastDeltaEvent{index: index, delta: delta}
+	ev.SetEventNow()
+	return ev
+}
+
+func newBroadcastDoneEvent(index int, result api.BroadcastResult) *broadcastDoneEvent {
+	ev := &broadcastDoneEvent{index: index, result: result}
+	ev.SetEventNow()
+	return ev
+}
+
+// broadcastable reports whether an API is ticked by default for broadcasts.
+// Unconfigured APIs would only fail, and fallback chains duplicate their
+// members.
+func broadcastable(info types.APIInfo) bool {
+	switch info.Handler.(type) {
+	case *api.ErrorAPI, *api.FallbackAPI:
+		return false
+	}
+	return true
+}
+
+// selectBroadcast enters broadcast selection, where the APIs to send the
+// query to are ticked. The choice is kept for the rest of the session.
+func (e *Editor) selectBroadcast() {
+	if e.querying {
+		e.status = "A query is already in progress, please wait for it to finish"
+		return
+	}
+
+	if len(e.broadcastSelected) != len(e.apis) {
+		e.broadcastSelected = make([]bool, len(e.apis))
+		for i, info := range e.apis {
+			e.broadcastSelected[i] = broadcastable(info)
+		}
+	}
+	e.broadcastCursor = 0
+	e.mode = BroadcastSelectMode
+	e.status = e.broadcastSelectStatus()
+	e.logger.Println("Entered broadcast selection mode")
+}
+
+func (e *Editor) broadcastSelectStatus() string {
+	var items []string
+	for i, info := range e.apis {
+		mark := "[ ]"
+		if e.broadcastSelected[i] {
+			mark = "[x]"
+		}
+		item := mark + " " + info.Name
+		if i == e.broadcastCursor {
+			item = ">" + item + "<"
+		}
+		items = append(items, item)
+	}
+	return strings.Join(items, " ")
+}
+
+func (e *Editor) handleBroadcastSelectModeKey(ev *tcell.EventKey) bool {
+	switch ev.Key() {
+	case tcell.KeyLeft:
+		e.broadcastCursor = (e.broadcastCursor - 1 + len(e.apis)) % len(e.apis)
+		e.status = e.broadcastSelectStatus()
+	case tcell.KeyRight:
+		e.broadcastCursor = (e.broadcastCursor + 1) % len(e.apis)
+		e.status = e.broadcastSelectStatus()
+	case tcell.KeyEnter:
+		e.sendBroadcast()
+	case tcell.KeyEscape:
+		e.mode = NormalMode
+		e.status = "Broadcast cancelled"
+	case tcell.KeyRune:
+		if ev.Rune() == ' ' {
+			e.broadcastSelected[e.broadcastCursor] = !e.broadcastSelected[e.broadcastCursor]
+			e.status = e.broadcastSelectStatus()
+		}
+	}
+	e.draw()
+	return false
+}
+
+// sendBroadcast sends the conversation to every ticked API and opens the
+// comparison view
+func (e *Editor) sendBroadcast() {
+	messages := api.ParseTranscript(strings.Join(e.content, "\n"))
+	if _, ok := api.LastUserMessage(messages); !ok {
+		e.mode = NormalMode
+		e.status = fmt.Sprintf("Nothing to send. Type your message after \"%s\"", api.HumanPrefix)
+		return
+	}
+	messages, skipped, err := e.app.ResolveAttachments(e.chat.ID, strings.Join(e.content, "\n"))
+	if err != nil {
+		e.logger.Printf("Error attaching files: %v", err)
+		e.mode = NormalMode
+		e.status = fmt.Sprintf("Error attaching files: %v", err)
+		return
+	}
+
+	c := &comparison{}
+	var shortcuts []string
+	for i, info := range e.apis {
+		if e.broadcastSelected[i] {
+			c.columns = append(c.columns, comparisonColumn{api: info})
+			shortcuts = append(shortcuts, info.Shortcut)
+		}
+	}
+	if len(shortcuts) < 2 {
+		e.status = "Select at least two APIs with Space. " + e.broadcastSelectStatus()
+		return
+	}
+	c.pending = len(shortcuts)
+
+	e.logger.Printf("Broadcasting query to %s (%d messages)", strings.Join(shortcuts, ","), len(messages))
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx = api.WithRetryNotify(ctx, func(notice api.RetryNotice) {
+		e.postEvent(newQueryRetryEvent(notice))
+	})
+	ctx = api.WithRateLimitNotify(ctx, func(notice api.RateLimitNotice) {
+		e.postEvent(newQueryRateLimitEvent(notice))
+	})
+	ctx = api.WithBudgetWarning(ctx, func(warning api.BudgetWarning) {
+		e.postEvent(newQueryBudgetEvent(warning))
+	})
+	ctx = api.WithContinueNotify(ctx, func(notice api.ContinueNotice) {
+		e.postEvent(newQueryContinueEvent(notice))
+	})
+	e.cancelQuery = cancel
+	e.querying = true
+	e.budgetWarning = ""
+	e.attachmentNote = skippedAttachmentsNote(skipped)
+	e.comparison = c
+	e.mode = CompareMode
+	e.status = fmt.Sprintf("Waiting for %d APIs... (Esc to cancel)", len(shortcuts))
+	if e.attachmentNote != "" {
+		e.status += " | " + e.attachmentNote
+	}
+	e.draw()
+
+	query := types.Request{Messages: messages, Params: e.params, Summary: e.chat.Summary}
+	go func() {
+		defer cancel()
+		e.app.Broadcast(ctx, shortcuts, query, func(i int, delta string) {
+			e.postEvent(newBroadcastDeltaEvent(i, delta))
+		}, func(i int, result api.BroadcastResult) {
+			e.postEvent(newBroadcastDoneEvent(i, result))
+		})
+	}()
+}
+
+func (e *Editor) handleBroadcastDelta(ev *broadcastDeltaEvent) {
+	if e.comparison == nil {
+		return
+	}
+	e.comparison.columns[ev.index].text += ev.delta
+}
+
+func (e *Editor) handleBroadcastDone(ev *broadcastDoneEvent) {
+	c := e.comparison
+	if c == nil {
+		return
+	}
+
+	e.recordUsage(ev.result.Response, ev.result.Err)
+
+	column := &c.columns[ev.index]
+	column.done = true
+	column.response = ev.result.Response
+	column.err = ev.result.Err
+	column.latency = ev.result.Latency
+	column.provider = ev.result.Response.Provider
+	column.cached = ev.result.Response.Cached
+	column.truncated = ev.result.Response.Truncated
+	if column.err == nil && column.text == "" {
+		column.text = ev.result.Response.Text
+	}
+	if column.err != nil {
+		e.logger.Printf("Broadcast to %s failed: %v", column.api.Name, column.err)
+	} else {
+		e.logger.Printf("Broadcast to %s answered in %s", column.api.Name, column.latency)
+	}
+
+	c.pending--
+	if c.pending > 0 {
+		e.status = fmt.Sprintf("Waiting for %d APIs... (Esc to cancel)", c.pending)
+		return
+	}
+
+	e.querying = false
+	e.cancelQuery = nil
+	e.status = "All responses received. Enter: Keep selected, a: Keep all, Esc: Discard"
+	if e.budgetWarning != "" {
+		e.status += " | " + e.budgetWarning
+	}
+	if e.attachmentNote != "" {
+		e.status += " | " + e.attachmentNote
+	}
+}
+
+func (e *Editor) handleCompareModeKey(ev *tcell.EventKey) bool {
+	c := e.comparison
+
+	switch ev.Key() {
+	case tcell.KeyLeft:
+		c.selected = (c.selected - 1 + len(c.columns)) % len(c.columns)
+	case tcell.KeyRight:
+		c.selected = (c.selected + 1) % len(c.columns)
+	case tcell.KeyUp:
+		e.scrollComparison(-1)
+	case tcell.KeyDown:
+		e.scrollComparison(1)
+	case tcell.KeyEnter:
+		e.keepResponses(c.columns[c.selected : c.selected+1])
+	case tcell.KeyEscape:
+		e.closeComparison()
+		e.status = "Responses discarded"
+	case tcell.KeyRune:
+		switch ev.Rune() {
+		case 'h':
+			c.selected = (c.selected - 1 + len(c.columns)) % len(c.columns)
+		case 'l':
+			c.selected = (c.selected + 1) % len(c.columns)
+		case 'k':
+			e.scrollComparison(-1)
+		case 'j':
+			e.scrollComparison(1)
+		case 'a':
+			e.keepResponses(c.columns)
+		}
+	}
+	e.draw()
+	return false
+}
+
+func (e *Editor) scrollComparison(dy int) {
+	e.comparison.scroll += dy
+	if e.comparison.scroll < 0 {
+		e.comparison.scroll = 0
+	}
+}
+
+// keepResponses adds the given answers to the transcript, each labelled with
+// the API that gave it, saves them with the model and tokens that produced
+// them and closes the comparison view. A summary the APIs wrote to fit the
+// chat into their context is kept from the first kept answer that has one.
+func (e *Editor) keepResponses(columns []comparisonColumn) {
+	if e.querying {
+		e.status = "Wait for all responses, or press Esc to cancel the rest"
+		return
+	}
+
+	kept := 0
+	summarized := false
+	for _, column := range columns {
+		text := strings.TrimSpace(column.text)
+		if text == "" {
+			continue
+		}
+		provider := column.provider
+		if provider == "" {
+			provider = column.api.Name
+		}
+		if column.cached {
+			provider += ", cached"
+		}
+		e.content = append(e.content, "", api.AssistantHeader(provider)+" ")
+		e.appendDelta(text)
+		if !summarized && column.response.Summary != nil {
+			e.saveSummary(column.response.Summary)
+			summarized = true
+		}
+		response := column.response
+		if response.Provider == "" {
+			response.Provider = column.api.Name
+		}
+		e.saveResponse(response)
+		kept++
+	}
+	if kept == 0 {
+		e.status = "No response to keep"
+		return
+	}
+
+	e.appendPrompt()
+	e.closeComparison()
+	e.status = fmt.Sprintf("Kept %d response(s)", kept)
+}
+
+func (e *Editor) closeComparison() {
+	e.comparison = nil
+	e.mode = NormalMode
+}
+
+// drawComparison shows the broadcast answers side by side, one column per
+// API, in place of the editor content
+func (e *Editor) drawComparison(width, height int) {
+	c := e.comparison
+	columnWidth := width / len(c.columns)
+	if columnWidth < 2 {
+		return
+	}
+	textWidth := columnWidth - 1 // Leave space for the separator
+
+	for i, column := range c.columns {
+		x := i * columnWidth
+
+		headerStyle := tcell.StyleDefault.Bold(true)
+		if i == c.selected {
+			headerStyle = tcell.StyleDefault.Background(e.getModeColor()).Foreground(tcell.ColorBlack)
+		}
+		e.drawCell(x, 0, textWidth, column.api.Name, headerStyle)
+		e.drawCell(x, 1, textWidth, comparisonStatus(column), tcell.StyleDefault.Dim(true))
+
+		lines := wrapText(column.text, textWidth)
+		for y := 2; y < height; y++ {
+			line := ""
+			if n := y - 2 + c.scroll; n < len(lines) {
+				line = lines[n]
+			}
+			e.drawCell(x, y, textWidth, line, tcell.StyleDefault)
+		}
+
+		for y := 0; y < height; y++ {
+			e.screen.SetContent(x+textWidth, y, '│', nil, tcell.StyleDefault.Foreground(BorderColor))
+		}
+	}
+	e.screen.HideCursor()
+}
+
+// comparisonStatus describes the progress of one broadcast answer
+func comparisonStatus(column comparisonColumn) string {
+	switch {
+	case !column.done && column.text == "":
+		return "waiting..."
+	case !column.done:
+		return "receiving..."
+	case column.err != nil:
+		return fmt.Sprintf("%.2fs | %s", column.latency.Seconds(), queryErrorStatus(column.err))
+	case column.cached:
+		return "cached"
+	case column.truncated:
+		return fmt.Sprintf("%.2fs | cut off", column.latency.Seconds())
+	default:
+		return fmt.Sprintf("%.2fs", column.latency.Seconds())
+	}
+}
+
+// drawCell draws text clipped to width, padding the rest with spaces
+func (e *Editor) drawCell(x, y, width int, text string, style tcell.Style) {
+	used := 0
+	for _, ch := range text {
+		w := runewidth.RuneWidth(ch)
+		if used+w > width {
+			break
+		}
+		e.screen.SetContent(x+used, y, ch, nil, style)
+		used += w
+	}
+	for ; used < width; used++ {
+		e.screen.SetContent(x+used, y, ' ', nil, style)
+	}
+}
+
+// wrapText splits text into lines no wider than width
+func wrapText(text string, width int) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := ""
+		lineWidth := 0
+		for _, ch := range paragraph {
+			w := runewidth.RuneWidth(ch)
+			if lineWidth+w > width {
+				lines = append(lines, line)
+				line, lineWidth = "", 0
+			}
+			line += string(ch)
+			lineWidth += w
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -19,6 +19,8 @@ func RunCLI(app *api.App) {
 			startNewChat(app)
 		case "Continue a previous chat":
 			continuePreviousChat(app)
+		case "Search chats":
+			searchChats(app)
 		case "Exit":
 			fmt.Println("Goodbye!")
 			return
@@ -29,7 +31,7 @@ func RunCLI(app *api.App) {
 func displayMainMenu() string {
 	prompt := promptui.Select{
 		Label: "Select an option",
-		Items: []string{"Start a new chat", "Continue a previous chat", "Exit"},
+		Items: []string{"Start a new chat", "Continue a previous chat", "Search chats", "Exit"},
 	}
 
 	_, result, err := prompt.Run()
@@ -116,8 +118,14 @@ func viewChatHistory() {
 		return
 	}
 
+	messages, err := db.GetMessages(selectedChat.ID)
+	if err != nil {
+		fmt.Printf("Error retrieving messages: %v\n", err)
+		return
+	}
+
 	fmt.Printf("\n--- Chat History for '%s' ---\n", selectedChat.Title)
-	fmt.Println(selectedChat.Context)
+	fmt.Println(api.FormatTranscript(messages))
 	fmt.Println("--- End of Chat History ---")
 
 	prompt := promptui.Prompt{
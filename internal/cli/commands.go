@@ -0,0 +1,154 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Utility-Gods/gottem/internal/api"
+	"github.com/Utility-Gods/gottem/internal/db"
+	"github.com/gdamore/tcell/v2"
+)
+
+func (e *Editor) enterCommandMode() {
+	e.mode = CommandMode
+	e.command = ""
+	e.logger.Println("Entered Command Mode")
+}
+
+func (e *Editor) handleCommandModeKey(ev *tcell.EventKey) bool {
+	switch ev.Key() {
+	case tcell.KeyEscape:
+		e.mode = NormalMode
+		e.status = "Command cancelled"
+	case tcell.KeyEnter:
+		e.mode = NormalMode
+		e.executeCommand(e.command)
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if e.command == "" {
+			e.mode = NormalMode
+		} else {
+			runes := []rune(e.command)
+			e.command = string(runes[:len(runes)-1])
+		}
+	case tcell.KeyRune:
+		e.command += string(ev.Rune())
+	}
+	e.draw()
+	return false
+}
+
+// executeCommand runs a command typed after ':' and reports the outcome in
+// the status bar
+func (e *Editor) executeCommand(line string) {
+	e.logger.Printf("Executing command: %s", line)
+
+	name, args, _ := strings.Cut(strings.TrimSpace(line), " ")
+	args = strings.TrimSpace(args)
+
+	var err error
+	switch name {
+	case "":
+		return
+	case "set":
+		err = e.setParamCommand(args)
+	case "unset":
+		err = e.unsetParamCommand(args)
+	case "attach":
+		err = e.attachCommand(args)
+	default:
+		err = fmt.Errorf("unknown command %q", name)
+	}
+
+	if err != nil {
+		e.logger.Printf("Command failed: %v", err)
+		e.status = fmt.Sprintf("Error: %v", err)
+	}
+}
+
+// setParamCommand handles "set", which shows all parameters, and
+// "set name=value" or "set name value", which changes one
+func (e *Editor) setParamCommand(args string) error {
+	if args == "" {
+		e.status = api.FormatParams(e.params)
+		return nil
+	}
+
+	name, value, ok := strings.Cut(args, "=")
+	if !ok {
+		name, value, ok = strings.Cut(args, " ")
+	}
+	name = strings.TrimSpace(name)
+	if !ok {
+		e.status = fmt.Sprintf("%s=%s", name, api.FormatParam(e.params, name))
+		return nil
+	}
+
+	params := e.params
+	if err := api.SetParam(&params, name, value); err != nil {
+		return err
+	}
+	if err := db.SetChatParams(e.chat.ID, params); err != nil {
+		return err
+	}
+
+	e.params = params
+	e.status = fmt.Sprintf("%s set to %s", name, api.FormatParam(e.params, name))
+	if info := e.apis[e.selectedAPI]; name == "json" && params.JSON && !info.Capabilities.JSONMode {
+		e.status += fmt.Sprintf(". %s has no JSON mode, so queries to it will be refused", info.Name)
+	}
+	return nil
+}
+
+func (e *Editor) unsetParamCommand(args string) error {
+	params := e.params
+	if err := api.UnsetParam(&params, args); err != nil {
+		return err
+	}
+	if err := db.SetChatParams(e.chat.ID, params); err != nil {
+		return err
+	}
+
+	e.params = params
+	e.status = fmt.Sprintf("%s reset to default", args)
+	return nil
+}
+
+// attachCommand handles "attach path", which checks the file, references it
+// at the end of the message being written and stores the copy that message
+// sends
+func (e *Editor) attachCommand(args string) error {
+	if args == "" {
+		return fmt.Errorf("usage: attach path")
+	}
+
+	attachment, err := api.LoadAttachment(args)
+	if err != nil {
+		return err
+	}
+	// While it is not known yet whether the model takes images, the image is
+	// attached and checked again before the message is sent
+	if info := e.apis[e.selectedAPI]; attachment.IsImage() {
+		if vision, known := api.ImageSupport(info, e.model); known && !vision {
+			return fmt.Errorf("%s does not accept images, pick another API with Ctrl+J first", info.Name)
+		}
+	}
+	messages := api.ParseTranscript(strings.Join(e.content, "\n"))
+	if _, ok := api.LastUserMessage(messages); !ok && !strings.HasPrefix(e.content[len(e.content)-1], api.HumanPrefix) {
+		e.appendPrompt()
+	}
+	last := len(e.content) - 1
+	if line := e.content[last]; line != "" && !strings.HasSuffix(line, " ") {
+		e.content[last] += " "
+	}
+	e.content[last] += api.AttachmentToken(attachment.Name) + " "
+	if err := e.app.AttachFile(e.chat.ID, strings.Join(e.content, "\n"), attachment); err != nil {
+		return err
+	}
+	e.cursor.y = last
+	e.cursor.x = len(e.content[last])
+	e.isDirty = true
+	e.adjustScroll()
+
+	e.status = fmt.Sprintf("Attached %s (%s, %d KB)", attachment.Name, attachment.MIMEType, (len(attachment.Data)+1023)>>10)
+	return nil
+}
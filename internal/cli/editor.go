@@ -1,8 +1,11 @@
 package cli
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"os"
 	"path/filepath"
 	"sort"
@@ -23,6 +26,11 @@ const (
 	VisualMode
 	InsertMode
 	APISelectMode
+	ModelSelectMode
+	CommandMode
+	BroadcastSelectMode
+	CompareMode
+	ToolConfirmMode
 	QuitMode
 )
 
@@ -56,6 +64,103 @@ type Editor struct {
 	chat           db.Chat
 	content        []string
 	wrappedContent [][]rune
+	querying       bool
+	streamStarted  bool
+	responseLine   int
+	viaFallback    bool
+	cancelQuery    context.CancelFunc
+	previousAPI    int
+	model          string
+	models         []string
+	selectedModel  int
+	params         types.Params
+	command        string
+	usage          db.UsageTotals
+	budgetWarning  string
+	attachmentNote string // @ tokens of the sent message that went as text
+	continuing     string // Which continuation of a cut-off answer is streaming
+	// Broadcast state, see broadcast.go
+	broadcastSelected []bool
+	broadcastCursor   int
+	comparison        *comparison
+	// Tool calls waiting for the user's answer, see tools.go
+	toolConfirms      []*toolConfirmEvent
+	modeBeforeConfirm EditorMode
+	toolConfirmScroll int
+	toolConfirmSeen   bool // The end of the first call's arguments has been shown
+}
+
+// queryDeltaEvent carries a chunk of streamed response text to the event loop
+type queryDeltaEvent struct {
+	tcell.EventTime
+	delta string
+}
+
+// queryDoneEvent signals that an in-flight query has finished
+type queryDoneEvent struct {
+	tcell.EventTime
+	response types.Response
+	err      error
+}
+
+// queryRetryEvent reports that a failed request will be retried
+type queryRetryEvent struct {
+	tcell.EventTime
+	notice api.RetryNotice
+}
+
+// queryRateLimitEvent reports that a request is waiting for a rate limit
+type queryRateLimitEvent struct {
+	tcell.EventTime
+	notice api.RateLimitNotice
+}
+
+// queryContinueEvent reports that a cut-off answer is being continued
+type queryContinueEvent struct {
+	tcell.EventTime
+	notice api.ContinueNotice
+}
+
+func newQueryContinueEvent(notice api.ContinueNotice) *queryContinueEvent {
+	ev := &queryContinueEvent{notice: notice}
+	ev.SetEventNow()
+	return ev
+}
+
+// queryBudgetEvent warns that a query will take spending past a soft budget
+type queryBudgetEvent struct {
+	tcell.EventTime
+	warning api.BudgetWarning
+}
+
+func newQueryBudgetEvent(warning api.BudgetWarning) *queryBudgetEvent {
+	ev := &queryBudgetEvent{warning: warning}
+	ev.SetEventNow()
+	return ev
+}
+
+func newQueryRateLimitEvent(notice api.RateLimitNotice) *queryRateLimitEvent {
+	ev := &queryRateLimitEvent{notice: notice}
+	ev.SetEventNow()
+	return ev
+}
+
+func newQueryRetryEvent(notice api.RetryNotice) *queryRetryEvent {
+	ev := &queryRetryEvent{notice: notice}
+	ev.SetEventNow()
+	return ev
+}
+
+func newQueryDeltaEvent(delta string) *queryDeltaEvent {
+	ev := &queryDeltaEvent{delta: delta}
+	ev.SetEventNow()
+	return ev
+}
+
+func newQueryDoneEvent(response types.Response, err error) *queryDoneEvent {
+	ev := &queryDoneEvent{response: response, err: err}
+	ev.SetEventNow()
+	return ev
 }
 
 const (
@@ -84,6 +189,7 @@ func NewEditor(app *api.App, chatID int, chatTitle string) (*Editor, error) {
 	}
 
 	logger := log.New(logFile, "", log.Ldate|log.Ltime|log.Lmicroseconds)
+	api.SetLogger(logger)
 
 	screen, err := tcell.NewScreen()
 	if err != nil {
@@ -100,12 +206,27 @@ func NewEditor(app *api.App, chatID int, chatTitle string) (*Editor, error) {
 		return nil, fmt.Errorf("failed to get chat: %w", err)
 	}
 
+	params, err := db.GetChatParams(chatID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat params: %w", err)
+	}
+
+	usage, err := db.GetChatUsage(chatID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat usage: %w", err)
+	}
+
+	transcript, err := app.LoadTranscript(chatID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat messages: %w", err)
+	}
+
 	e := &Editor{
 		screen:      screen,
 		app:         app,
 		chatID:      chatID,
 		isDirty:     false,
-		content:     strings.Split(chat.Context, "\n"),
+		content:     strings.Split(transcript, "\n"),
 		cursor:      Cursor{x: 0, y: 0},
 		apis:        app.GetAvailableAPIs(),
 		selectedAPI: 0,
@@ -114,16 +235,27 @@ func NewEditor(app *api.App, chatID int, chatTitle string) (*Editor, error) {
 		selection:   Selection{start: Cursor{x: 0, y: 0}, end: Cursor{x: 0, y: 0}},
 		chatTitle:   chatTitle,
 		chat:        chat,
+		params:      params,
+		usage:       usage,
 	}
 
-	// Set default API to the first one with a key set
-	if err := e.setDefaultAPI(); err != nil {
-		return nil, fmt.Errorf("failed to set default API: %w", err)
+	// Continue with the API and model the chat used last, otherwise default
+	// to the first API with a key set
+	if !e.restoreChatModel() {
+		if err := e.setDefaultAPI(); err != nil {
+			return nil, fmt.Errorf("failed to set default API: %w", err)
+		}
 	}
+	api.ProbeModel(e.apis[e.selectedAPI], e.model)
 
-	// If there's no content, add an empty line to start with
-	if len(e.content) == 0 {
-		e.content = append(e.content, "")
+	// Start new chats, and chats that ended on a response, with a prompt for
+	// the next user turn
+	if strings.TrimSpace(transcript) == "" {
+		e.content = []string{api.HumanPrefix + " "}
+		e.cursor.x = len(e.content[0])
+	} else if _, ok := api.LastUserMessage(api.ParseTranscript(transcript)); !ok {
+		e.appendPrompt()
+		e.isDirty = false
 	}
 
 	e.logger.Println("Editor initialized")
@@ -191,15 +323,17 @@ func (e *Editor) wrapContent() {
 }
 
 func (e *Editor) setDefaultAPI() error {
-	apiKeys, err := db.GetAllAPIKeys()
+	keys, err := api.APIKeySources()
 	if err != nil {
 		return fmt.Errorf("failed to get API keys: %w", err)
 	}
 
 	// Create a map for easier lookup
-	apiKeyMap := make(map[string]string)
-	for _, key := range apiKeys {
-		apiKeyMap[key.APIName] = key.APIKey
+	apiKeyMap := make(map[string]bool)
+	for _, key := range keys {
+		if key.Source != "" {
+			apiKeyMap[key.Name] = true
+		}
 	}
 
 	for i, api := range e.apis {
@@ -214,19 +348,23 @@ func (e *Editor) setDefaultAPI() error {
 	return nil
 }
 
-func (e *Editor) saveContext() error {
-	context := strings.Join(e.content, "\n")
-	return db.UpdateChatContext(e.chat.ID, context)
+// saveTranscript stores the buffer as the chat's messages. response, when
+// given, is the answer that has just been added to the end.
+func (e *Editor) saveTranscript(response *types.Response) error {
+	return e.app.SaveTranscript(e.chat.ID, strings.Join(e.content, "\n"), response)
 }
 
 func (e *Editor) Run() error {
 	defer func() {
-		if err := e.saveContext(); err != nil {
-			e.logger.Printf("Error saving chat context: %v", err)
+		if e.cancelQuery != nil {
+			e.cancelQuery()
+		}
+		if err := e.saveTranscript(nil); err != nil {
+			e.logger.Printf("Error saving chat messages: %v", err)
 		}
 		e.screen.Fini()
 	}()
-	e.status = "Normal Mode | Ctrl+E: Send query, Ctrl+J: Select API, Ctrl+Q: Quit, v: Visual Mode, i: Insert Mode"
+	e.status = "Normal Mode | Ctrl+E: Send query, Ctrl+J: Select API, Ctrl+K: Select model, Ctrl+Q: Quit, v: Visual Mode, i: Insert Mode"
 
 	for {
 		e.draw()
@@ -242,6 +380,26 @@ func (e *Editor) Run() error {
 		case *tcell.EventResize:
 			e.screen.Sync()
 			e.logger.Println("Screen resized")
+		case *queryDeltaEvent:
+			e.handleQueryDelta(ev.delta)
+		case *queryDoneEvent:
+			e.handleQueryDone(ev.response, ev.err)
+		case *queryRetryEvent:
+			e.handleQueryRetry(ev.notice)
+		case *queryRateLimitEvent:
+			e.handleQueryRateLimit(ev.notice)
+		case *queryBudgetEvent:
+			e.handleQueryBudget(ev.warning)
+		case *queryContinueEvent:
+			e.handleQueryContinue(ev.notice)
+		case *modelsLoadedEvent:
+			e.handleModelsLoaded(ev)
+		case *broadcastDeltaEvent:
+			e.handleBroadcastDelta(ev)
+		case *broadcastDoneEvent:
+			e.handleBroadcastDone(ev)
+		case *toolConfirmEvent:
+			e.handleToolConfirm(ev)
 		}
 	}
 }
@@ -249,6 +407,14 @@ func (e *Editor) Run() error {
 func (e *Editor) handleKeyEvent(ev *tcell.EventKey) bool {
 	e.logger.Printf("Key event: key=%v rune=%v mod=%v", ev.Key(), ev.Rune(), ev.Modifiers())
 
+	// Esc cancels an in-flight query before it is handled by the current mode
+	if ev.Key() == tcell.KeyEscape && e.querying {
+		e.logger.Println("Cancel query command received")
+		e.cancelQuery()
+		e.status = "Cancelling query..."
+		return false
+	}
+
 	// Handle Ctrl+E (send query) in any mode
 	if ev.Key() == tcell.KeyCtrlE {
 		e.sendQuery()
@@ -264,6 +430,16 @@ func (e *Editor) handleKeyEvent(ev *tcell.EventKey) bool {
 		return e.handleInsertModeKey(ev)
 	case APISelectMode:
 		return e.handleAPISelectModeKey(ev)
+	case ModelSelectMode:
+		return e.handleModelSelectModeKey(ev)
+	case CommandMode:
+		return e.handleCommandModeKey(ev)
+	case BroadcastSelectMode:
+		return e.handleBroadcastSelectModeKey(ev)
+	case CompareMode:
+		return e.handleCompareModeKey(ev)
+	case ToolConfirmMode:
+		return e.handleToolConfirmModeKey(ev)
 	case QuitMode:
 		return e.handleQuitModeKey(ev)
 	}
@@ -285,6 +461,12 @@ func (e *Editor) handleNormalModeKey(ev *tcell.EventKey) bool {
 	case tcell.KeyCtrlJ:
 		e.logger.Println("Select API command received")
 		e.selectAPI()
+	case tcell.KeyCtrlK:
+		e.logger.Println("Select model command received")
+		e.selectModel()
+	case tcell.KeyCtrlB:
+		e.logger.Println("Broadcast command received")
+		e.selectBroadcast()
 	case tcell.KeyLeft, tcell.KeyRight, tcell.KeyUp, tcell.KeyDown:
 		e.handleArrowKeys(ev.Key())
 	case tcell.KeyRune:
@@ -308,6 +490,8 @@ func (e *Editor) handleNormalModeKey(ev *tcell.EventKey) bool {
 			}
 		case 'G':
 			e.moveCursorToBottom()
+		case ':':
+			e.enterCommandMode()
 		}
 	}
 	e.lastKey = ev.Rune() // Store the last key pressed for 'gg' functionality
@@ -387,9 +571,15 @@ func (e *Editor) handleAPISelectModeKey(ev *tcell.EventKey) bool {
 		e.cycleAPI(true)
 	case tcell.KeyEnter:
 		e.mode = NormalMode
-		e.status = fmt.Sprintf("API set to: %s", e.apis[e.selectedAPI].Name)
+		e.setChatModel("")
+		info := e.apis[e.selectedAPI]
+		e.status = fmt.Sprintf("API set to: %s", info.Name)
+		if e.params.JSON && !info.Capabilities.JSONMode {
+			e.status += ". It has no JSON mode, run :unset json to query it"
+		}
 	case tcell.KeyEscape:
 		e.mode = NormalMode
+		e.selectedAPI = e.previousAPI
 		e.status = "API selection cancelled"
 	}
 	e.draw()
@@ -426,6 +616,14 @@ func (e *Editor) getModeColor() tcell.Color {
 		return tcell.ColorBlue
 	case APISelectMode:
 		return tcell.ColorYellow
+	case ModelSelectMode:
+		return tcell.ColorYellow
+	case CommandMode:
+		return tcell.ColorPurple
+	case BroadcastSelectMode, CompareMode:
+		return tcell.ColorTeal
+	case ToolConfirmMode:
+		return tcell.ColorFuchsia
 	case QuitMode:
 		return tcell.ColorRed
 	default:
@@ -438,6 +636,20 @@ func (e *Editor) draw() {
 	width, height := e.screen.Size()
 	contentHeight := height - StatusBarHeight
 
+	if e.mode == CompareMode {
+		e.drawComparison(width, contentHeight)
+		e.drawStatusBar(width, height)
+		e.screen.Show()
+		return
+	}
+
+	if e.mode == ToolConfirmMode && len(e.toolConfirms) > 0 {
+		e.drawToolConfirm(width, contentHeight)
+		e.drawStatusBar(width, height)
+		e.screen.Show()
+		return
+	}
+
 	e.wrapContent() // Wrap content before drawing
 
 	// Calculate the starting X position to center the editor
@@ -502,6 +714,16 @@ func (e *Editor) getModeInfo() string {
 		return "VISUAL MODE | h/j/k/l: Extend selection, y: Yank, d: Delete"
 	case APISelectMode:
 		return "API SELECT MODE | ←/→: Change API, Enter: Confirm, Esc: Cancel"
+	case ModelSelectMode:
+		return "MODEL SELECT MODE | ←/→: Change model, Enter: Confirm, Esc: Cancel"
+	case CommandMode:
+		return "COMMAND MODE | set name=value, unset name, set: Show parameters, attach path"
+	case BroadcastSelectMode:
+		return "BROADCAST MODE | ←/→: Move, Space: Toggle API, Enter: Send, Esc: Cancel"
+	case CompareMode:
+		return "COMPARE MODE | ←/→: Select response, ↑/↓: Scroll, Enter: Keep selected, a: Keep all"
+	case ToolConfirmMode:
+		return "TOOL CONFIRM MODE | j/k: Scroll arguments, y: Allow tool call, n: Deny tool call"
 	case QuitMode:
 		return "QUIT MODE | y: Quit, n: Cancel"
 	default:
@@ -512,13 +734,23 @@ func (e *Editor) getModeInfo() string {
 func (e *Editor) getModeInstructions() string {
 	switch e.mode {
 	case NormalMode:
-		return "v: Enter Visual Mode | i: Enter Insert Mode | gg: Go to top | G: Go to bottom"
+		return "v: Enter Visual Mode | i: Enter Insert Mode | gg: Go to top | G: Go to bottom | :: Command"
 	case InsertMode:
 		return "Esc: Exit Insert Mode"
 	case VisualMode:
 		return "Esc: Exit Visual Mode"
 	case APISelectMode:
 		return "Esc: Exit API Select Mode"
+	case ModelSelectMode:
+		return "Esc: Exit Model Select Mode"
+	case CommandMode:
+		return "Enter: Run command | Esc: Cancel"
+	case BroadcastSelectMode:
+		return "Esc: Exit Broadcast Mode"
+	case CompareMode:
+		return "Esc: Cancel queries, then discard responses"
+	case ToolConfirmMode:
+		return "Esc: Cancel query"
 	case QuitMode:
 		return "y: Quit, n: Cancel"
 	default:
@@ -533,7 +765,7 @@ func (e *Editor) drawStatusBar(width, height int) {
 		Foreground(tcell.ColorBlack)
 
 	// Line 1: Chat title and selected API
-	titleAndAPI := fmt.Sprintf("Chat: %s | API: %s", e.chatTitle, e.apis[e.selectedAPI].Name)
+	titleAndAPI := fmt.Sprintf("Chat: %s | API: %s | Model: %s | %s", e.chatTitle, e.apis[e.selectedAPI].Name, e.modelName(), e.usageSummary())
 	e.drawStatusBarLine(titleAndAPI, width, height-StatusBarHeight, statusStyle)
 
 	// Line 2: Mode info
@@ -545,11 +777,17 @@ func (e *Editor) drawStatusBar(width, height int) {
 	e.drawStatusBarLine(modeInstructions, width, height-3, statusStyle)
 
 	// Line 4: General instructions
-	generalInstructions := "Ctrl+E: Send Query | Ctrl+J: Select API | Ctrl+Q: Quit"
+	generalInstructions := "Ctrl+E: Send Query | Ctrl+B: Broadcast | Ctrl+J: Select API | Ctrl+K: Select Model | Ctrl+Q: Quit"
 	e.drawStatusBarLine(generalInstructions, width, height-2, statusStyle)
 
-	// Line 5: Cursor position and content info
+	// Line 5: Command line, or cursor position, content info and status
 	contentInfo := fmt.Sprintf("Ln %d, Col %d | %d lines", e.cursor.y+1, e.cursor.x+1, len(e.content))
+	if e.status != "" {
+		contentInfo += " | " + e.status
+	}
+	if e.mode == CommandMode {
+		contentInfo = ":" + e.command
+	}
 	e.drawStatusBarLine(contentInfo, width, height-1, statusStyle)
 
 	statusBarWidth := EditorWidth
@@ -589,6 +827,16 @@ func (e *Editor) getModeString() string {
 		return "Insert"
 	case APISelectMode:
 		return "API Select"
+	case ModelSelectMode:
+		return "Model Select"
+	case CommandMode:
+		return "Command"
+	case BroadcastSelectMode:
+		return "Broadcast Select"
+	case CompareMode:
+		return "Compare"
+	case ToolConfirmMode:
+		return "Tool Confirm"
 	case QuitMode:
 		return "Quit"
 	default:
@@ -678,29 +926,295 @@ func (e *Editor) insertChar(ch rune) {
 }
 
 func (e *Editor) sendQuery() {
-	query := e.getLastParagraph()
+	if e.querying {
+		e.status = "A query is already in progress, please wait for it to finish"
+		return
+	}
+	if e.mode == CompareMode {
+		e.status = "Keep or discard the broadcast responses first"
+		return
+	}
+
+	messages := api.ParseTranscript(strings.Join(e.content, "\n"))
+	last, ok := api.LastUserMessage(messages)
+	if !ok {
+		e.status = fmt.Sprintf("Nothing to send. Type your message after \"%s\"", api.HumanPrefix)
+		return
+	}
+	messages, skipped, err := e.app.ResolveAttachments(e.chat.ID, strings.Join(e.content, "\n"))
+	if err != nil {
+		e.logger.Printf("Error attaching files: %v", err)
+		e.status = fmt.Sprintf("Error attaching files: %v", err)
+		return
+	}
+	e.attachmentNote = skippedAttachmentsNote(skipped)
 	apiInfo := e.apis[e.selectedAPI]
 
-	e.logger.Printf("Sending query to API %s: %s", apiInfo.Name, query)
-	e.status = "Sending query..."
+	e.logger.Printf("Sending query to API %s (%d messages): %s", apiInfo.Name, len(messages), last.Content)
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx = api.WithRetryNotify(ctx, func(notice api.RetryNotice) {
+		e.postEvent(newQueryRetryEvent(notice))
+	})
+	ctx = api.WithRateLimitNotify(ctx, func(notice api.RateLimitNotice) {
+		e.postEvent(newQueryRateLimitEvent(notice))
+	})
+	ctx = api.WithBudgetWarning(ctx, func(warning api.BudgetWarning) {
+		e.postEvent(newQueryBudgetEvent(warning))
+	})
+	ctx = api.WithContinueNotify(ctx, func(notice api.ContinueNotice) {
+		e.postEvent(newQueryContinueEvent(notice))
+	})
+	if apiInfo.Capabilities.Tools {
+		ctx = api.WithToolConfirm(ctx, e.confirmTool(ctx))
+	}
+	e.cancelQuery = cancel
+	e.querying = true
+	e.streamStarted = false
+	e.budgetWarning = ""
+	e.continuing = ""
+	_, e.viaFallback = apiInfo.Handler.(*api.FallbackAPI)
+	e.status = fmt.Sprintf("Waiting for %s... (Esc to cancel)", apiInfo.Name)
+	if e.attachmentNote != "" {
+		e.status += " | " + e.attachmentNote
+	}
 	e.draw()
-	e.screen.Show()
 
-	response, err := e.app.HandleQuery(apiInfo.Shortcut, query, e.chat.ID, strings.Join(e.content, "\n"))
+	// Run the request off the event loop so the screen keeps redrawing while
+	// the response streams in
+	query := types.Request{Messages: messages, Model: e.model, Params: e.params, Summary: e.chat.Summary}
+	go func() {
+		defer cancel()
+		response, err := e.app.StreamQuery(ctx, apiInfo.Shortcut, query, func(delta string) {
+			e.postEvent(newQueryDeltaEvent(delta))
+		})
+		e.postEvent(newQueryDoneEvent(response, err))
+	}()
+}
+
+func (e *Editor) postEvent(ev tcell.Event) {
+	if err := e.screen.PostEvent(ev); err != nil {
+		e.logger.Printf("Error posting event: %v", err)
+	}
+}
+
+func (e *Editor) startResponse() {
+	if e.streamStarted {
+		return
+	}
+	e.streamStarted = true
+	e.content = append(e.content, "", api.AssistantPrefix+" ")
+	e.responseLine = len(e.content) - 1
+}
+
+// labelResponse notes in the response header which API answered, which
+// only fallback chains need since otherwise it is the selected API, and
+// whether the answer came from the response cache
+func (e *Editor) labelResponse(response types.Response) {
+	var label []string
+	if e.viaFallback && response.Provider != "" {
+		label = append(label, response.Provider)
+	}
+	if response.Cached {
+		label = append(label, "cached")
+	}
+	if len(label) == 0 || e.responseLine >= len(e.content) {
+		return
+	}
+	line := e.content[e.responseLine]
+	if rest, ok := strings.CutPrefix(line, api.AssistantPrefix); ok {
+		e.content[e.responseLine] = api.AssistantHeader(strings.Join(label, ", ")) + rest
+	}
+}
+
+func (e *Editor) handleQueryDelta(delta string) {
+	e.startResponse()
+	e.appendDelta(delta)
+	e.status = "Receiving response... (Esc to cancel)"
+	if e.continuing != "" {
+		e.status = "Receiving response, " + e.continuing + "... (Esc to cancel)"
+	}
+}
+
+// handleQueryContinue notes that an answer was cut off by max_tokens and the
+// rest is being requested
+func (e *Editor) handleQueryContinue(notice api.ContinueNotice) {
+	e.logger.Printf("%s answer was cut off by max_tokens, continuing (%d/%d)", notice.Provider, notice.Part, notice.MaxParts)
+	e.continuing = fmt.Sprintf("continuing %d/%d", notice.Part, notice.MaxParts)
+	e.status = fmt.Sprintf("%s: answer cut off by max_tokens, %s... (Esc to cancel)", notice.Provider, e.continuing)
+}
+
+func (e *Editor) handleQueryRetry(notice api.RetryNotice) {
+	e.logger.Printf("Retrying %s in %s (attempt %d/%d): %v", notice.Provider, notice.Delay, notice.Attempt, notice.MaxAttempts, notice.Err)
+	e.status = fmt.Sprintf("%s: %s, retrying in %s (attempt %d/%d) (Esc to cancel)",
+		notice.Provider, types.ErrorKindOf(notice.Err), formatDelay(notice.Delay), notice.Attempt, notice.MaxAttempts)
+}
+
+func (e *Editor) handleQueryRateLimit(notice api.RateLimitNotice) {
+	if notice.Delay == 0 {
+		e.status = fmt.Sprintf("%s: waiting for one of %s to finish (Esc to cancel)", notice.Provider, notice.Limit)
+		return
+	}
+	e.status = fmt.Sprintf("%s: %s limit reached, sending in %s (Esc to cancel)", notice.Provider, notice.Limit, formatDelay(notice.Delay))
+}
+
+// handleQueryBudget keeps a soft budget warning so it can be shown with the
+// query's outcome, which would otherwise overwrite it
+func (e *Editor) handleQueryBudget(warning api.BudgetWarning) {
+	e.logger.Printf("Budget warning: %s", warning)
+	e.budgetWarning = "Warning: " + warning.String()
+	e.status = e.budgetWarning
+}
+
+// formatDelay rounds a retry or rate limit delay to whole seconds for
+// display, showing at least one second
+func formatDelay(d time.Duration) string {
+	seconds := int(math.Ceil(d.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return fmt.Sprintf("%ds", seconds)
+}
+
+func (e *Editor) handleQueryDone(response types.Response, err error) {
+	e.querying = false
+	e.cancelQuery = nil
+	e.endToolConfirms()
+	e.recordUsage(response, err)
+	e.saveSummary(response.Summary)
+
 	if err != nil {
-		e.status = fmt.Sprintf("Error: %v", err)
 		e.logger.Printf("Error sending query: %v", err)
+		e.status = queryErrorStatus(err)
+		// Keep whatever was streamed before the failure, but start a fresh
+		// prompt so the partial answer is not mistaken for the user's turn
+		if e.streamStarted {
+			e.labelResponse(response)
+			e.appendPrompt()
+			e.saveResponse(response)
+		}
 		return
 	}
 
-	// Append the query and response to the content
-	e.appendText(fmt.Sprintf("Assistant: %s\n", response))
+	e.startResponse()
+	e.labelResponse(response)
+	e.appendPrompt()
+	e.saveResponse(response)
 
-	e.isDirty = true
 	e.status = "Query sent and response received. Ctrl+E to send another, Ctrl+J to change API."
-	e.logger.Printf("Query sent and response received. Response length: %d", len(response))
+	if response.Cached {
+		e.status = "Cached response reused. Ctrl+E to send another, :set cache=off to always ask the API."
+	}
+	if status := truncationStatus(response); status != "" {
+		e.status = status
+	}
+	if e.budgetWarning != "" {
+		e.status = e.budgetWarning
+	}
+	if e.attachmentNote != "" {
+		e.status += " | " + e.attachmentNote
+	}
+	e.logger.Printf("Query sent and response received. Response length: %d", len(response.Text))
+}
 
-	e.draw()
+// skippedAttachmentsNote lists the @ tokens that were sent as text for the
+// status bar
+func skippedAttachmentsNote(skipped []api.SkippedAttachment) string {
+	notes := make([]string, len(skipped))
+	for i, s := range skipped {
+		notes[i] = s.String()
+	}
+	return strings.Join(notes, "; ")
+}
+
+// saveResponse stores the chat as soon as an answer arrives, recording which
+// model gave it and the tokens it used
+func (e *Editor) saveResponse(response types.Response) {
+	if err := e.saveTranscript(&response); err != nil {
+		e.logger.Printf("Error saving chat messages: %v", err)
+	}
+}
+
+// truncationStatus reports answers that were cut off by max_tokens, or
+// needed continuing to finish
+func truncationStatus(response types.Response) string {
+	switch {
+	case response.Truncated && response.Continuations > 0:
+		return fmt.Sprintf("Answer still cut off after %d continuations. Raise max_tokens or continue to get the rest.", response.Continuations)
+	case response.Truncated:
+		return "Answer cut off by max_tokens. Raise it with :set max_tokens=N, or :set continue=N to finish answers automatically."
+	case response.Continuations > 0:
+		return fmt.Sprintf("Answer was cut off by max_tokens and continued %d times.", response.Continuations)
+	}
+	return ""
+}
+
+// saveSummary keeps a new summary of the chat's oldest messages, so later
+// queries send it in their place without summarizing again
+func (e *Editor) saveSummary(summary *types.Summary) {
+	if summary == nil {
+		return
+	}
+	e.logger.Printf("Summarized the first %d messages", summary.Messages)
+	e.chat.Summary = *summary
+	if err := db.UpdateChatSummary(e.chat.ID, *summary); err != nil {
+		e.logger.Printf("Error saving chat summary: %v", err)
+	}
+}
+
+// queryErrorStatus turns a failed query into a status bar message
+func queryErrorStatus(err error) string {
+	if errors.Is(err, context.Canceled) {
+		return "Query cancelled"
+	}
+
+	switch types.ErrorKindOf(err) {
+	case types.ErrAuth:
+		return fmt.Sprintf("Authentication failed, check the API key in Settings: %v", err)
+	case types.ErrRateLimit:
+		return fmt.Sprintf("Rate limited, wait a moment and try again: %v", err)
+	case types.ErrNetwork:
+		return fmt.Sprintf("Network error, check your connection: %v", err)
+	case types.ErrBadRequest:
+		return fmt.Sprintf("Request rejected: %v", err)
+	case types.ErrServer:
+		return fmt.Sprintf("Provider error, try again or switch API with Ctrl+J: %v", err)
+	case types.ErrBudget:
+		return fmt.Sprintf("Budget reached, raise it in Settings or switch API with Ctrl+J: %v", err)
+	default:
+		return fmt.Sprintf("Error: %v", err)
+	}
+}
+
+// appendPrompt starts a new user turn at the end of the buffer so the next
+// message is clearly separated from the previous response
+func (e *Editor) appendPrompt() {
+	e.content = append(e.content, "", api.HumanPrefix+" ")
+	e.cursor.y = len(e.content) - 1
+	e.cursor.x = len(e.content[e.cursor.y])
+	e.isDirty = true
+	e.adjustScroll()
+}
+
+// appendDelta appends streamed text to the end of the buffer, wrapping lines
+// at the editor width, and keeps the cursor on the newest text
+func (e *Editor) appendDelta(delta string) {
+	for _, ch := range delta {
+		last := len(e.content) - 1
+		if ch == '\n' {
+			e.content = append(e.content, "")
+			continue
+		}
+		if runewidth.StringWidth(e.content[last])+runewidth.RuneWidth(ch) > EditorWidth-1 {
+			e.content = append(e.content, "")
+			last++
+		}
+		e.content[last] += string(ch)
+	}
+
+	e.cursor.y = len(e.content) - 1
+	e.cursor.x = len(e.content[e.cursor.y])
+	e.isDirty = true
+	e.adjustScroll()
 }
 
 func (e *Editor) isTextSelected() bool {
@@ -758,6 +1272,18 @@ func (e *Editor) getCurrentLine() string {
 	return ""
 }
 
+// goToLine moves the cursor to the start of line and scrolls it into view
+func (e *Editor) goToLine(line int) {
+	if line >= len(e.content) {
+		line = len(e.content) - 1
+	}
+	if line < 0 {
+		line = 0
+	}
+	e.cursor = Cursor{x: 0, y: line}
+	e.adjustScroll()
+}
+
 func (e *Editor) adjustScroll() {
 	_, height := e.screen.Size()
 	contentHeight := height - StatusBarHeight
@@ -854,7 +1380,9 @@ func (e *Editor) cycleAPI(forward bool) {
 	} else {
 		e.selectedAPI = (e.selectedAPI - 1 + len(e.apis)) % len(e.apis)
 	}
-	e.status = fmt.Sprintf("Selected API: %s (Use ← → arrows to change, Enter to confirm, Esc to cancel)", e.apis[e.selectedAPI].Name)
+	info := e.apis[e.selectedAPI]
+	e.status = fmt.Sprintf("Selected API: %s [%s] (Use ← → arrows to change, Enter to confirm, Esc to cancel)",
+		info.Name, api.FormatCapabilities(info.Capabilities))
 	e.logger.Printf("Cycled to API: %s", e.apis[e.selectedAPI].Name)
 }
 
@@ -882,6 +1410,7 @@ func (e *Editor) exitInsertMode() {
 
 func (e *Editor) selectAPI() {
 	e.logger.Println("Entering API selection mode")
+	e.previousAPI = e.selectedAPI
 	e.mode = APISelectMode
 	e.draw()
 }
@@ -953,14 +1482,14 @@ func (e *Editor) quitEditor() {
 	e.logger.Println("Quitting editor")
 
 	if e.isDirty {
-		if err := e.saveContext(); err != nil {
-			e.logger.Printf("Error saving chat context: %v", err)
+		if err := e.saveTranscript(nil); err != nil {
+			e.logger.Printf("Error saving chat messages: %v", err)
 			e.status = fmt.Sprintf("Error saving chat: %v", err)
 			e.draw()
 			e.screen.Show()
 			time.Sleep(2 * time.Second) // Give user time to see the error message
 		} else {
-			e.logger.Println("Chat context saved successfully")
+			e.logger.Println("Chat messages saved successfully")
 		}
 	}
 
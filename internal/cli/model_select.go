@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Utility-Gods/gottem/internal/api"
+	"github.com/Utility-Gods/gottem/internal/db"
+	"github.com/gdamore/tcell/v2"
+)
+
+// modelsLoadedEvent delivers the result of a model list request to the event
+// loop
+type modelsLoadedEvent struct {
+	tcell.EventTime
+	shortcut string
+	models   []string
+	err      error
+}
+
+func newModelsLoadedEvent(shortcut string, models []string, err error) *modelsLoadedEvent {
+	ev := &modelsLoadedEvent{shortcut: shortcut, models: models, err: err}
+	ev.SetEventNow()
+	return ev
+}
+
+// restoreChatModel selects the API and model saved on the chat. It returns
+// false if the chat has none or its API is no longer available.
+func (e *Editor) restoreChatModel() bool {
+	if e.chat.Provider == "" {
+		return false
+	}
+
+	for i, api := range e.apis {
+		if api.Shortcut == e.chat.Provider {
+			e.selectedAPI = i
+			e.model = e.chat.Model
+			e.logger.Printf("Restored API %s with model %q", api.Name, e.model)
+			return true
+		}
+	}
+
+	e.logger.Printf("Saved API %q is not available", e.chat.Provider)
+	return false
+}
+
+// setChatModel switches the model for the current API and saves the choice
+// on the chat. An empty model means the API's default.
+func (e *Editor) setChatModel(model string) {
+	e.model = model
+	api.ProbeModel(e.apis[e.selectedAPI], model)
+	shortcut := e.apis[e.selectedAPI].Shortcut
+	if err := db.UpdateChatModel(e.chat.ID, shortcut, model); err != nil {
+		e.logger.Printf("Error saving chat model: %v", err)
+		e.status = fmt.Sprintf("Error saving model: %v", err)
+	}
+}
+
+// modelName returns the model queries will use, for display
+func (e *Editor) modelName() string {
+	if e.model != "" {
+		return e.model
+	}
+	if model := e.app.DefaultModel(e.apis[e.selectedAPI].Shortcut); model != "" {
+		return model + " (default)"
+	}
+	return "default"
+}
+
+// selectModel loads the models for the current API in the background and
+// enters model selection once they arrive
+func (e *Editor) selectModel() {
+	shortcut := e.apis[e.selectedAPI].Shortcut
+	e.status = fmt.Sprintf("Loading models for %s...", e.apis[e.selectedAPI].Name)
+	e.draw()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		models, err := e.app.ListModels(ctx, shortcut)
+		e.postEvent(newModelsLoadedEvent(shortcut, models, err))
+	}()
+}
+
+func (e *Editor) handleModelsLoaded(ev *modelsLoadedEvent) {
+	if ev.shortcut != e.apis[e.selectedAPI].Shortcut {
+		// The API changed while the list was loading
+		return
+	}
+	if ev.err != nil {
+		e.logger.Printf("Error listing models: %v", ev.err)
+		e.status = fmt.Sprintf("Could not load models: %v", ev.err)
+		return
+	}
+
+	e.models = ev.models
+	e.selectedModel = 0
+	current := e.model
+	if current == "" {
+		current = e.app.DefaultModel(ev.shortcut)
+	}
+	for i, model := range e.models {
+		if model == current {
+			e.selectedModel = i
+			break
+		}
+	}
+
+	e.logger.Printf("Entering model selection mode with %d models", len(e.models))
+	e.mode = ModelSelectMode
+	e.status = fmt.Sprintf("Selected model: %s (Use ← → arrows to change, Enter to confirm, Esc to cancel)", e.models[e.selectedModel])
+}
+
+func (e *Editor) handleModelSelectModeKey(ev *tcell.EventKey) bool {
+	switch ev.Key() {
+	case tcell.KeyLeft:
+		e.cycleModel(false)
+	case tcell.KeyRight:
+		e.cycleModel(true)
+	case tcell.KeyEnter:
+		e.mode = NormalMode
+		e.setChatModel(e.models[e.selectedModel])
+		e.status = fmt.Sprintf("Model set to: %s", e.model)
+	case tcell.KeyEscape:
+		e.mode = NormalMode
+		e.status = "Model selection cancelled"
+	}
+	e.draw()
+	return false
+}
+
+func (e *Editor) cycleModel(forward bool) {
+	if forward {
+		e.selectedModel = (e.selectedModel + 1) % len(e.models)
+	} else {
+		e.selectedModel = (e.selectedModel - 1 + len(e.models)) % len(e.models)
+	}
+	e.status = fmt.Sprintf("Selected model: %s (Use ← → arrows to change, Enter to confirm, Esc to cancel)", e.models[e.selectedModel])
+	e.logger.Printf("Cycled to model: %s", e.models[e.selectedModel])
+}
@@ -0,0 +1,132 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Utility-Gods/gottem/internal/api"
+	"github.com/Utility-Gods/gottem/internal/db"
+	"github.com/manifoldco/promptui"
+)
+
+// searchLimit is how many hits the search screen lists
+const searchLimit = 30
+
+var (
+	highlightMatch = promptui.Styler(promptui.FGYellow, promptui.FGBold)
+	titleStyle     = promptui.Styler(promptui.FGCyan)
+)
+
+// searchResult is a hit as the search screen shows it
+type searchResult struct {
+	Label string
+	Where string
+	match db.ChatMatch
+}
+
+// searchChats asks for words to look for across every chat, lists the hits
+// best first and opens the chosen one in the editor at the matching line
+func searchChats(app *api.App) {
+	prompt := promptui.Prompt{
+		Label: "Search chats",
+	}
+	text, err := prompt.Run()
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+		return
+	}
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+
+	matches, err := db.SearchChats(text, searchLimit)
+	if err != nil {
+		fmt.Printf("Error searching chats: %v\n", err)
+		return
+	}
+	if len(matches) == 0 {
+		fmt.Printf("No chats match %q.\n", text)
+		return
+	}
+
+	results := make([]searchResult, len(matches))
+	for i, m := range matches {
+		result := searchResult{match: m}
+		if m.MessageID == 0 {
+			result.Label = highlightSnippet(m)
+			result.Where = "title"
+		} else {
+			result.Label = titleStyle(m.Title) + "  " + highlightSnippet(m)
+			result.Where = "message"
+		}
+		results[i] = result
+	}
+
+	templates := &promptui.SelectTemplates{
+		Label:    "{{ . }}",
+		Active:   "\U0001F449 {{ .Label }}",
+		Inactive: "  {{ .Label }}",
+		Selected: "\U0001F449 {{ .Label }}",
+		Details: `
+--------- Match ----------
+{{ "Found in:" | faint }}	{{ .Where }}`,
+	}
+
+	selectPrompt := promptui.Select{
+		Label:     fmt.Sprintf("%d results for %q", len(results), text),
+		Items:     results,
+		Templates: templates,
+		Size:      10,
+	}
+	index, _, err := selectPrompt.Run()
+	if err != nil {
+		return
+	}
+
+	openSearchResult(app, results[index].match)
+}
+
+// highlightSnippet styles the matched words of a hit's snippet
+func highlightSnippet(m db.ChatMatch) string {
+	var b strings.Builder
+	rest := m.Snippet
+	for {
+		before, after, ok := strings.Cut(rest, db.MatchStart)
+		b.WriteString(before)
+		if !ok {
+			return b.String()
+		}
+		term, after, _ := strings.Cut(after, db.MatchEnd)
+		b.WriteString(highlightMatch(term))
+		rest = after
+	}
+}
+
+// openSearchResult opens the chat of a hit with the cursor on the line that
+// matched
+func openSearchResult(app *api.App, match db.ChatMatch) {
+	chat, err := db.GetChat(match.ChatID)
+	if err != nil {
+		fmt.Printf("Error retrieving chat: %v\n", err)
+		return
+	}
+
+	editor, err := NewEditor(app, chat.ID, chat.Title)
+	if err != nil {
+		fmt.Printf("Error creating editor: %v\n", err)
+		return
+	}
+
+	if match.MessageID != 0 {
+		messages, err := db.GetMessages(chat.ID)
+		if err != nil {
+			editor.logger.Printf("Error retrieving messages: %v", err)
+		} else {
+			editor.goToLine(api.TranscriptLine(messages, match.MessageID, match.Terms()))
+		}
+	}
+
+	if err := editor.Run(); err != nil {
+		fmt.Printf("Error running editor: %v\n", err)
+	}
+}
@@ -0,0 +1,210 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/Utility-Gods/gottem/internal/api"
+	"github.com/gdamore/tcell/v2"
+)
+
+// toolConfirmEvent asks the user whether a tool call may run. The answer is
+// sent on reply, which is buffered so the event loop never blocks on it.
+type toolConfirmEvent struct {
+	tcell.EventTime
+	call  api.ToolCall
+	reply chan bool
+}
+
+func newToolConfirmEvent(call api.ToolCall) *toolConfirmEvent {
+	ev := &toolConfirmEvent{call: call, reply: make(chan bool, 1)}
+	ev.SetEventNow()
+	return ev
+}
+
+// confirmTool returns the callback a query uses to confirm tool calls. It
+// runs on the query's goroutine and waits for the user to answer, treating a
+// cancelled query as a refusal.
+func (e *Editor) confirmTool(ctx context.Context) func(api.ToolCall) bool {
+	return func(call api.ToolCall) bool {
+		ev := newToolConfirmEvent(call)
+		e.postEvent(ev)
+		select {
+		case ok := <-ev.reply:
+			return ok
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// handleToolConfirm queues a tool call for the user to allow or deny
+func (e *Editor) handleToolConfirm(ev *toolConfirmEvent) {
+	e.logger.Printf("Tool call requested: %s %s", ev.call.Name, ev.call.Arguments)
+	e.toolConfirms = append(e.toolConfirms, ev)
+	if e.mode != ToolConfirmMode {
+		e.modeBeforeConfirm = e.mode
+		e.mode = ToolConfirmMode
+		e.resetToolConfirmView()
+	}
+	e.status = e.toolConfirmStatus()
+}
+
+// toolConfirmStatus asks about the first queued call. It can only be
+// allowed once all of its arguments have been on screen.
+func (e *Editor) toolConfirmStatus() string {
+	call := e.toolConfirms[0].call
+	if !e.toolConfirmSeen {
+		return fmt.Sprintf("Run %s? j/↓: Scroll to see all arguments, n: Deny", call.Name)
+	}
+	return fmt.Sprintf("Run %s? y: Allow, n: Deny", call.Name)
+}
+
+func (e *Editor) handleToolConfirmModeKey(ev *tcell.EventKey) bool {
+	switch ev.Key() {
+	case tcell.KeyUp:
+		e.scrollToolConfirm(-1)
+	case tcell.KeyDown:
+		e.scrollToolConfirm(1)
+	case tcell.KeyPgUp:
+		e.scrollToolConfirm(-e.toolArgumentsHeight())
+	case tcell.KeyPgDn:
+		e.scrollToolConfirm(e.toolArgumentsHeight())
+	case tcell.KeyRune:
+		switch ev.Rune() {
+		case 'k':
+			e.scrollToolConfirm(-1)
+		case 'j':
+			e.scrollToolConfirm(1)
+		case 'y', 'Y':
+			if !e.toolConfirmSeen {
+				e.status = "Scroll to the end of the arguments before allowing the call"
+				break
+			}
+			e.answerToolConfirm(true)
+		case 'n', 'N':
+			e.answerToolConfirm(false)
+		}
+	}
+	e.draw()
+	return false
+}
+
+func (e *Editor) scrollToolConfirm(dy int) {
+	e.toolConfirmScroll += dy
+	if last := len(e.toolArgumentLines()) - e.toolArgumentsHeight(); e.toolConfirmScroll > last {
+		e.toolConfirmScroll = last
+	}
+	if e.toolConfirmScroll < 0 {
+		e.toolConfirmScroll = 0
+	}
+	e.noteToolArgumentsSeen()
+	e.status = e.toolConfirmStatus()
+}
+
+// resetToolConfirmView shows the first queued call from the top
+func (e *Editor) resetToolConfirmView() {
+	e.toolConfirmScroll = 0
+	e.toolConfirmSeen = false
+	e.noteToolArgumentsSeen()
+}
+
+// noteToolArgumentsSeen records when the end of the arguments is on screen.
+// Scrolling moves at most a screen at a time, so every line before it has
+// been shown on the way.
+func (e *Editor) noteToolArgumentsSeen() {
+	if e.toolConfirmScroll+e.toolArgumentsHeight() >= len(e.toolArgumentLines()) {
+		e.toolConfirmSeen = true
+	}
+}
+
+// toolArgumentsHeight is how many lines of arguments fit below the header of
+// the confirm view
+func (e *Editor) toolArgumentsHeight() int {
+	_, height := e.screen.Size()
+	if h := height - StatusBarHeight - 2; h > 0 {
+		return h
+	}
+	return 1
+}
+
+// toolArgumentLines wraps the first queued call's arguments to the screen
+func (e *Editor) toolArgumentLines() []string {
+	width, _ := e.screen.Size()
+	if width < 1 {
+		width = 1
+	}
+	return wrapText(showArguments(e.toolConfirms[0].call.Arguments), width)
+}
+
+// showArguments indents JSON arguments and spells out characters that would
+// not be visible on screen, so nothing in them can go unseen
+func showArguments(arguments string) string {
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, []byte(arguments), "", "  "); err == nil {
+		arguments = indented.String()
+	}
+
+	var b strings.Builder
+	for _, r := range arguments {
+		if r == '\n' || unicode.IsPrint(r) {
+			b.WriteRune(r)
+			continue
+		}
+		fmt.Fprintf(&b, "\\u%04x", r)
+	}
+	return b.String()
+}
+
+// drawToolConfirm shows the call waiting for an answer in place of the
+// editor content, with all of its arguments wrapped to the screen
+func (e *Editor) drawToolConfirm(width, height int) {
+	call := e.toolConfirms[0].call
+	e.drawCell(0, 0, width, fmt.Sprintf("Tool call: %s", call.Name), tcell.StyleDefault.Bold(true))
+
+	lines := e.toolArgumentLines()
+	position := fmt.Sprintf("Arguments, lines %d-%d of %d", e.toolConfirmScroll+1, min(e.toolConfirmScroll+e.toolArgumentsHeight(), len(lines)), len(lines))
+	e.drawCell(0, 1, width, position, tcell.StyleDefault.Dim(true))
+
+	for y := 2; y < height; y++ {
+		line := ""
+		if n := y - 2 + e.toolConfirmScroll; n < len(lines) {
+			line = lines[n]
+		}
+		e.drawCell(0, y, width, line, tcell.StyleDefault)
+	}
+	e.screen.HideCursor()
+}
+
+func (e *Editor) answerToolConfirm(ok bool) {
+	ev := e.toolConfirms[0]
+	e.logger.Printf("Tool call %s allowed: %v", ev.call.Name, ok)
+	ev.reply <- ok
+	e.toolConfirms = e.toolConfirms[1:]
+
+	if len(e.toolConfirms) > 0 {
+		e.resetToolConfirmView()
+		e.status = e.toolConfirmStatus()
+		return
+	}
+	e.mode = e.modeBeforeConfirm
+	if ok {
+		e.status = fmt.Sprintf("Running %s... (Esc to cancel)", ev.call.Name)
+	} else {
+		e.status = "Tool call denied, waiting for the response... (Esc to cancel)"
+	}
+}
+
+// endToolConfirms drops the questions of a query that has finished, which
+// only happens when it was cancelled while they were open
+func (e *Editor) endToolConfirms() {
+	if len(e.toolConfirms) == 0 && e.mode != ToolConfirmMode {
+		return
+	}
+	e.toolConfirms = nil
+	e.mode = e.modeBeforeConfirm
+}
@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/Utility-Gods/gottem/internal/db"
+	"github.com/Utility-Gods/gottem/pkg/types"
+)
+
+// recordUsage saves the tokens, latency and cost of a finished request and
+// adds them to the chat's running totals. Failed requests are recorded only
+// if the provider reported usage before failing.
+func (e *Editor) recordUsage(response types.Response, err error) {
+	// Cached answers cost nothing, so they are not counted as requests
+	if response.Cached || (err != nil && response.Usage == (types.Usage{})) {
+		return
+	}
+
+	record, err := db.RecordUsage(db.UsageRecord{
+		ChatID:       e.chat.ID,
+		Provider:     response.Provider,
+		Model:        response.Model,
+		InputTokens:  response.Usage.InputTokens,
+		OutputTokens: response.Usage.OutputTokens,
+		Latency:      response.Latency,
+	})
+	if err != nil {
+		e.logger.Printf("Error recording usage: %v", err)
+		return
+	}
+
+	e.usage.Requests++
+	e.usage.InputTokens += record.InputTokens
+	e.usage.OutputTokens += record.OutputTokens
+	e.usage.Cost += record.Cost
+	e.logger.Printf("Usage: %s %s, %d in, %d out, %s, $%.4f", record.Provider, record.Model,
+		record.InputTokens, record.OutputTokens, record.Latency, record.Cost)
+}
+
+// usageSummary describes the chat's running totals for the status bar
+func (e *Editor) usageSummary() string {
+	return fmt.Sprintf("Tokens: %d in / %d out | Cost: $%.4f", e.usage.InputTokens, e.usage.OutputTokens, e.usage.Cost)
+}
@@ -0,0 +1,176 @@
+// Package config reads API keys and settings from the environment and from
+// the optional config file, for machines where the interactive Settings menu
+// cannot be used. Values found here take precedence over those saved in the
+// database.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/BurntSushi/toml"
+)
+
+// File is the config file. Settings use the same names as the settings
+// table, e.g. cache.ttl, and may be nested:
+//
+//	[keys]
+//	claude = "sk-ant-..."
+//
+//	[settings]
+//	cache.ttl = "2h"
+//	retry.max_attempts = 5
+type File struct {
+	Keys     map[string]string      `toml:"keys" json:"keys"`
+	Settings map[string]interface{} `toml:"settings" json:"settings"`
+}
+
+var (
+	loadOnce sync.Once
+	loaded   File
+	settings map[string]string
+	loadErr  error
+)
+
+// Path returns where the config file is read from:
+// $XDG_CONFIG_HOME/gottem/config, or ~/.config/gottem/config
+func Path() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "gottem", "config")
+}
+
+// Load reads the config file the first time it is called. A missing file is
+// not an error. The file is TOML, or JSON if it starts with "{".
+func Load() error {
+	loadOnce.Do(func() {
+		loaded, settings, loadErr = readFile(Path())
+	})
+	return loadErr
+}
+
+func readFile(path string) (File, map[string]string, error) {
+	var file File
+	if path == "" {
+		return file, nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return file, nil, nil
+	}
+	if err != nil {
+		return file, nil, fmt.Errorf("error reading config file: %w", err)
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		err = json.Unmarshal(data, &file)
+	} else {
+		err = toml.Unmarshal(data, &file)
+	}
+	if err != nil {
+		return File{}, nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+
+	flat := make(map[string]string)
+	flatten("", file.Settings, flat)
+	return file, flat, nil
+}
+
+// flatten joins nested setting names with dots, so [settings.cache] ttl and
+// cache.ttl mean the same
+func flatten(prefix string, values map[string]interface{}, out map[string]string) {
+	for name, value := range values {
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		if nested, ok := value.(map[string]interface{}); ok {
+			flatten(name, nested, out)
+			continue
+		}
+		out[name] = fmt.Sprint(value)
+	}
+}
+
+// FileKey returns the API key the config file gives for name
+func FileKey(name string) (string, bool) {
+	if Load() != nil {
+		return "", false
+	}
+	key, ok := loaded.Keys[name]
+	return key, ok && key != ""
+}
+
+// FileKeyNames lists the APIs the config file has keys for
+func FileKeyNames() []string {
+	if Load() != nil {
+		return nil
+	}
+	names := make([]string, 0, len(loaded.Keys))
+	for name := range loaded.Keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Setting returns the value the config file gives for a setting
+func Setting(key string) (string, bool) {
+	if Load() != nil {
+		return "", false
+	}
+	value, ok := settings[key]
+	return value, ok
+}
+
+// Settings returns every setting in the config file
+func Settings() map[string]string {
+	if Load() != nil {
+		return nil
+	}
+	return settings
+}
+
+// KeyVariables lists the environment variables that can hold the API key
+// for name, in order of precedence: GOTTEM_<NAME>_API_KEY, then the
+// provider's own variable if it has one, e.g. OPENAI_API_KEY
+func KeyVariables(name, providerVariable string) []string {
+	variables := []string{"GOTTEM_" + envName(name) + "_API_KEY"}
+	if providerVariable != "" {
+		variables = append(variables, providerVariable)
+	}
+	return variables
+}
+
+// EnvKey returns the first of the variables that is set, and its name
+func EnvKey(variables []string) (string, string, bool) {
+	for _, variable := range variables {
+		if value := os.Getenv(variable); value != "" {
+			return value, variable, true
+		}
+	}
+	return "", "", false
+}
+
+// envName turns an API name into the form used in variable names, e.g.
+// "My Proxy" becomes MY_PROXY
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, name)
+}
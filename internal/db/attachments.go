@@ -0,0 +1,153 @@
+package db
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/Utility-Gods/gottem/pkg/types"
+)
+
+// AttachmentRef is a file a message sent: the name it was referenced by and
+// the hash its stored copy is kept under
+type AttachmentRef struct {
+	Name string `json:"name"`
+	Hash string `json:"hash"`
+}
+
+// SaveAttachment stores a copy of a file for a chat and returns the hash it
+// is kept under. A copy with the same content is only stored once.
+func SaveAttachment(chatID int, attachment types.Attachment) (string, error) {
+	hash := attachmentHash(attachment.Data)
+	query := `INSERT OR IGNORE INTO attachment_files (chat_id, hash, mime_type, data) VALUES (?, ?, ?, ?);`
+	if _, err := db.Exec(query, chatID, hash, attachment.MIMEType, attachment.Data); err != nil {
+		return "", fmt.Errorf("failed to save attachment %s: %w", attachment.Name, err)
+	}
+	return hash, nil
+}
+
+// GetAttachment returns the stored copy a message sent, or a zero attachment
+// if it is missing
+func GetAttachment(chatID int, ref AttachmentRef) (types.Attachment, error) {
+	query := `SELECT mime_type, data FROM attachment_files WHERE chat_id = ? AND hash = ?;`
+	attachment := types.Attachment{Name: ref.Name}
+	err := db.QueryRow(query, chatID, ref.Hash).Scan(&attachment.MIMEType, &attachment.Data)
+	if err == sql.ErrNoRows {
+		return types.Attachment{}, nil
+	}
+	if err != nil {
+		return types.Attachment{}, fmt.Errorf("failed to get attachment %s: %w", ref.Name, err)
+	}
+	return attachment, nil
+}
+
+func attachmentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// legacyAttachmentToken is a frozen copy of the @ token rules at schema
+// version 17, see moveAttachments
+var legacyAttachmentToken = regexp.MustCompile(`(?:^|\s)@(?:"([^"]+)"|(\S+))`)
+
+// moveAttachments moves the copies kept per chat and file name before
+// schema version 17 into attachment_files, and records them against every
+// user message that references them, which is what those messages sent.
+func moveAttachments(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT chat_id, name, mime_type, data FROM attachments;`)
+	if err != nil {
+		return fmt.Errorf("failed to query attachments: %w", err)
+	}
+	type file struct {
+		chatID         int
+		hash, mimeType string
+		data           []byte
+	}
+	var files []file
+	hashes := make(map[int]map[string]string)
+	for rows.Next() {
+		var chatID int
+		var name, mimeType string
+		var data []byte
+		if err := rows.Scan(&chatID, &name, &mimeType, &data); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		hash := attachmentHash(data)
+		if hashes[chatID] == nil {
+			hashes[chatID] = make(map[string]string)
+		}
+		hashes[chatID][name] = hash
+		files = append(files, file{chatID, hash, mimeType, data})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read attachments: %w", err)
+	}
+
+	for _, f := range files {
+		_, err := tx.Exec(`INSERT OR IGNORE INTO attachment_files (chat_id, hash, mime_type, data) VALUES (?, ?, ?, ?);`,
+			f.chatID, f.hash, f.mimeType, f.data)
+		if err != nil {
+			return fmt.Errorf("failed to move attachment: %w", err)
+		}
+	}
+
+	type reference struct {
+		id   int
+		refs []AttachmentRef
+	}
+	var references []reference
+	rows, err = tx.Query(`SELECT id, chat_id, content FROM messages WHERE role = ?;`, types.RoleUser)
+	if err != nil {
+		return fmt.Errorf("failed to query messages: %w", err)
+	}
+	for rows.Next() {
+		var id, chatID int
+		var content string
+		if err := rows.Scan(&id, &chatID, &content); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan message: %w", err)
+		}
+		var refs []AttachmentRef
+		for _, match := range legacyAttachmentToken.FindAllStringSubmatch(content, -1) {
+			name := match[1]
+			if name == "" {
+				name = strings.TrimRight(match[2], ".,;:!?)")
+			}
+			if hash, ok := hashes[chatID][name]; ok {
+				refs = append(refs, AttachmentRef{Name: name, Hash: hash})
+			}
+		}
+		if len(refs) > 0 {
+			references = append(references, reference{id, refs})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read messages: %w", err)
+	}
+
+	for _, r := range references {
+		data, err := json.Marshal(r.refs)
+		if err != nil {
+			return fmt.Errorf("failed to encode attachments: %w", err)
+		}
+		if _, err := tx.Exec(`UPDATE messages SET attachments = ? WHERE id = ?;`, string(data), r.id); err != nil {
+			return fmt.Errorf("failed to record attachments of message %d: %w", r.id, err)
+		}
+	}
+
+	if _, err := tx.Exec(`DROP TABLE attachments;`); err != nil {
+		return fmt.Errorf("failed to drop the attachments table: %w", err)
+	}
+	if len(files) > 0 {
+		log.Printf("Moved %d attachments to attachment_files", len(files))
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package db
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/Utility-Gods/gottem/pkg/types"
+)
+
+func TestMoveAttachmentsMigration(t *testing.T) {
+	migrateTestDB(t, 16)
+
+	for _, title := range []string{"first", "second"} {
+		if _, err := db.Exec(`INSERT INTO chats (title) VALUES (?);`, title); err != nil {
+			t.Fatalf("inserting chat: %v", err)
+		}
+	}
+	files := []struct {
+		chatID int
+		name   string
+		data   string
+	}{
+		{1, "notes.txt", "notes"},
+		{1, "my file.md", "spaces"},
+		{2, "notes.txt", "other notes"},
+	}
+	for _, f := range files {
+		_, err := db.Exec(`INSERT INTO attachments (chat_id, name, mime_type, data) VALUES (?, ?, 'text/plain', ?);`,
+			f.chatID, f.name, []byte(f.data))
+		if err != nil {
+			t.Fatalf("inserting attachment: %v", err)
+		}
+	}
+
+	messages := []struct {
+		chatID  int
+		role    types.Role
+		content string
+		want    []AttachmentRef
+	}{
+		{1, types.RoleUser, "see @notes.txt, and @\"my file.md\"", []AttachmentRef{
+			{Name: "notes.txt", Hash: attachmentHash([]byte("notes"))},
+			{Name: "my file.md", Hash: attachmentHash([]byte("spaces"))},
+		}},
+		{1, types.RoleUser, "mail me@notes.txt and @missing.txt", nil},
+		{1, types.RoleAssistant, "I read @notes.txt", nil},
+		{2, types.RoleUser, "@notes.txt", []AttachmentRef{
+			{Name: "notes.txt", Hash: attachmentHash([]byte("other notes"))},
+		}},
+	}
+	for _, m := range messages {
+		_, err := db.Exec(`INSERT INTO messages (chat_id, role, content) VALUES (?, ?, ?);`, m.chatID, m.role, m.content)
+		if err != nil {
+			t.Fatalf("inserting message: %v", err)
+		}
+	}
+
+	if err := MigrateTo(17); err != nil {
+		t.Fatalf("migrating to 17: %v", err)
+	}
+
+	rows, err := db.Query(`SELECT attachments FROM messages ORDER BY id;`)
+	if err != nil {
+		t.Fatalf("querying messages: %v", err)
+	}
+	defer rows.Close()
+	for i := 0; rows.Next(); i++ {
+		var encoded string
+		if err := rows.Scan(&encoded); err != nil {
+			t.Fatalf("scanning message: %v", err)
+		}
+		var got []AttachmentRef
+		if encoded != "" {
+			if err := json.Unmarshal([]byte(encoded), &got); err != nil {
+				t.Fatalf("decoding attachments %q: %v", encoded, err)
+			}
+		}
+		if !reflect.DeepEqual(got, messages[i].want) {
+			t.Errorf("message %q sent %+v, want %+v", messages[i].content, got, messages[i].want)
+		}
+	}
+
+	for _, f := range files {
+		got, err := GetAttachment(f.chatID, AttachmentRef{Name: f.name, Hash: attachmentHash([]byte(f.data))})
+		if err != nil {
+			t.Fatalf("GetAttachment: %v", err)
+		}
+		if string(got.Data) != f.data || got.MIMEType != "text/plain" {
+			t.Errorf("stored copy of %s in chat %d is %+v", f.name, f.chatID, got)
+		}
+	}
+}
+
+func TestSaveAttachmentStoresContentOnce(t *testing.T) {
+	latest, err := LatestSchemaVersion()
+	if err != nil {
+		t.Fatalf("LatestSchemaVersion: %v", err)
+	}
+	migrateTestDB(t, latest)
+	chatID, err := CreateChat("chat")
+	if err != nil {
+		t.Fatalf("CreateChat: %v", err)
+	}
+
+	attachment := types.Attachment{Name: "a.txt", MIMEType: "text/plain", Data: []byte("same")}
+	first, err := SaveAttachment(chatID, attachment)
+	if err != nil {
+		t.Fatalf("SaveAttachment: %v", err)
+	}
+	attachment.Name = "b.txt"
+	second, err := SaveAttachment(chatID, attachment)
+	if err != nil {
+		t.Fatalf("SaveAttachment: %v", err)
+	}
+	if first != second {
+		t.Errorf("the same content was stored under %s and %s", first, second)
+	}
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM attachment_files;`).Scan(&count); err != nil {
+		t.Fatalf("counting attachments: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("stored %d copies, want 1", count)
+	}
+
+	missing, err := GetAttachment(chatID, AttachmentRef{Name: "gone.txt", Hash: "unknown"})
+	if err != nil || missing.Data != nil {
+		t.Errorf("GetAttachment of a missing copy = %+v, %v", missing, err)
+	}
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// CachedResponse is a stored answer to a request
+type CachedResponse struct {
+	Key       string
+	Provider  string // The API that answered
+	Model     string
+	Text      string
+	CreatedAt time.Time
+}
+
+// CacheStats describes the response cache
+type CacheStats struct {
+	Entries int
+	Expired int   // Entries older than the TTL
+	Hits    int   // Times a cached response was reused
+	Bytes   int64 // Size of the cached response text
+}
+
+// GetCachedResponse returns the response stored under key if it is younger
+// than ttl, counting the hit, or a zero response if there is none
+func GetCachedResponse(key string, ttl time.Duration) (CachedResponse, error) {
+	query := `SELECT key, provider, model, response, created_at FROM response_cache
+		WHERE key = ? AND created_at > datetime('now', ?);`
+	var cached CachedResponse
+	err := db.QueryRow(query, key, ttlModifier(ttl)).Scan(&cached.Key, &cached.Provider, &cached.Model, &cached.Text, &cached.CreatedAt)
+	if err == sql.ErrNoRows {
+		return CachedResponse{}, nil
+	}
+	if err != nil {
+		return CachedResponse{}, fmt.Errorf("failed to get cached response: %w", err)
+	}
+
+	if _, err := db.Exec(`UPDATE response_cache SET hits = hits + 1 WHERE key = ?;`, key); err != nil {
+		return CachedResponse{}, fmt.Errorf("failed to count cache hit: %w", err)
+	}
+	return cached, nil
+}
+
+// SaveCachedResponse stores a response, replacing any stored under the same
+// key
+func SaveCachedResponse(cached CachedResponse) error {
+	query := `INSERT OR REPLACE INTO response_cache (key, provider, model, response) VALUES (?, ?, ?, ?);`
+	_, err := db.Exec(query, cached.Key, cached.Provider, cached.Model, cached.Text)
+	if err != nil {
+		return fmt.Errorf("failed to cache response: %w", err)
+	}
+	return nil
+}
+
+// GetCacheStats counts the cached responses, treating those older than ttl
+// as expired
+func GetCacheStats(ttl time.Duration) (CacheStats, error) {
+	query := `SELECT COUNT(*),
+		COALESCE(SUM(created_at <= datetime('now', ?)), 0),
+		COALESCE(SUM(hits), 0),
+		COALESCE(SUM(LENGTH(CAST(response AS BLOB))), 0)
+		FROM response_cache;`
+	var stats CacheStats
+	err := db.QueryRow(query, ttlModifier(ttl)).Scan(&stats.Entries, &stats.Expired, &stats.Hits, &stats.Bytes)
+	if err != nil {
+		return CacheStats{}, fmt.Errorf("failed to get cache stats: %w", err)
+	}
+	return stats, nil
+}
+
+// PurgeCache deletes the entries older than ttl, or every entry when ttl is
+// zero, and returns how many were deleted
+func PurgeCache(ttl time.Duration) (int64, error) {
+	result, err := db.Exec(`DELETE FROM response_cache WHERE ? = 0 OR created_at <= datetime('now', ?);`, int64(ttl), ttlModifier(ttl))
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge cache: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// ttlModifier turns a TTL into an SQLite datetime modifier
+func ttlModifier(ttl time.Duration) string {
+	return fmt.Sprintf("-%d seconds", int64(ttl.Seconds()))
+}
@@ -2,14 +2,16 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/Utility-Gods/gottem/internal/config"
+	"github.com/Utility-Gods/gottem/pkg/types"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -18,28 +20,15 @@ var db *sql.DB
 type Chat struct {
 	ID        int
 	Title     string
-	Context   string
+	Provider  string
+	Model     string
+	Summary   types.Summary
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
 
-func createTables() error {
-	schemaPath := filepath.Join("internal", "db", "schema.sql")
-	schemaContent, err := os.ReadFile(schemaPath)
-	if err != nil {
-		return fmt.Errorf("error reading schema file: %w", err)
-	}
-
-	_, err = db.Exec(string(schemaContent))
-	if err != nil {
-		return fmt.Errorf("error executing schema: %w", err)
-	}
-
-	log.Println("Database schema created successfully")
-	return nil
-}
-
-func InitDB() error {
+// Open opens the database in ~/.config/gottem without applying migrations
+func Open() error {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return fmt.Errorf("error getting home directory: %w", err)
@@ -54,142 +43,291 @@ func InitDB() error {
 	if err != nil {
 		return fmt.Errorf("error opening database: %w", err)
 	}
-
-	if err := createTables(); err != nil {
-		return fmt.Errorf("error creating tables: %w", err)
-	}
-
-	if err := checkAndUpdateSchema(); err != nil {
-		return fmt.Errorf("error checking and updating schema: %w", err)
-	}
-
-	log.Println("Database initialized successfully")
 	return nil
 }
 
-func checkAndUpdateSchema() error {
-	var currentVersion int
-	err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&currentVersion)
-	if err != nil {
-		return fmt.Errorf("error checking schema version: %w", err)
+// InitDB opens the database and brings its schema up to date
+func InitDB() error {
+	if err := Open(); err != nil {
+		return err
 	}
 
-	// Define your schema versions
-	schemaVersions := []struct {
-		version int
-		schema  string
-	}{
-		{1, "internal/db/schema.sql"},
-		// Add more versions as your schema evolves
+	if err := MigrateDatabase(); err != nil {
+		return fmt.Errorf("error migrating database: %w", err)
 	}
-
-	// Apply any new schema versions
-	for _, sv := range schemaVersions {
-		if sv.version > currentVersion {
-			schemaContent, err := os.ReadFile(sv.schema)
-			if err != nil {
-				return fmt.Errorf("error reading schema file %s: %w", sv.schema, err)
-			}
-
-			_, err = db.Exec(string(schemaContent))
-			if err != nil {
-				return fmt.Errorf("error applying schema version %d: %w", sv.version, err)
-			}
-
-			_, err = db.Exec("INSERT INTO schema_version (version) VALUES (?)", sv.version)
-			if err != nil {
-				return fmt.Errorf("error updating schema version: %w", err)
-			}
-
-			log.Printf("Applied schema version %d\n", sv.version)
-		}
+	if err := EnsureSearchIndex(); err != nil {
+		return fmt.Errorf("error preparing chat search: %w", err)
 	}
 
+	log.Println("Database initialized successfully")
 	return nil
 }
 
+// SetAPIKey encrypts and saves the key for an API. The keys must be
+// unlocked, see Unlock.
 func SetAPIKey(apiName, apiKey string) error {
-	query := `INSERT OR REPLACE INTO api_keys (api_name, api_key) VALUES (?, ?);`
-	_, err := db.Exec(query, apiName, apiKey)
+	sealed, err := sealAPIKey(apiName, apiKey)
 	if err != nil {
-		log.Printf("Error setting API key for %s: %v", apiName, err)
 		return err
 	}
-	log.Printf("API key for %s set successfully", apiName)
+	query := `INSERT OR REPLACE INTO api_keys (api_name, api_key) VALUES (?, ?);`
+	_, err = db.Exec(query, apiName, sealed)
+	if err != nil {
+		return fmt.Errorf("failed to save API key for %s: %w", apiName, err)
+	}
 	return nil
 }
 
+// GetAPIKey returns the decrypted key for an API, or "" if none is saved
 func GetAPIKey(apiName string) (string, error) {
-	var apiKey string
+	var stored string
 	query := `SELECT api_key FROM api_keys WHERE api_name = ?;`
-	err := db.QueryRow(query, apiName).Scan(&apiKey)
+	err := db.QueryRow(query, apiName).Scan(&stored)
 	if err == sql.ErrNoRows {
-		log.Printf("No API key found for %s", apiName)
 		return "", nil
 	}
 	if err != nil {
-		log.Printf("Error getting API key for %s: %v", apiName, err)
-		return "", err
+		return "", fmt.Errorf("failed to get API key for %s: %w", apiName, err)
 	}
-	log.Printf("API key for %s retrieved successfully", apiName)
-	return apiKey, nil
+	return openAPIKey(apiName, stored)
 }
 
 func GetAllAPIKeys() ([]struct {
 	APIName string
 	APIKey  string
 }, error) {
-	query := `SELECT api_name, api_key FROM api_keys;`
-	rows, err := db.Query(query)
+	names, err := GetAPIKeyNames()
 	if err != nil {
-		log.Printf("Error querying API keys: %v", err)
 		return nil, err
 	}
-	defer rows.Close()
 
 	var apiKeys []struct {
 		APIName string
 		APIKey  string
 	}
-
-	for rows.Next() {
-		var apiName, apiKey string
-		if err := rows.Scan(&apiName, &apiKey); err != nil {
-			log.Printf("Error scanning row: %v", err)
+	for _, name := range names {
+		apiKey, err := GetAPIKey(name)
+		if err != nil {
 			return nil, err
 		}
 		apiKeys = append(apiKeys, struct {
 			APIName string
 			APIKey  string
-		}{APIName: apiName, APIKey: apiKey})
+		}{APIName: name, APIKey: apiKey})
 	}
+	return apiKeys, nil
+}
 
-	if err := rows.Err(); err != nil {
-		log.Printf("Error after scanning rows: %v", err)
-		return nil, err
+// GetAPIKeyNames lists the APIs that have a key saved. Unlike the keys
+// themselves the names are available while the keys are locked.
+func GetAPIKeyNames() ([]string, error) {
+	rows, err := db.Query(`SELECT api_name FROM api_keys ORDER BY api_name;`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query API keys: %w", err)
 	}
+	defer rows.Close()
 
-	return apiKeys, nil
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan API key: %w", err)
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
 }
 
 func DeleteAPIKey(apiName string) error {
 	query := `DELETE FROM api_keys WHERE api_name = ?;`
 	_, err := db.Exec(query, apiName)
 	if err != nil {
-		log.Printf("Error deleting API key for %s: %v", apiName, err)
-		return err
+		return fmt.Errorf("failed to delete API key for %s: %w", apiName, err)
+	}
+	return nil
+}
+
+// CompatibleProvider is a user-defined OpenAI-compatible endpoint
+type CompatibleProvider struct {
+	Name         string
+	Shortcut     string
+	BaseURL      string
+	AuthHeader   string
+	AuthScheme   string
+	DefaultModel string
+	Headers      map[string]string
+}
+
+func SaveCompatibleProvider(p CompatibleProvider) error {
+	headers, err := json.Marshal(p.Headers)
+	if err != nil {
+		return fmt.Errorf("failed to encode headers: %w", err)
+	}
+
+	query := `INSERT OR REPLACE INTO compatible_providers
+		(name, shortcut, base_url, auth_header, auth_scheme, default_model, extra_headers)
+		VALUES (?, ?, ?, ?, ?, ?, ?);`
+	_, err = db.Exec(query, p.Name, p.Shortcut, p.BaseURL, p.AuthHeader, p.AuthScheme, p.DefaultModel, string(headers))
+	if err != nil {
+		return fmt.Errorf("failed to save provider %s: %w", p.Name, err)
+	}
+	return nil
+}
+
+func GetCompatibleProviders() ([]CompatibleProvider, error) {
+	query := `SELECT name, shortcut, base_url, auth_header, auth_scheme, default_model, extra_headers
+		FROM compatible_providers ORDER BY name;`
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query providers: %w", err)
+	}
+	defer rows.Close()
+
+	var providers []CompatibleProvider
+	for rows.Next() {
+		var p CompatibleProvider
+		var headers string
+		if err := rows.Scan(&p.Name, &p.Shortcut, &p.BaseURL, &p.AuthHeader, &p.AuthScheme, &p.DefaultModel, &headers); err != nil {
+			return nil, fmt.Errorf("failed to scan provider: %w", err)
+		}
+		if err := json.Unmarshal([]byte(headers), &p.Headers); err != nil {
+			return nil, fmt.Errorf("failed to decode headers for %s: %w", p.Name, err)
+		}
+		providers = append(providers, p)
+	}
+
+	return providers, rows.Err()
+}
+
+func DeleteCompatibleProvider(name string) error {
+	query := `DELETE FROM compatible_providers WHERE name = ?;`
+	_, err := db.Exec(query, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete provider %s: %w", name, err)
+	}
+	return nil
+}
+
+// GetSetting returns the value of a setting, or "" if it has not been set.
+// The config file takes precedence over the value saved in the database.
+func GetSetting(key string) (string, error) {
+	if value, ok := config.Setting(key); ok {
+		return value, nil
+	}
+	return GetStoredSetting(key)
+}
+
+// GetStoredSetting returns the value saved in the database for key, ignoring
+// the config file
+func GetStoredSetting(key string) (string, error) {
+	var value string
+	query := `SELECT value FROM settings WHERE key = ?;`
+	err := db.QueryRow(query, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get setting %s: %w", key, err)
+	}
+	return value, nil
+}
+
+func SetSetting(key, value string) error {
+	query := `INSERT OR REPLACE INTO settings (key, value) VALUES (?, ?);`
+	_, err := db.Exec(query, key, value)
+	if err != nil {
+		return fmt.Errorf("failed to save setting %s: %w", key, err)
+	}
+	return nil
+}
+
+func DeleteSetting(key string) error {
+	query := `DELETE FROM settings WHERE key = ?;`
+	_, err := db.Exec(query, key)
+	if err != nil {
+		return fmt.Errorf("failed to delete setting %s: %w", key, err)
+	}
+	return nil
+}
+
+// GetStoredSettings returns every setting saved in the database by key,
+// leaving out the values that belong to the passphrase
+func GetStoredSettings() (map[string]string, error) {
+	rows, err := db.Query(`SELECT key, value FROM settings WHERE key NOT IN (?, ?);`, keySaltSetting, keyCheckSetting)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query settings: %w", err)
+	}
+	defer rows.Close()
+
+	settings := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan setting: %w", err)
+		}
+		settings[key] = value
+	}
+	return settings, rows.Err()
+}
+
+// FallbackChain is an ordered list of API shortcuts tried in turn
+type FallbackChain struct {
+	Name     string
+	Shortcut string
+	Members  []string
+}
+
+func SaveFallbackChain(chain FallbackChain) error {
+	query := `INSERT OR REPLACE INTO fallback_chains (name, shortcut, members) VALUES (?, ?, ?);`
+	_, err := db.Exec(query, chain.Name, chain.Shortcut, strings.Join(chain.Members, ","))
+	if err != nil {
+		return fmt.Errorf("failed to save fallback chain %s: %w", chain.Name, err)
+	}
+	return nil
+}
+
+func GetFallbackChains() ([]FallbackChain, error) {
+	query := `SELECT name, shortcut, members FROM fallback_chains ORDER BY name;`
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query fallback chains: %w", err)
+	}
+	defer rows.Close()
+
+	var chains []FallbackChain
+	for rows.Next() {
+		var chain FallbackChain
+		var members string
+		if err := rows.Scan(&chain.Name, &chain.Shortcut, &members); err != nil {
+			return nil, fmt.Errorf("failed to scan fallback chain: %w", err)
+		}
+		chain.Members = strings.Split(members, ",")
+		chains = append(chains, chain)
+	}
+
+	return chains, rows.Err()
+}
+
+func DeleteFallbackChain(name string) error {
+	query := `DELETE FROM fallback_chains WHERE name = ?;`
+	_, err := db.Exec(query, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete fallback chain %s: %w", name, err)
 	}
-	log.Printf("API key for %s deleted successfully", apiName)
 	return nil
 }
 
 func GetChat(chatID int) (Chat, error) {
-	query := `SELECT id, title, context, created_at, updated_at FROM chats WHERE id = ?;`
+	query := `SELECT id, title, provider, model, summary, summary_messages, created_at, updated_at
+		FROM chats WHERE id = ?;`
 	var chat Chat
 	err := db.QueryRow(query, chatID).Scan(
 		&chat.ID,
 		&chat.Title,
-		&chat.Context,
+		&chat.Provider,
+		&chat.Model,
+		&chat.Summary.Text,
+		&chat.Summary.Messages,
 		&chat.CreatedAt,
 		&chat.UpdatedAt,
 	)
@@ -200,8 +338,8 @@ func GetChat(chatID int) (Chat, error) {
 }
 
 func CreateChat(title string) (int, error) {
-	query := `INSERT INTO chats (title, context) VALUES (?, ?);`
-	result, err := db.Exec(query, title, "")
+	query := `INSERT INTO chats (title) VALUES (?);`
+	result, err := db.Exec(query, title)
 	if err != nil {
 		return 0, fmt.Errorf("failed to create chat: %w", err)
 	}
@@ -212,16 +350,6 @@ func CreateChat(title string) (int, error) {
 	return int(id), nil
 }
 
-func AddMessage(chatID int, role, apiName, content string) error {
-	query := `INSERT INTO messages (chat_id, role, api_name, content) VALUES (?, ?, ?, ?);`
-	_, err := db.Exec(query, chatID, role, apiName, content)
-	if err != nil {
-		log.Printf("Error adding message: %v", err)
-		return err
-	}
-	return nil
-}
-
 func GetChats() ([]Chat, error) {
 	query := `SELECT id, title, created_at, updated_at FROM chats ORDER BY updated_at DESC;`
 	rows, err := db.Query(query)
@@ -255,8 +383,26 @@ func UpdateChatTitle(chatID int, newTitle string) error {
 }
 
 func DeleteChat(chatID int) error {
+	_, err := db.Exec(`DELETE FROM chat_params WHERE chat_id = ?;`, chatID)
+	if err != nil {
+		log.Printf("Error deleting chat params: %v", err)
+		return err
+	}
+
+	_, err = db.Exec(`DELETE FROM attachment_files WHERE chat_id = ?;`, chatID)
+	if err != nil {
+		log.Printf("Error deleting chat attachments: %v", err)
+		return err
+	}
+
+	_, err = db.Exec(`DELETE FROM messages WHERE chat_id = ?;`, chatID)
+	if err != nil {
+		log.Printf("Error deleting chat messages: %v", err)
+		return err
+	}
+
 	query := `DELETE FROM chats WHERE id = ?;`
-	_, err := db.Exec(query, chatID)
+	_, err = db.Exec(query, chatID)
 	if err != nil {
 		log.Printf("Error deleting chat: %v", err)
 		return err
@@ -274,11 +420,73 @@ func CloseDB() {
 	}
 }
 
-func UpdateChatContext(chatID int, context string) error {
-	query := `UPDATE chats SET context = ? WHERE id = ?;`
-	_, err := db.Exec(query, context, chatID)
+// UpdateChatModel records the provider shortcut and model a chat uses. An
+// empty model means the provider's default.
+func UpdateChatModel(chatID int, provider, model string) error {
+	query := `UPDATE chats SET provider = ?, model = ? WHERE id = ?;`
+	_, err := db.Exec(query, provider, model, chatID)
+	if err != nil {
+		return fmt.Errorf("failed to update chat model: %w", err)
+	}
+	return nil
+}
+
+// UpdateChatSummary saves the summary that stands in for the start of a long
+// chat
+func UpdateChatSummary(chatID int, summary types.Summary) error {
+	query := `UPDATE chats SET summary = ?, summary_messages = ? WHERE id = ?;`
+	_, err := db.Exec(query, summary.Text, summary.Messages, chatID)
 	if err != nil {
-		return fmt.Errorf("failed to update chat context: %w", err)
+		return fmt.Errorf("failed to update chat summary: %w", err)
+	}
+	return nil
+}
+
+// GetChatParams returns the generation parameters saved for a chat, or zero
+// parameters if none have been set
+func GetChatParams(chatID int) (types.Params, error) {
+	query := `SELECT max_tokens, temperature, top_p, stop, system_prompt, context_policy, cache, json_mode, continue_limit FROM chat_params WHERE chat_id = ?;`
+	var params types.Params
+	var temperature, topP sql.NullFloat64
+	var stop string
+	err := db.QueryRow(query, chatID).Scan(&params.MaxTokens, &temperature, &topP, &stop, &params.SystemPrompt, &params.ContextPolicy,
+		&params.Cache, &params.JSON, &params.Continue)
+	if err == sql.ErrNoRows {
+		return types.Params{}, nil
+	}
+	if err != nil {
+		return types.Params{}, fmt.Errorf("failed to get chat params: %w", err)
+	}
+
+	if temperature.Valid {
+		params.Temperature = &temperature.Float64
+	}
+	if topP.Valid {
+		params.TopP = &topP.Float64
+	}
+	if err := json.Unmarshal([]byte(stop), &params.Stop); err != nil {
+		return types.Params{}, fmt.Errorf("failed to decode stop sequences: %w", err)
+	}
+
+	return params, nil
+}
+
+// SetChatParams saves the generation parameters for a chat
+func SetChatParams(chatID int, params types.Params) error {
+	stop, err := json.Marshal(params.Stop)
+	if err != nil {
+		return fmt.Errorf("failed to encode stop sequences: %w", err)
+	}
+	if params.Stop == nil {
+		stop = []byte("[]")
+	}
+
+	query := `INSERT OR REPLACE INTO chat_params (chat_id, max_tokens, temperature, top_p, stop, system_prompt, context_policy, cache, json_mode, continue_limit)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
+	_, err = db.Exec(query, chatID, params.MaxTokens, params.Temperature, params.TopP, string(stop), params.SystemPrompt,
+		params.ContextPolicy, params.Cache, params.JSON, params.Continue)
+	if err != nil {
+		return fmt.Errorf("failed to save chat params: %w", err)
 	}
 	return nil
 }
@@ -294,7 +502,7 @@ func FlushDB() error {
 	defer tx.Rollback()
 
 	// List of tables to clear
-	tables := []string{"api_keys", "chats"}
+	tables := []string{"api_keys", "chats", "compatible_providers", "chat_params", "settings", "fallback_chains", "usage", "budgets", "attachment_files", "network_settings", "response_cache", "rate_limits", "messages"}
 
 	// Disable foreign key constraints temporarily
 	_, err = tx.Exec("PRAGMA foreign_keys = OFF;")
@@ -328,73 +536,9 @@ func FlushDB() error {
 		return fmt.Errorf("error committing transaction: %w", err)
 	}
 
-	log.Println("Database flushed successfully")
-	return nil
-}
-
-func MigrateDatabase() error {
-	// Check current schema version
-	var version int
-	err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
-	if err != nil && err != sql.ErrNoRows {
-		return fmt.Errorf("failed to check schema version: %w", err)
-	}
-
-	// If version is 0 or schema_version table doesn't exist, we assume it's a new database or very old version
-	if err == sql.ErrNoRows || version < 1 {
-		return migrateToVersion1()
-	}
-
-	// For future migrations, add more conditions here
-	// if version < 2 {
-	//     return migrateToVersion2()
-	// }
+	// The passphrase went with the settings table
+	Lock()
 
-	log.Println("Database schema is up to date")
-	return nil
-}
-
-func migrateToVersion1() error {
-	log.Println("Migrating database to version 1")
-
-	tx, err := db.Begin()
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
-	}
-	defer tx.Rollback()
-
-	// Read the schema.sql file
-	schemaPath := filepath.Join("internal", "db", "schema.sql") // Adjust this path as necessary
-	schemaSQL, err := ioutil.ReadFile(schemaPath)
-	if err != nil {
-		return fmt.Errorf("error reading schema file: %w", err)
-	}
-
-	// Split the schema into individual statements
-	statements := strings.Split(string(schemaSQL), ";")
-
-	// Execute each statement
-	for _, stmt := range statements {
-		stmt = strings.TrimSpace(stmt)
-		if stmt == "" {
-			continue
-		}
-		_, err = tx.Exec(stmt)
-		if err != nil {
-			return fmt.Errorf("error executing schema statement: %w", err)
-		}
-	}
-
-	// Ensure the schema version is set to 1
-	_, err = tx.Exec("INSERT OR REPLACE INTO schema_version (version) VALUES (1)")
-	if err != nil {
-		return fmt.Errorf("failed to update schema version: %w", err)
-	}
-
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
-	}
-
-	log.Println("Migration to version 1 completed successfully")
+	log.Println("Database flushed successfully")
 	return nil
 }
@@ -0,0 +1,449 @@
+package db
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// API keys are encrypted with AES-256-GCM under a key derived from the
+// user's passphrase with Argon2id. The salt and an encrypted check value
+// are kept in the settings table, so a wrong passphrase is caught before
+// anything is decrypted.
+
+var (
+	// ErrLocked is returned when API keys are needed before the passphrase
+	// has been entered, or after they locked again for being idle
+	ErrLocked = errors.New("API keys are locked, enter your passphrase to unlock them")
+	// ErrNoPassphrase is returned when a key is saved before a passphrase
+	// to encrypt it with has been chosen
+	ErrNoPassphrase = errors.New("no passphrase set, choose one under Settings → Key Encryption")
+	// ErrWrongPassphrase is returned when a passphrase does not unlock the
+	// keys
+	ErrWrongPassphrase = errors.New("wrong passphrase")
+)
+
+const (
+	keySaltSetting    = "keys.salt"
+	keyCheckSetting   = "keys.check"
+	keyTimeoutSetting = "keys.idle_timeout"
+
+	// encryptedPrefix marks an encrypted value and the scheme that made it
+	encryptedPrefix = "enc:v1:"
+	// keyCheckValue is encrypted with the derived key to recognise it again
+	keyCheckValue = "gottem"
+
+	argonTime    = 1
+	argonMemory  = 64 * 1024 // KiB
+	argonThreads = 4
+	saltLength   = 16
+)
+
+// keySession holds the derived key while the API keys are unlocked
+var keySession struct {
+	mu      sync.Mutex
+	key     []byte
+	timeout time.Duration // Zero keeps the keys unlocked until the app exits
+	timer   *time.Timer
+}
+
+// HasPassphrase reports whether a passphrase has been chosen
+func HasPassphrase() (bool, error) {
+	salt, err := GetStoredSetting(keySaltSetting)
+	if err != nil {
+		return false, err
+	}
+	return salt != "", nil
+}
+
+// Locked reports whether the API keys need the passphrase before they can
+// be read or saved
+func Locked() bool {
+	keySession.mu.Lock()
+	defer keySession.mu.Unlock()
+	return keySession.key == nil
+}
+
+// Unlock derives the encryption key from passphrase and keeps it for the
+// session. Keys still stored in plain text by older versions are encrypted
+// on the way.
+func Unlock(passphrase string) error {
+	salt, check, err := loadKeyParams()
+	if err != nil {
+		return err
+	}
+	if salt == nil {
+		return ErrNoPassphrase
+	}
+
+	key := deriveKey(passphrase, salt)
+	value, err := decrypt(key, check, keyCheckSetting)
+	if err != nil || subtle.ConstantTimeCompare([]byte(value), []byte(keyCheckValue)) != 1 {
+		return ErrWrongPassphrase
+	}
+
+	timeout, err := KeyIdleTimeout()
+	if err != nil {
+		return err
+	}
+	startKeySession(key, timeout)
+
+	return encryptPlainKeys(key)
+}
+
+// Lock forgets the derived key, so the passphrase is needed again
+func Lock() {
+	keySession.mu.Lock()
+	defer keySession.mu.Unlock()
+	lockLocked()
+}
+
+// lockLocked wipes the session key. keySession.mu must be held.
+func lockLocked() {
+	for i := range keySession.key {
+		keySession.key[i] = 0
+	}
+	keySession.key = nil
+	if keySession.timer != nil {
+		keySession.timer.Stop()
+		keySession.timer = nil
+	}
+}
+
+// ChangePassphrase encrypts every stored API key under a new passphrase,
+// replacing the current one. With no passphrase set yet it chooses the first
+// one and encrypts any keys stored in plain text. Otherwise the keys must be
+// unlocked.
+func ChangePassphrase(passphrase string) error {
+	if passphrase == "" {
+		return fmt.Errorf("the passphrase cannot be empty")
+	}
+
+	hasPassphrase, err := HasPassphrase()
+	if err != nil {
+		return err
+	}
+	var oldKey []byte
+	if hasPassphrase {
+		if oldKey, err = sessionKey(); err != nil {
+			return err
+		}
+	}
+
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("failed to generate salt: %w", err)
+	}
+	newKey := deriveKey(passphrase, salt)
+	check, err := encrypt(newKey, keyCheckValue, keyCheckSetting)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	keys, err := readAPIKeys(tx)
+	if err != nil {
+		return err
+	}
+	for name, stored := range keys {
+		apiKey := stored
+		if isEncrypted(stored) {
+			if oldKey == nil {
+				return fmt.Errorf("the key for %s is encrypted but no passphrase is set", name)
+			}
+			if apiKey, err = decrypt(oldKey, stored, name); err != nil {
+				return fmt.Errorf("failed to decrypt the key for %s: %w", name, err)
+			}
+		}
+		sealed, err := encrypt(newKey, apiKey, name)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE api_keys SET api_key = ? WHERE api_name = ?;`, sealed, name); err != nil {
+			return fmt.Errorf("failed to save the key for %s: %w", name, err)
+		}
+	}
+
+	for setting, value := range map[string]string{
+		keySaltSetting:  base64.StdEncoding.EncodeToString(salt),
+		keyCheckSetting: check,
+	} {
+		if _, err := tx.Exec(`INSERT OR REPLACE INTO settings (key, value) VALUES (?, ?);`, setting, value); err != nil {
+			return fmt.Errorf("failed to save setting %s: %w", setting, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	timeout, err := KeyIdleTimeout()
+	if err != nil {
+		return err
+	}
+	startKeySession(newKey, timeout)
+	return nil
+}
+
+// ResetPassphrase deletes every stored API key along with the passphrase,
+// for when the passphrase has been forgotten
+func ResetPassphrase() error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM api_keys;`); err != nil {
+		return fmt.Errorf("failed to delete API keys: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM settings WHERE key IN (?, ?);`, keySaltSetting, keyCheckSetting); err != nil {
+		return fmt.Errorf("failed to delete passphrase: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	Lock()
+	return nil
+}
+
+// KeyIdleTimeout returns how long the API keys stay unlocked without being
+// used. Zero means until the app exits.
+func KeyIdleTimeout() (time.Duration, error) {
+	value, err := GetSetting(keyTimeoutSetting)
+	if err != nil || value == "" {
+		return 0, err
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid key idle timeout %q: %w", value, err)
+	}
+	return timeout, nil
+}
+
+// SetKeyIdleTimeout saves how long the API keys stay unlocked without being
+// used, zero for no limit. It applies to the current session at once.
+func SetKeyIdleTimeout(timeout time.Duration) error {
+	if timeout < 0 {
+		return fmt.Errorf("the timeout cannot be negative")
+	}
+	if err := SetSetting(keyTimeoutSetting, timeout.String()); err != nil {
+		return err
+	}
+
+	keySession.mu.Lock()
+	defer keySession.mu.Unlock()
+	keySession.timeout = timeout
+	if keySession.key != nil {
+		resetIdleTimerLocked()
+	}
+	return nil
+}
+
+func startKeySession(key []byte, timeout time.Duration) {
+	keySession.mu.Lock()
+	defer keySession.mu.Unlock()
+	lockLocked()
+	keySession.key = key
+	keySession.timeout = timeout
+	resetIdleTimerLocked()
+}
+
+// sessionKey returns the derived key and restarts the idle timeout
+func sessionKey() ([]byte, error) {
+	keySession.mu.Lock()
+	defer keySession.mu.Unlock()
+	if keySession.key == nil {
+		return nil, ErrLocked
+	}
+	resetIdleTimerLocked()
+	// A copy, since locking wipes the key in place
+	return append([]byte(nil), keySession.key...), nil
+}
+
+// resetIdleTimerLocked restarts the idle timeout. keySession.mu must be
+// held.
+func resetIdleTimerLocked() {
+	if keySession.timer != nil {
+		keySession.timer.Stop()
+		keySession.timer = nil
+	}
+	if keySession.timeout > 0 {
+		keySession.timer = time.AfterFunc(keySession.timeout, Lock)
+	}
+}
+
+func loadKeyParams() (salt []byte, check string, err error) {
+	encoded, err := GetStoredSetting(keySaltSetting)
+	if err != nil || encoded == "" {
+		return nil, "", err
+	}
+	salt, err = base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid passphrase salt: %w", err)
+	}
+	check, err = GetStoredSetting(keyCheckSetting)
+	if err != nil {
+		return nil, "", err
+	}
+	return salt, check, nil
+}
+
+// encryptPlainKeys encrypts keys saved in plain text before passphrases
+// existed
+func encryptPlainKeys(key []byte) error {
+	keys, err := readAPIKeys(db)
+	if err != nil {
+		return err
+	}
+	for name, stored := range keys {
+		if isEncrypted(stored) {
+			continue
+		}
+		sealed, err := encrypt(key, stored, name)
+		if err != nil {
+			return err
+		}
+		if _, err := db.Exec(`UPDATE api_keys SET api_key = ? WHERE api_name = ?;`, sealed, name); err != nil {
+			return fmt.Errorf("failed to encrypt the key for %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// HasPlainKeys reports whether any API key is still stored in plain text
+func HasPlainKeys() (bool, error) {
+	keys, err := readAPIKeys(db)
+	if err != nil {
+		return false, err
+	}
+	for _, stored := range keys {
+		if !isEncrypted(stored) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// querier is satisfied by both the database and a transaction
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// readAPIKeys returns the stored API keys as they are in the table, by name
+func readAPIKeys(q querier) (map[string]string, error) {
+	rows, err := q.Query(`SELECT api_name, api_key FROM api_keys;`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query API keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := make(map[string]string)
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan API key: %w", err)
+		}
+		keys[name] = value
+	}
+	return keys, rows.Err()
+}
+
+// openAPIKey decrypts a stored API key. Keys from before encryption are
+// returned as they are.
+func openAPIKey(name, stored string) (string, error) {
+	if !isEncrypted(stored) {
+		return stored, nil
+	}
+	key, err := sessionKey()
+	if err != nil {
+		return "", err
+	}
+	apiKey, err := decrypt(key, stored, name)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt the key for %s: %w", name, err)
+	}
+	return apiKey, nil
+}
+
+// sealAPIKey encrypts an API key for storage
+func sealAPIKey(name, apiKey string) (string, error) {
+	hasPassphrase, err := HasPassphrase()
+	if err != nil {
+		return "", err
+	}
+	if !hasPassphrase {
+		return "", ErrNoPassphrase
+	}
+	key, err := sessionKey()
+	if err != nil {
+		return "", err
+	}
+	return encrypt(key, apiKey, name)
+}
+
+func deriveKey(passphrase string, salt []byte) []byte {
+	return argon2.IDKey([]byte(passphrase), salt, argonTime, argonMemory, argonThreads, 32)
+}
+
+func isEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// encrypt seals plaintext with AES-GCM. label is authenticated along with
+// it, so a value cannot be moved to another API's row.
+func encrypt(key []byte, plaintext, label string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), []byte(label))
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func decrypt(key []byte, value, label string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted value: %w", err)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", fmt.Errorf("invalid encrypted value")
+	}
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(label))
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted value")
+	}
+	return string(plaintext), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,169 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	sealed, err := encrypt(key, "sk-secret", "Claude API")
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if !isEncrypted(sealed) || strings.Contains(sealed, "sk-secret") {
+		t.Fatalf("encrypt returned %q", sealed)
+	}
+	again, err := encrypt(key, "sk-secret", "Claude API")
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if again == sealed {
+		t.Error("encrypting twice gave the same value, the nonce is not random")
+	}
+
+	tests := []struct {
+		name  string
+		key   []byte
+		value string
+		label string
+		ok    bool
+	}{
+		{"round trip", key, sealed, "Claude API", true},
+		{"wrong key", bytes.Repeat([]byte{2}, 32), sealed, "Claude API", false},
+		{"moved to another API", key, sealed, "OpenAI API", false},
+		{"tampered", key, sealed[:len(sealed)-4] + "AAAA", "Claude API", false},
+		{"truncated", key, encryptedPrefix + "AAAA", "Claude API", false},
+		{"not base64", key, encryptedPrefix + "!!!", "Claude API", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decrypt(tt.key, tt.value, tt.label)
+			if tt.ok {
+				if err != nil || got != "sk-secret" {
+					t.Errorf("decrypt = %q, %v, want sk-secret", got, err)
+				}
+			} else if err == nil {
+				t.Errorf("decrypt succeeded with %q", got)
+			}
+		})
+	}
+}
+
+// openKeyTestDB opens a migrated test database and locks the keys again
+// when the test ends, since the session is shared by the package
+func openKeyTestDB(t *testing.T) {
+	t.Helper()
+	latest, err := LatestSchemaVersion()
+	if err != nil {
+		t.Fatalf("LatestSchemaVersion: %v", err)
+	}
+	migrateTestDB(t, latest)
+	Lock()
+	t.Cleanup(Lock)
+}
+
+func TestPassphrase(t *testing.T) {
+	openKeyTestDB(t)
+
+	if err := SetAPIKey("Claude API", "sk-new"); !errors.Is(err, ErrNoPassphrase) {
+		t.Errorf("SetAPIKey without a passphrase = %v, want ErrNoPassphrase", err)
+	}
+
+	// A key saved in plain text by an older version
+	if _, err := db.Exec(`INSERT INTO api_keys (api_name, api_key) VALUES ('Claude API', 'sk-plain');`); err != nil {
+		t.Fatalf("inserting key: %v", err)
+	}
+	if err := ChangePassphrase("first"); err != nil {
+		t.Fatalf("ChangePassphrase: %v", err)
+	}
+	if plain, err := HasPlainKeys(); err != nil || plain {
+		t.Errorf("HasPlainKeys after choosing a passphrase = %v, %v", plain, err)
+	}
+	if got, err := GetAPIKey("Claude API"); err != nil || got != "sk-plain" {
+		t.Errorf("GetAPIKey = %q, %v, want sk-plain", got, err)
+	}
+
+	Lock()
+	if _, err := GetAPIKey("Claude API"); !errors.Is(err, ErrLocked) {
+		t.Errorf("GetAPIKey while locked = %v, want ErrLocked", err)
+	}
+	if err := SetAPIKey("Claude API", "sk-new"); !errors.Is(err, ErrLocked) {
+		t.Errorf("SetAPIKey while locked = %v, want ErrLocked", err)
+	}
+	if err := Unlock("wrong"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("Unlock with the wrong passphrase = %v, want ErrWrongPassphrase", err)
+	}
+	if err := Unlock("first"); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+
+	if err := SetAPIKey("OpenAI API", "sk-openai"); err != nil {
+		t.Fatalf("SetAPIKey: %v", err)
+	}
+	if err := ChangePassphrase("second"); err != nil {
+		t.Fatalf("ChangePassphrase: %v", err)
+	}
+	Lock()
+	if err := Unlock("first"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("Unlock with the old passphrase = %v, want ErrWrongPassphrase", err)
+	}
+	if err := Unlock("second"); err != nil {
+		t.Fatalf("Unlock with the new passphrase: %v", err)
+	}
+	for name, want := range map[string]string{"Claude API": "sk-plain", "OpenAI API": "sk-openai"} {
+		if got, err := GetAPIKey(name); err != nil || got != want {
+			t.Errorf("GetAPIKey(%s) after changing the passphrase = %q, %v, want %q", name, got, err, want)
+		}
+	}
+
+	if err := ResetPassphrase(); err != nil {
+		t.Fatalf("ResetPassphrase: %v", err)
+	}
+	if has, err := HasPassphrase(); err != nil || has {
+		t.Errorf("HasPassphrase after resetting = %v, %v", has, err)
+	}
+	if names, err := GetAPIKeyNames(); err != nil || len(names) != 0 {
+		t.Errorf("keys left after resetting: %v, %v", names, err)
+	}
+}
+
+func TestKeyIdleTimeout(t *testing.T) {
+	openKeyTestDB(t)
+	if err := ChangePassphrase("passphrase"); err != nil {
+		t.Fatalf("ChangePassphrase: %v", err)
+	}
+	if err := SetAPIKey("Claude API", "sk-secret"); err != nil {
+		t.Fatalf("SetAPIKey: %v", err)
+	}
+	if err := SetKeyIdleTimeout(-time.Second); err == nil {
+		t.Error("SetKeyIdleTimeout accepted a negative timeout")
+	}
+
+	const timeout = 200 * time.Millisecond
+	if err := SetKeyIdleTimeout(timeout); err != nil {
+		t.Fatalf("SetKeyIdleTimeout: %v", err)
+	}
+	if got, err := KeyIdleTimeout(); err != nil || got != timeout {
+		t.Errorf("KeyIdleTimeout = %v, %v, want %v", got, err, timeout)
+	}
+
+	// Using the keys restarts the timeout
+	for i := 0; i < 3; i++ {
+		time.Sleep(timeout / 2)
+		if _, err := GetAPIKey("Claude API"); err != nil {
+			t.Fatalf("GetAPIKey after %d uses: %v", i, err)
+		}
+	}
+	if Locked() {
+		t.Fatal("the keys locked while in use")
+	}
+
+	time.Sleep(2 * timeout)
+	if !Locked() {
+		t.Error("the keys stayed unlocked past the idle timeout")
+	}
+}
@@ -0,0 +1,324 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Utility-Gods/gottem/pkg/types"
+)
+
+// Message is one turn of a chat. Provider, Model and the token counts are
+// only known for answers.
+type Message struct {
+	ID           int
+	ChatID       int
+	Role         types.Role
+	Provider     string // Name of the API that answered
+	Model        string
+	Content      string
+	InputTokens  int
+	OutputTokens int
+	Attachments  []AttachmentRef // The copies of files the message sent
+	Position     int             // Where the message is in the chat, from 0
+	CreatedAt    time.Time
+}
+
+// timeLayout matches CURRENT_TIMESTAMP, so stored times compare with
+// SQLite's datetime functions
+const timeLayout = "2006-01-02 15:04:05"
+
+// GetMessages returns a chat's messages in order
+func GetMessages(chatID int) ([]Message, error) {
+	return getMessages(db, chatID)
+}
+
+func getMessages(q querier, chatID int) ([]Message, error) {
+	query := `SELECT id, chat_id, role, provider, model, content, input_tokens, output_tokens, attachments, position, created_at
+		FROM messages WHERE chat_id = ? ORDER BY position, id;`
+	rows, err := q.Query(query, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		var m Message
+		var attachments string
+		if err := rows.Scan(&m.ID, &m.ChatID, &m.Role, &m.Provider, &m.Model, &m.Content, &m.InputTokens, &m.OutputTokens, &attachments, &m.Position, &m.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan message: %w", err)
+		}
+		if attachments != "" {
+			if err := json.Unmarshal([]byte(attachments), &m.Attachments); err != nil {
+				return nil, fmt.Errorf("failed to decode attachments of message %d: %w", m.ID, err)
+			}
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// AddMessage appends a message to a chat and returns its ID
+func AddMessage(message Message) (int, error) {
+	err := db.QueryRow(`SELECT COALESCE(MAX(position) + 1, 0) FROM messages WHERE chat_id = ?;`, message.ChatID).Scan(&message.Position)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find the end of chat %d: %w", message.ChatID, err)
+	}
+	id, err := insertMessage(db, message)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := db.Exec(`UPDATE chats SET updated_at = CURRENT_TIMESTAMP WHERE id = ?;`, message.ChatID); err != nil {
+		return 0, fmt.Errorf("failed to update chat: %w", err)
+	}
+	return id, nil
+}
+
+// ReplaceMessages stores messages as the whole of a chat, in order, for
+// when the transcript has been edited. Messages carrying the ID of a stored
+// message of the chat update it if anything about it changed, so they keep
+// their ID and only changed turns are written. Other messages are inserted,
+// and stored messages that are not among messages are deleted. Messages
+// without a creation time are stamped with the current time.
+func ReplaceMessages(chatID int, messages []Message) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	existing, err := getMessages(tx, chatID)
+	if err != nil {
+		return err
+	}
+	stored := make(map[int]Message, len(existing))
+	for _, m := range existing {
+		stored[m.ID] = m
+	}
+
+	changed := false
+	for i, m := range messages {
+		m.ChatID = chatID
+		m.Position = i
+		old, ok := stored[m.ID]
+		if !ok {
+			if _, err := insertMessage(tx, m); err != nil {
+				return err
+			}
+			changed = true
+			continue
+		}
+		// A message is only stored once, even if it is given twice
+		delete(stored, m.ID)
+		if sameMessage(old, m) {
+			continue
+		}
+		if err := updateMessage(tx, m); err != nil {
+			return err
+		}
+		changed = true
+	}
+
+	for id := range stored {
+		if _, err := tx.Exec(`DELETE FROM messages WHERE id = ?;`, id); err != nil {
+			return fmt.Errorf("failed to delete message %d: %w", id, err)
+		}
+		changed = true
+	}
+
+	if changed {
+		if _, err := tx.Exec(`UPDATE chats SET updated_at = CURRENT_TIMESTAMP WHERE id = ?;`, chatID); err != nil {
+			return fmt.Errorf("failed to update chat: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// sameMessage reports whether saving m over the stored message would change
+// nothing
+func sameMessage(stored, m Message) bool {
+	if stored.Role != m.Role || stored.Provider != m.Provider || stored.Model != m.Model ||
+		stored.Content != m.Content || stored.InputTokens != m.InputTokens || stored.OutputTokens != m.OutputTokens ||
+		stored.Position != m.Position || len(stored.Attachments) != len(m.Attachments) {
+		return false
+	}
+	for i := range stored.Attachments {
+		if stored.Attachments[i] != m.Attachments[i] {
+			return false
+		}
+	}
+	return m.CreatedAt.IsZero() || formatTime(stored.CreatedAt) == formatTime(m.CreatedAt)
+}
+
+// execer is satisfied by both the database and a transaction
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func insertMessage(ex execer, m Message) (int, error) {
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now()
+	}
+	attachments, err := encodeAttachments(m.Attachments)
+	if err != nil {
+		return 0, err
+	}
+	query := `INSERT INTO messages (chat_id, role, provider, model, content, input_tokens, output_tokens, attachments, position, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
+	result, err := ex.Exec(query, m.ChatID, m.Role, m.Provider, m.Model, m.Content, m.InputTokens, m.OutputTokens,
+		attachments, m.Position, formatTime(m.CreatedAt))
+	if err != nil {
+		return 0, fmt.Errorf("failed to add message: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+	return int(id), nil
+}
+
+func updateMessage(ex execer, m Message) error {
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now()
+	}
+	attachments, err := encodeAttachments(m.Attachments)
+	if err != nil {
+		return err
+	}
+	query := `UPDATE messages SET role = ?, provider = ?, model = ?, content = ?, input_tokens = ?, output_tokens = ?,
+		attachments = ?, position = ?, created_at = ? WHERE id = ? AND chat_id = ?;`
+	_, err = ex.Exec(query, m.Role, m.Provider, m.Model, m.Content, m.InputTokens, m.OutputTokens,
+		attachments, m.Position, formatTime(m.CreatedAt), m.ID, m.ChatID)
+	if err != nil {
+		return fmt.Errorf("failed to update message %d: %w", m.ID, err)
+	}
+	return nil
+}
+
+// encodeAttachments stores no attachments as an empty string
+func encodeAttachments(refs []AttachmentRef) (string, error) {
+	if len(refs) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(refs)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode attachments: %w", err)
+	}
+	return string(data), nil
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeLayout)
+}
+
+// splitChatContexts copies the transcripts kept in chats.context before
+// schema version 15 into the messages table. The column is left as it was,
+// since clearing it would bump each chat's updated_at.
+func splitChatContexts(tx *sql.Tx) error {
+	type oldChat struct {
+		id        int
+		context   string
+		createdAt time.Time
+	}
+
+	rows, err := tx.Query(`SELECT id, context, created_at FROM chats WHERE COALESCE(context, '') != '';`)
+	if err != nil {
+		return fmt.Errorf("failed to query chat transcripts: %w", err)
+	}
+	var chats []oldChat
+	for rows.Next() {
+		var c oldChat
+		if err := rows.Scan(&c.id, &c.context, &c.createdAt); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan chat: %w", err)
+		}
+		chats = append(chats, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read chat transcripts: %w", err)
+	}
+
+	// The columns are those of version 15, as later versions add more
+	query := `INSERT INTO messages (chat_id, role, provider, content, created_at) VALUES (?, ?, ?, ?, ?);`
+	for _, c := range chats {
+		for _, m := range splitContext(c.context) {
+			if _, err := tx.Exec(query, c.id, m.Role, m.Provider, m.Content, c.createdAt.UTC().Format(timeLayout)); err != nil {
+				return fmt.Errorf("failed to copy chat %d: %w", c.id, err)
+			}
+		}
+	}
+
+	if len(chats) > 0 {
+		log.Printf("Copied %d chat transcripts into the messages table", len(chats))
+	}
+	return nil
+}
+
+// splitContext splits a transcript as the editor used to save it into
+// messages. It starts a message at each line beginning with "System:",
+// "Human:", "Assistant:" or "Assistant (provider):" and takes the provider
+// from the latter. Text before the first of them is a user message. This is
+// a frozen copy of the editor's rules at the time, so the migration does not
+// change if they do.
+func splitContext(context string) []Message {
+	var messages []Message
+	var current *Message
+	var lines []string
+
+	flush := func() {
+		if current == nil {
+			return
+		}
+		current.Content = strings.TrimSpace(strings.Join(lines, "\n"))
+		if current.Content != "" {
+			messages = append(messages, *current)
+		}
+		current = nil
+		lines = nil
+	}
+
+	for _, line := range strings.Split(context, "\n") {
+		if m, rest, ok := cutContextPrefix(line); ok {
+			flush()
+			current = &m
+			lines = append(lines, rest)
+			continue
+		}
+		if current == nil {
+			current = &Message{Role: types.RoleUser}
+		}
+		lines = append(lines, line)
+	}
+	flush()
+
+	return messages
+}
+
+func cutContextPrefix(line string) (Message, string, bool) {
+	if rest, ok := strings.CutPrefix(line, "Assistant ("); ok {
+		if i := strings.Index(rest, "):"); i >= 0 {
+			provider := strings.TrimSuffix(strings.TrimSuffix(rest[:i], "cached"), ", ")
+			return Message{Role: types.RoleAssistant, Provider: provider}, strings.TrimPrefix(rest[i+2:], " "), true
+		}
+	}
+
+	for prefix, role := range map[string]types.Role{
+		"System:":    types.RoleSystem,
+		"Human:":     types.RoleUser,
+		"Assistant:": types.RoleAssistant,
+	} {
+		if rest, ok := strings.CutPrefix(line, prefix); ok {
+			return Message{Role: role}, strings.TrimPrefix(rest, " "), true
+		}
+	}
+	return Message{}, "", false
+}
@@ -0,0 +1,178 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Utility-Gods/gottem/pkg/types"
+)
+
+func TestSplitContext(t *testing.T) {
+	tests := []struct {
+		name    string
+		context string
+		want    []Message
+	}{
+		{
+			name:    "empty",
+			context: "",
+			want:    nil,
+		},
+		{
+			name:    "turns",
+			context: "Human: hi\nAssistant: hello\nHuman: bye",
+			want: []Message{
+				{Role: types.RoleUser, Content: "hi"},
+				{Role: types.RoleAssistant, Content: "hello"},
+				{Role: types.RoleUser, Content: "bye"},
+			},
+		},
+		{
+			name:    "text before the first prefix is a user message",
+			context: "notes\nAssistant: ok",
+			want: []Message{
+				{Role: types.RoleUser, Content: "notes"},
+				{Role: types.RoleAssistant, Content: "ok"},
+			},
+		},
+		{
+			name:    "provider headers",
+			context: "Human: q\nAssistant (OpenAI API): a\nAssistant (Groq API, cached): b",
+			want: []Message{
+				{Role: types.RoleUser, Content: "q"},
+				{Role: types.RoleAssistant, Provider: "OpenAI API", Content: "a"},
+				{Role: types.RoleAssistant, Provider: "Groq API", Content: "b"},
+			},
+		},
+		{
+			name:    "system prompt and multi-line turns",
+			context: "System: be brief\nHuman: line one\n\nline two\n\nAssistant: done\n",
+			want: []Message{
+				{Role: types.RoleSystem, Content: "be brief"},
+				{Role: types.RoleUser, Content: "line one\n\nline two"},
+				{Role: types.RoleAssistant, Content: "done"},
+			},
+		},
+		{
+			name:    "empty turns are dropped",
+			context: "Human: \nAssistant: answer\nHuman:",
+			want: []Message{
+				{Role: types.RoleAssistant, Content: "answer"},
+			},
+		},
+		{
+			name:    "prefixes only count at the start of a line",
+			context: "Human: say Assistant: twice",
+			want: []Message{
+				{Role: types.RoleUser, Content: "say Assistant: twice"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitContext(tt.context)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitContext(%q) = %+v, want %+v", tt.context, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitChatContextsMigration(t *testing.T) {
+	migrateTestDB(t, 14)
+
+	contexts := []string{
+		"Human: hi\nAssistant (Claude API): hello",
+		"",
+	}
+	for _, context := range contexts {
+		if _, err := db.Exec(`INSERT INTO chats (title, context) VALUES ('chat', ?);`, context); err != nil {
+			t.Fatalf("inserting chat: %v", err)
+		}
+	}
+	if err := MigrateTo(15); err != nil {
+		t.Fatalf("migrating to 15: %v", err)
+	}
+
+	rows, err := db.Query(`SELECT chat_id, role, provider, content FROM messages ORDER BY id;`)
+	if err != nil {
+		t.Fatalf("querying messages: %v", err)
+	}
+	defer rows.Close()
+	var got []Message
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.ChatID, &m.Role, &m.Provider, &m.Content); err != nil {
+			t.Fatalf("scanning message: %v", err)
+		}
+		got = append(got, m)
+	}
+	want := []Message{
+		{ChatID: 1, Role: types.RoleUser, Content: "hi"},
+		{ChatID: 1, Role: types.RoleAssistant, Provider: "Claude API", Content: "hello"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("messages after migrating = %+v, want %+v", got, want)
+	}
+}
+
+func TestReplaceMessages(t *testing.T) {
+	latest, err := LatestSchemaVersion()
+	if err != nil {
+		t.Fatalf("LatestSchemaVersion: %v", err)
+	}
+	migrateTestDB(t, latest)
+	chatID, err := CreateChat("chat")
+	if err != nil {
+		t.Fatalf("CreateChat: %v", err)
+	}
+
+	save := func(messages []Message) []Message {
+		t.Helper()
+		if err := ReplaceMessages(chatID, messages); err != nil {
+			t.Fatalf("ReplaceMessages: %v", err)
+		}
+		stored, err := GetMessages(chatID)
+		if err != nil {
+			t.Fatalf("GetMessages: %v", err)
+		}
+		return stored
+	}
+
+	first := save([]Message{
+		{Role: types.RoleUser, Content: "q"},
+		{Role: types.RoleAssistant, Provider: "Claude API", Model: "m", Content: "a", OutputTokens: 5},
+	})
+	if len(first) != 2 {
+		t.Fatalf("stored %d messages, want 2", len(first))
+	}
+
+	// Editing one message and inserting another before it keeps the IDs
+	// and metadata of the stored messages
+	edited := first[1]
+	edited.Content = "a, edited"
+	second := save([]Message{
+		first[0],
+		{Role: types.RoleUser, Content: "inserted"},
+		edited,
+	})
+	if len(second) != 3 {
+		t.Fatalf("stored %d messages, want 3", len(second))
+	}
+	if second[0].ID != first[0].ID || second[2].ID != first[1].ID {
+		t.Errorf("IDs changed: %d, %d became %d, %d", first[0].ID, first[1].ID, second[0].ID, second[2].ID)
+	}
+	if second[1].Content != "inserted" || second[2].Content != "a, edited" {
+		t.Errorf("messages out of order: %+v", second)
+	}
+	if second[2].Model != "m" || second[2].OutputTokens != 5 || !second[2].CreatedAt.Equal(first[1].CreatedAt) {
+		t.Errorf("metadata of the edited message was lost: %+v", second[2])
+	}
+
+	// Messages left out are deleted
+	third := save([]Message{second[0], second[2]})
+	if len(third) != 2 || third[0].ID != first[0].ID || third[1].ID != first[1].ID {
+		t.Errorf("after removing a message got %+v", third)
+	}
+}
@@ -0,0 +1,271 @@
+package db
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Migrations are numbered SQL files named NNN_name.up.sql, with a matching
+// NNN_name.down.sql that undoes them. They are built into the binary, so the
+// database can be migrated from any directory.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// dataMigrations run Go code after the SQL of the version with the same
+// number, in the same transaction, for changes SQL alone cannot make
+var dataMigrations = map[int]func(tx *sql.Tx) error{
+	15: splitChatContexts,
+	17: moveAttachments,
+}
+
+// Migration describes a schema version and whether it has been applied
+type Migration struct {
+	Version int
+	Name    string
+	Applied bool
+}
+
+type migration struct {
+	version  int
+	name     string
+	up, down string
+}
+
+// loadMigrations reads the embedded migrations in version order. Versions
+// must run from 1 without gaps and each must have an up file.
+func loadMigrations() ([]migration, error) {
+	files, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return nil, fmt.Errorf("error listing migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*migration)
+	for _, file := range files {
+		base := strings.TrimPrefix(file, "migrations/")
+		prefix, rest, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("migration %s is not named NNN_name.up.sql or NNN_name.down.sql", base)
+		}
+
+		content, err := migrationFiles.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration %s: %w", base, err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version}
+			byVersion[version] = m
+		}
+		switch {
+		case strings.HasSuffix(rest, ".up.sql"):
+			m.name = strings.TrimSuffix(rest, ".up.sql")
+			m.up = string(content)
+		case strings.HasSuffix(rest, ".down.sql"):
+			m.down = string(content)
+		default:
+			return nil, fmt.Errorf("migration %s is not named NNN_name.up.sql or NNN_name.down.sql", base)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	for i, m := range migrations {
+		if m.version != i+1 {
+			return nil, fmt.Errorf("migration %d is missing", i+1)
+		}
+		if m.up == "" {
+			return nil, fmt.Errorf("migration %d has no up file", m.version)
+		}
+	}
+	return migrations, nil
+}
+
+// SchemaVersion returns the highest migration applied to the database, or 0
+// for a new database
+func SchemaVersion() (int, error) {
+	if err := createVersionTable(); err != nil {
+		return 0, err
+	}
+
+	var version int
+	err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("error checking schema version: %w", err)
+	}
+	return version, nil
+}
+
+// LatestSchemaVersion returns the version the migrations built into this
+// binary lead to
+func LatestSchemaVersion() (int, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return 0, err
+	}
+	return len(migrations), nil
+}
+
+// MigrationStatus lists every migration and whether it has been applied
+func MigrationStatus() ([]Migration, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if err := createVersionTable(); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT version FROM schema_version")
+	if err != nil {
+		return nil, fmt.Errorf("error reading schema versions: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, fmt.Errorf("error scanning schema version: %w", err)
+		}
+		applied[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading schema versions: %w", err)
+	}
+
+	status := make([]Migration, len(migrations))
+	for i, m := range migrations {
+		status[i] = Migration{Version: m.version, Name: m.name, Applied: applied[m.version]}
+	}
+	return status, nil
+}
+
+// MigrateDatabase applies every migration the database is missing. A
+// database migrated by a newer build is left alone.
+func MigrateDatabase() error {
+	current, err := SchemaVersion()
+	if err != nil {
+		return err
+	}
+	latest, err := LatestSchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	if current > latest {
+		log.Printf("Database schema version %d is newer than this build's %d, not migrating", current, latest)
+		return nil
+	}
+	if current == latest {
+		log.Println("Database schema is up to date")
+		return nil
+	}
+	return MigrateTo(latest)
+}
+
+// MigrateTo applies or undoes migrations until the database is at target.
+// Each migration runs in its own transaction. Going down drops tables and
+// columns with their data, and is meant for development.
+func MigrateTo(target int) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	if target < 0 || target > len(migrations) {
+		return fmt.Errorf("no schema version %d, the latest is %d", target, len(migrations))
+	}
+
+	current, err := SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.version > current && m.version <= target {
+			if err := applyMigration(m); err != nil {
+				return err
+			}
+		}
+	}
+	for i := len(migrations) - 1; i >= 0; i-- {
+		if m := migrations[i]; m.version <= current && m.version > target {
+			if err := revertMigration(m); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func applyMigration(m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(m.up); err != nil {
+		return fmt.Errorf("error applying schema version %d: %w", m.version, err)
+	}
+	if migrate, ok := dataMigrations[m.version]; ok {
+		if err := migrate(tx); err != nil {
+			return fmt.Errorf("error migrating data for schema version %d: %w", m.version, err)
+		}
+	}
+	if _, err := tx.Exec("INSERT OR REPLACE INTO schema_version (version) VALUES (?)", m.version); err != nil {
+		return fmt.Errorf("error updating schema version: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing schema version %d: %w", m.version, err)
+	}
+	log.Printf("Applied schema version %d (%s)", m.version, m.name)
+	return nil
+}
+
+func revertMigration(m migration) error {
+	if m.down == "" {
+		return fmt.Errorf("schema version %d (%s) cannot be undone", m.version, m.name)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(m.down); err != nil {
+		return fmt.Errorf("error undoing schema version %d: %w", m.version, err)
+	}
+	if _, err := tx.Exec("DELETE FROM schema_version WHERE version >= ?", m.version); err != nil {
+		return fmt.Errorf("error updating schema version: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing schema version %d: %w", m.version, err)
+	}
+	log.Printf("Undid schema version %d (%s)", m.version, m.name)
+	return nil
+}
+
+func createVersionTable() error {
+	_, err := db.Exec("CREATE TABLE IF NOT EXISTS schema_version (version INTEGER PRIMARY KEY)")
+	if err != nil {
+		return fmt.Errorf("error creating schema_version table: %w", err)
+	}
+	return nil
+}
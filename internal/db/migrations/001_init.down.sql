@@ -0,0 +1,6 @@
+-- 001_init.down.sql
+
+DROP INDEX IF EXISTS idx_chats_updated_at;
+DROP TRIGGER IF EXISTS update_chats_timestamp;
+DROP TABLE IF EXISTS api_keys;
+DROP TABLE IF EXISTS chats;
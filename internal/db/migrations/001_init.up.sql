@@ -1,4 +1,4 @@
--- schema.sql
+-- 001_init.up.sql
 
 -- Chats table
 CREATE TABLE IF NOT EXISTS chats (
@@ -15,14 +15,6 @@ CREATE TABLE IF NOT EXISTS api_keys (
     api_key TEXT NOT NULL
 );
 
--- Schema version table
-CREATE TABLE IF NOT EXISTS schema_version (
-    version INTEGER PRIMARY KEY
-);
-
--- Insert initial schema version
-INSERT OR REPLACE INTO schema_version (version) VALUES (1);
-
 -- Trigger to update chat timestamp
 CREATE TRIGGER IF NOT EXISTS update_chats_timestamp
 AFTER UPDATE ON chats
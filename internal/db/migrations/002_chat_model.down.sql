@@ -0,0 +1,4 @@
+-- 002_chat_model.down.sql
+
+ALTER TABLE chats DROP COLUMN model;
+ALTER TABLE chats DROP COLUMN provider;
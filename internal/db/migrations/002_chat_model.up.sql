@@ -0,0 +1,5 @@
+-- 002_chat_model.up.sql
+
+-- Remember which provider and model each chat uses
+ALTER TABLE chats ADD COLUMN provider TEXT NOT NULL DEFAULT '';
+ALTER TABLE chats ADD COLUMN model TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+-- 003_chat_params.down.sql
+
+DROP TABLE IF EXISTS chat_params;
@@ -0,0 +1,11 @@
+-- 003_chat_params.up.sql
+
+-- Generation parameters and system prompt for each chat
+CREATE TABLE IF NOT EXISTS chat_params (
+    chat_id INTEGER PRIMARY KEY REFERENCES chats(id) ON DELETE CASCADE,
+    max_tokens INTEGER NOT NULL DEFAULT 0,
+    temperature REAL,
+    top_p REAL,
+    stop TEXT NOT NULL DEFAULT '[]',
+    system_prompt TEXT NOT NULL DEFAULT ''
+);
@@ -0,0 +1,3 @@
+-- 004_settings.down.sql
+
+DROP TABLE IF EXISTS settings;
@@ -0,0 +1,7 @@
+-- 004_settings.up.sql
+
+-- Application settings stored as key/value pairs
+CREATE TABLE IF NOT EXISTS settings (
+    key TEXT PRIMARY KEY,
+    value TEXT NOT NULL
+);
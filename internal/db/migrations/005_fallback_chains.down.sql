@@ -0,0 +1,3 @@
+-- 005_fallback_chains.down.sql
+
+DROP TABLE IF EXISTS fallback_chains;
@@ -0,0 +1,8 @@
+-- 005_fallback_chains.up.sql
+
+-- Ordered provider fallback chains, members are API shortcuts joined by commas
+CREATE TABLE IF NOT EXISTS fallback_chains (
+    name TEXT PRIMARY KEY,
+    shortcut TEXT NOT NULL UNIQUE,
+    members TEXT NOT NULL
+);
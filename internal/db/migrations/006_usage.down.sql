@@ -0,0 +1,6 @@
+-- 006_usage.down.sql
+
+DROP TABLE IF EXISTS model_prices;
+DROP INDEX IF EXISTS idx_usage_created_at;
+DROP INDEX IF EXISTS idx_usage_chat_id;
+DROP TABLE IF EXISTS usage;
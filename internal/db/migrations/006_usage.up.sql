@@ -0,0 +1,40 @@
+-- 006_usage.up.sql
+
+-- Token usage and cost of every request, priced when it was made
+CREATE TABLE IF NOT EXISTS usage (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    chat_id INTEGER,
+    provider TEXT NOT NULL,
+    model TEXT NOT NULL DEFAULT '',
+    input_tokens INTEGER NOT NULL DEFAULT 0,
+    output_tokens INTEGER NOT NULL DEFAULT 0,
+    latency_ms INTEGER NOT NULL DEFAULT 0,
+    cost REAL NOT NULL DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_usage_chat_id ON usage(chat_id);
+CREATE INDEX IF NOT EXISTS idx_usage_created_at ON usage(created_at);
+
+-- Prices in US dollars per million tokens. A price applies to every model
+-- whose name starts with it, the longest match winning.
+CREATE TABLE IF NOT EXISTS model_prices (
+    model TEXT PRIMARY KEY,
+    input_price REAL NOT NULL,
+    output_price REAL NOT NULL
+);
+
+INSERT OR IGNORE INTO model_prices (model, input_price, output_price) VALUES
+    ('claude-3-5-sonnet', 3.00, 15.00),
+    ('claude-3-opus', 15.00, 75.00),
+    ('claude-3-sonnet', 3.00, 15.00),
+    ('claude-3-haiku', 0.25, 1.25),
+    ('gpt-4o-mini', 0.15, 0.60),
+    ('gpt-4o', 5.00, 15.00),
+    ('gpt-4-turbo', 10.00, 30.00),
+    ('gpt-4', 30.00, 60.00),
+    ('gpt-3.5-turbo', 0.50, 1.50),
+    ('llama3-70b-8192', 0.59, 0.79),
+    ('llama3-8b-8192', 0.05, 0.08),
+    ('mixtral-8x7b-32768', 0.24, 0.24),
+    ('gemma-7b-it', 0.07, 0.07);
@@ -0,0 +1,3 @@
+-- 007_budgets.down.sql
+
+DROP TABLE IF EXISTS budgets;
@@ -0,0 +1,9 @@
+-- 007_budgets.up.sql
+
+-- Monthly spending limits in US dollars. The empty provider is the overall
+-- budget, and a limit of 0 is not enforced.
+CREATE TABLE IF NOT EXISTS budgets (
+    provider TEXT PRIMARY KEY,
+    soft_limit REAL NOT NULL DEFAULT 0,
+    hard_limit REAL NOT NULL DEFAULT 0
+);
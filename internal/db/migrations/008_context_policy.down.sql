@@ -0,0 +1,5 @@
+-- 008_context_policy.down.sql
+
+ALTER TABLE chats DROP COLUMN summary_messages;
+ALTER TABLE chats DROP COLUMN summary;
+ALTER TABLE chat_params DROP COLUMN context_policy;
@@ -0,0 +1,8 @@
+-- 008_context_policy.up.sql
+
+-- What to do when a chat outgrows the model's context window
+ALTER TABLE chat_params ADD COLUMN context_policy TEXT NOT NULL DEFAULT '';
+
+-- Summary standing in for the oldest messages of a long chat
+ALTER TABLE chats ADD COLUMN summary TEXT NOT NULL DEFAULT '';
+ALTER TABLE chats ADD COLUMN summary_messages INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+-- 009_attachments.down.sql
+
+DROP TABLE IF EXISTS attachments;
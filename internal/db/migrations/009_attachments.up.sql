@@ -0,0 +1,14 @@
+-- 009_attachments.up.sql
+
+-- Files attached to chat messages, stored so a continued chat sends the same
+-- content even if the file has since changed or moved
+CREATE TABLE IF NOT EXISTS attachments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    chat_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    mime_type TEXT NOT NULL,
+    data BLOB NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (chat_id, name),
+    FOREIGN KEY (chat_id) REFERENCES chats(id)
+);
@@ -0,0 +1,3 @@
+-- 010_network_settings.down.sql
+
+DROP TABLE IF EXISTS network_settings;
@@ -0,0 +1,11 @@
+-- 010_network_settings.up.sql
+
+-- Connection settings per provider, keyed by the provider's display name.
+-- Empty values keep the built-in defaults.
+CREATE TABLE IF NOT EXISTS network_settings (
+    provider TEXT PRIMARY KEY,
+    base_url TEXT NOT NULL DEFAULT '',
+    timeout TEXT NOT NULL DEFAULT '',
+    proxy TEXT NOT NULL DEFAULT '',
+    ca_file TEXT NOT NULL DEFAULT ''
+);
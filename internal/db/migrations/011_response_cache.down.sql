@@ -0,0 +1,4 @@
+-- 011_response_cache.down.sql
+
+DROP TABLE IF EXISTS response_cache;
+ALTER TABLE chat_params DROP COLUMN cache;
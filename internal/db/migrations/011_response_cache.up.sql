@@ -0,0 +1,15 @@
+-- 011_response_cache.up.sql
+
+-- Whether a chat reuses cached answers to identical requests
+ALTER TABLE chat_params ADD COLUMN cache INTEGER NOT NULL DEFAULT 0;
+
+-- Answers to earlier requests, keyed by a hash of the provider, model,
+-- parameters and messages
+CREATE TABLE IF NOT EXISTS response_cache (
+    key TEXT PRIMARY KEY,
+    provider TEXT NOT NULL,
+    model TEXT NOT NULL,
+    response TEXT NOT NULL,
+    hits INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
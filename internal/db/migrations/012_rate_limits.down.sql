@@ -0,0 +1,3 @@
+-- 012_rate_limits.down.sql
+
+DROP TABLE IF EXISTS rate_limits;
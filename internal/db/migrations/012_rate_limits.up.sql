@@ -0,0 +1,10 @@
+-- 012_rate_limits.up.sql
+
+-- Client-side rate limits per provider, keyed by the provider's display
+-- name. Zero means no limit.
+CREATE TABLE IF NOT EXISTS rate_limits (
+    provider TEXT PRIMARY KEY,
+    requests_per_minute INTEGER NOT NULL DEFAULT 0,
+    tokens_per_minute INTEGER NOT NULL DEFAULT 0,
+    max_concurrent INTEGER NOT NULL DEFAULT 0
+);
@@ -0,0 +1,3 @@
+-- 013_json_mode.down.sql
+
+ALTER TABLE chat_params DROP COLUMN json_mode;
@@ -0,0 +1,4 @@
+-- 013_json_mode.up.sql
+
+-- Whether a chat asks for answers as JSON objects
+ALTER TABLE chat_params ADD COLUMN json_mode INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+-- 014_continue_limit.down.sql
+
+ALTER TABLE chat_params DROP COLUMN continue_limit;
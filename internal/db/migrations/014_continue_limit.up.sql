@@ -0,0 +1,4 @@
+-- 014_continue_limit.up.sql
+
+-- How many times an answer cut off by max_tokens is continued
+ALTER TABLE chat_params ADD COLUMN continue_limit INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,6 @@
+-- 015_messages.down.sql
+
+-- Chats from before version 15 still have their transcript in chats.context.
+-- Messages of chats started since then are lost.
+DROP INDEX IF EXISTS idx_messages_chat_id;
+DROP TABLE IF EXISTS messages;
@@ -0,0 +1,3 @@
+-- 016_compatible_providers.down.sql
+
+DROP TABLE IF EXISTS compatible_providers;
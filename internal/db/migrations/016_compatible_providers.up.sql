@@ -0,0 +1,12 @@
+-- 016_compatible_providers.up.sql
+
+-- OpenAI-compatible providers configured by the user
+CREATE TABLE IF NOT EXISTS compatible_providers (
+    name TEXT PRIMARY KEY,
+    shortcut TEXT NOT NULL UNIQUE,
+    base_url TEXT NOT NULL,
+    auth_header TEXT NOT NULL DEFAULT 'Authorization',
+    auth_scheme TEXT NOT NULL DEFAULT 'Bearer',
+    default_model TEXT NOT NULL DEFAULT '',
+    extra_headers TEXT NOT NULL DEFAULT '{}'
+);
@@ -0,0 +1,23 @@
+-- 017_message_attachments.down.sql
+
+-- Each chat keeps the copy most recently sent under each name
+CREATE TABLE IF NOT EXISTS attachments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    chat_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    mime_type TEXT NOT NULL,
+    data BLOB NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (chat_id, name),
+    FOREIGN KEY (chat_id) REFERENCES chats(id)
+);
+
+INSERT OR REPLACE INTO attachments (chat_id, name, mime_type, data)
+SELECT m.chat_id, json_extract(a.value, '$.name'), f.mime_type, f.data
+FROM messages m, json_each(m.attachments) a
+JOIN attachment_files f ON f.chat_id = m.chat_id AND f.hash = json_extract(a.value, '$.hash')
+WHERE m.attachments != ''
+ORDER BY m.id;
+
+ALTER TABLE messages DROP COLUMN attachments;
+DROP TABLE IF EXISTS attachment_files;
@@ -0,0 +1,20 @@
+-- 017_message_attachments.up.sql
+
+-- Attached files are stored once per chat under the SHA-256 of their content,
+-- and each message lists the copies it sent in messages.attachments, so
+-- sending a changed file again does not alter what earlier messages sent.
+-- The copies in the attachments table, which kept one per file name, are
+-- moved here when this version is applied.
+CREATE TABLE IF NOT EXISTS attachment_files (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    chat_id INTEGER NOT NULL,
+    hash TEXT NOT NULL,
+    mime_type TEXT NOT NULL,
+    data BLOB NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (chat_id, hash),
+    FOREIGN KEY (chat_id) REFERENCES chats(id)
+);
+
+-- A JSON list of {"name", "hash"}, empty when the message attached nothing
+ALTER TABLE messages ADD COLUMN attachments TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,17 @@
+-- 018_message_position.down.sql
+
+-- Earlier versions order messages by ID, so the messages are inserted again
+-- in the order of their positions, which gives them new IDs
+CREATE TEMPORARY TABLE messages_by_position AS
+SELECT chat_id, role, provider, model, content, input_tokens, output_tokens, attachments, created_at
+FROM messages ORDER BY chat_id, position, id;
+
+DELETE FROM messages;
+
+INSERT INTO messages (chat_id, role, provider, model, content, input_tokens, output_tokens, attachments, created_at)
+SELECT chat_id, role, provider, model, content, input_tokens, output_tokens, attachments, created_at
+FROM messages_by_position ORDER BY rowid;
+
+DROP TABLE messages_by_position;
+
+ALTER TABLE messages DROP COLUMN position;
@@ -0,0 +1,11 @@
+-- 018_message_position.up.sql
+
+-- Where each message is in its chat. Messages used to be ordered by ID, so
+-- each chat's messages are numbered in that order. Saving an edited chat
+-- now only writes the turns that changed, keeping the IDs of the others.
+ALTER TABLE messages ADD COLUMN position INTEGER NOT NULL DEFAULT 0;
+
+UPDATE messages SET position = (
+    SELECT COUNT(*) FROM messages earlier
+    WHERE earlier.chat_id = messages.chat_id AND earlier.id < messages.id
+);
@@ -0,0 +1,117 @@
+package db
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+// openTestDB points the package at an empty database in a temporary
+// directory for the rest of the test
+func openTestDB(t *testing.T) {
+	t.Helper()
+	test, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "gottem.db"))
+	if err != nil {
+		t.Fatalf("opening test database: %v", err)
+	}
+	previous := db
+	db = test
+	t.Cleanup(func() {
+		test.Close()
+		db = previous
+	})
+}
+
+// migrateTestDB opens a test database and migrates it to version
+func migrateTestDB(t *testing.T, version int) {
+	t.Helper()
+	openTestDB(t)
+	if err := MigrateTo(version); err != nil {
+		t.Fatalf("migrating to version %d: %v", version, err)
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("loadMigrations: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	for i, m := range migrations {
+		if m.version != i+1 {
+			t.Errorf("migration %d has version %d", i, m.version)
+		}
+		if m.name == "" {
+			t.Errorf("migration %d has no name", m.version)
+		}
+		if m.up == "" || m.down == "" {
+			t.Errorf("migration %d (%s) is missing its up or down file", m.version, m.name)
+		}
+	}
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	openTestDB(t)
+	latest, err := LatestSchemaVersion()
+	if err != nil {
+		t.Fatalf("LatestSchemaVersion: %v", err)
+	}
+
+	for _, target := range []int{latest, 0, latest} {
+		if err := MigrateTo(target); err != nil {
+			t.Fatalf("MigrateTo(%d): %v", target, err)
+		}
+		version, err := SchemaVersion()
+		if err != nil {
+			t.Fatalf("SchemaVersion: %v", err)
+		}
+		if version != target {
+			t.Fatalf("after MigrateTo(%d) the schema version is %d", target, version)
+		}
+	}
+
+	var tables int
+	err = db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name IN ('chats', 'messages', 'api_keys')`).Scan(&tables)
+	if err != nil {
+		t.Fatalf("counting tables: %v", err)
+	}
+	if tables != 3 {
+		t.Errorf("found %d of the chats, messages and api_keys tables, want 3", tables)
+	}
+}
+
+// Each migration must undo cleanly on its own, so any version can be
+// reached from any other
+func TestMigrateEachVersionDown(t *testing.T) {
+	openTestDB(t)
+	latest, err := LatestSchemaVersion()
+	if err != nil {
+		t.Fatalf("LatestSchemaVersion: %v", err)
+	}
+	for version := 1; version <= latest; version++ {
+		if err := MigrateTo(version); err != nil {
+			t.Fatalf("MigrateTo(%d): %v", version, err)
+		}
+		if err := MigrateTo(version - 1); err != nil {
+			t.Fatalf("undoing version %d: %v", version, err)
+		}
+		if err := MigrateTo(version); err != nil {
+			t.Fatalf("reapplying version %d: %v", version, err)
+		}
+	}
+}
+
+func TestMigrateToUnknownVersion(t *testing.T) {
+	openTestDB(t)
+	latest, err := LatestSchemaVersion()
+	if err != nil {
+		t.Fatalf("LatestSchemaVersion: %v", err)
+	}
+	for _, target := range []int{-1, latest + 1} {
+		if err := MigrateTo(target); err == nil {
+			t.Errorf("MigrateTo(%d) succeeded", target)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// NetworkSettings are the connection settings for one provider. Zero values
+// keep the provider's defaults.
+type NetworkSettings struct {
+	Provider string
+	BaseURL  string        // Replaces the provider's API base URL
+	Timeout  time.Duration // How long to wait for a response to start
+	Proxy    string        // Proxy URL, otherwise HTTPS_PROXY and HTTP_PROXY apply
+	CAFile   string        // PEM bundle trusted in addition to the system roots
+}
+
+// GetNetworkSettings returns the settings for a provider, or zero settings if
+// none are saved
+func GetNetworkSettings(provider string) (NetworkSettings, error) {
+	query := `SELECT provider, base_url, timeout, proxy, ca_file FROM network_settings WHERE provider = ?;`
+	settings, err := scanNetworkSettings(db.QueryRow(query, provider))
+	if err == sql.ErrNoRows {
+		return NetworkSettings{Provider: provider}, nil
+	}
+	if err != nil {
+		return NetworkSettings{}, fmt.Errorf("failed to get network settings: %w", err)
+	}
+	return settings, nil
+}
+
+func GetAllNetworkSettings() ([]NetworkSettings, error) {
+	query := `SELECT provider, base_url, timeout, proxy, ca_file FROM network_settings ORDER BY provider;`
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query network settings: %w", err)
+	}
+	defer rows.Close()
+
+	var all []NetworkSettings
+	for rows.Next() {
+		settings, err := scanNetworkSettings(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan network settings: %w", err)
+		}
+		all = append(all, settings)
+	}
+
+	return all, rows.Err()
+}
+
+func scanNetworkSettings(row interface{ Scan(...interface{}) error }) (NetworkSettings, error) {
+	var settings NetworkSettings
+	var timeout string
+	if err := row.Scan(&settings.Provider, &settings.BaseURL, &timeout, &settings.Proxy, &settings.CAFile); err != nil {
+		return NetworkSettings{}, err
+	}
+	if timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			return NetworkSettings{}, fmt.Errorf("invalid timeout %q for %s: %w", timeout, settings.Provider, err)
+		}
+		settings.Timeout = d
+	}
+	return settings, nil
+}
+
+func SaveNetworkSettings(settings NetworkSettings) error {
+	timeout := ""
+	if settings.Timeout > 0 {
+		timeout = settings.Timeout.String()
+	}
+
+	query := `INSERT OR REPLACE INTO network_settings (provider, base_url, timeout, proxy, ca_file) VALUES (?, ?, ?, ?, ?);`
+	_, err := db.Exec(query, settings.Provider, settings.BaseURL, timeout, settings.Proxy, settings.CAFile)
+	if err != nil {
+		return fmt.Errorf("failed to save network settings: %w", err)
+	}
+	return nil
+}
+
+func DeleteNetworkSettings(provider string) error {
+	query := `DELETE FROM network_settings WHERE provider = ?;`
+	_, err := db.Exec(query, provider)
+	if err != nil {
+		return fmt.Errorf("failed to delete network settings: %w", err)
+	}
+	return nil
+}
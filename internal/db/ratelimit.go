@@ -0,0 +1,68 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// RateLimits caps how fast requests are sent to one provider. Zero values
+// mean no limit.
+type RateLimits struct {
+	Provider          string
+	RequestsPerMinute int
+	TokensPerMinute   int // Estimated input tokens plus max_tokens
+	MaxConcurrent     int // Requests in flight at once
+}
+
+// GetRateLimits returns the limits for a provider, or zero limits if none are
+// saved
+func GetRateLimits(provider string) (RateLimits, error) {
+	query := `SELECT provider, requests_per_minute, tokens_per_minute, max_concurrent FROM rate_limits WHERE provider = ?;`
+	var limits RateLimits
+	err := db.QueryRow(query, provider).Scan(&limits.Provider, &limits.RequestsPerMinute, &limits.TokensPerMinute, &limits.MaxConcurrent)
+	if err == sql.ErrNoRows {
+		return RateLimits{Provider: provider}, nil
+	}
+	if err != nil {
+		return RateLimits{}, fmt.Errorf("failed to get rate limits: %w", err)
+	}
+	return limits, nil
+}
+
+func GetAllRateLimits() ([]RateLimits, error) {
+	query := `SELECT provider, requests_per_minute, tokens_per_minute, max_concurrent FROM rate_limits ORDER BY provider;`
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rate limits: %w", err)
+	}
+	defer rows.Close()
+
+	var all []RateLimits
+	for rows.Next() {
+		var limits RateLimits
+		if err := rows.Scan(&limits.Provider, &limits.RequestsPerMinute, &limits.TokensPerMinute, &limits.MaxConcurrent); err != nil {
+			return nil, fmt.Errorf("failed to scan rate limits: %w", err)
+		}
+		all = append(all, limits)
+	}
+
+	return all, rows.Err()
+}
+
+func SaveRateLimits(limits RateLimits) error {
+	query := `INSERT OR REPLACE INTO rate_limits (provider, requests_per_minute, tokens_per_minute, max_concurrent) VALUES (?, ?, ?, ?);`
+	_, err := db.Exec(query, limits.Provider, limits.RequestsPerMinute, limits.TokensPerMinute, limits.MaxConcurrent)
+	if err != nil {
+		return fmt.Errorf("failed to save rate limits: %w", err)
+	}
+	return nil
+}
+
+func DeleteRateLimits(provider string) error {
+	query := `DELETE FROM rate_limits WHERE provider = ?;`
+	_, err := db.Exec(query, provider)
+	if err != nil {
+		return fmt.Errorf("failed to delete rate limits: %w", err)
+	}
+	return nil
+}
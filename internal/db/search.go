@@ -0,0 +1,285 @@
+package db
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+)
+
+// Chat titles and message content are indexed with SQLite's FTS5, which
+// go-sqlite3 only includes when built with the sqlite_fts5 tag. The index is
+// therefore not one of the numbered migrations: builds without FTS5 can still
+// open the database and fall back to a substring search.
+const searchIndexSQL = `
+CREATE VIRTUAL TABLE IF NOT EXISTS chats_fts USING fts5(
+    title, content='chats', content_rowid='id', tokenize='porter unicode61'
+);
+CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(
+    content, content='messages', content_rowid='id', tokenize='porter unicode61'
+);
+
+CREATE TRIGGER IF NOT EXISTS chats_fts_insert AFTER INSERT ON chats BEGIN
+    INSERT INTO chats_fts(rowid, title) VALUES (new.id, new.title);
+END;
+CREATE TRIGGER IF NOT EXISTS chats_fts_delete AFTER DELETE ON chats BEGIN
+    INSERT INTO chats_fts(chats_fts, rowid, title) VALUES ('delete', old.id, old.title);
+END;
+CREATE TRIGGER IF NOT EXISTS chats_fts_update AFTER UPDATE OF title ON chats BEGIN
+    INSERT INTO chats_fts(chats_fts, rowid, title) VALUES ('delete', old.id, old.title);
+    INSERT INTO chats_fts(rowid, title) VALUES (new.id, new.title);
+END;
+
+CREATE TRIGGER IF NOT EXISTS messages_fts_insert AFTER INSERT ON messages BEGIN
+    INSERT INTO messages_fts(rowid, content) VALUES (new.id, new.content);
+END;
+CREATE TRIGGER IF NOT EXISTS messages_fts_delete AFTER DELETE ON messages BEGIN
+    INSERT INTO messages_fts(messages_fts, rowid, content) VALUES ('delete', old.id, old.content);
+END;
+CREATE TRIGGER IF NOT EXISTS messages_fts_update AFTER UPDATE OF content ON messages BEGIN
+    INSERT INTO messages_fts(messages_fts, rowid, content) VALUES ('delete', old.id, old.content);
+    INSERT INTO messages_fts(rowid, content) VALUES (new.id, new.content);
+END;
+
+INSERT INTO chats_fts(chats_fts) VALUES ('rebuild');
+INSERT INTO messages_fts(messages_fts) VALUES ('rebuild');`
+
+// searchTriggers keep the index in step with the chats and messages tables
+var searchTriggers = []string{
+	"chats_fts_insert", "chats_fts_delete", "chats_fts_update",
+	"messages_fts_insert", "messages_fts_delete", "messages_fts_update",
+}
+
+// searchIndexed is set once the full-text index is known to be up to date
+var searchIndexed bool
+
+// Search results mark the matched words of their snippet with MatchStart and
+// MatchEnd, see ChatMatch.Highlight
+const (
+	MatchStart = "\x02"
+	MatchEnd   = "\x03"
+)
+
+// EnsureSearchIndex creates the full-text index if this build has FTS5 and
+// the index is missing or was left stale by a build without it. Without
+// FTS5 the index's triggers are dropped, as writing to chats or messages
+// would otherwise fail.
+func EnsureSearchIndex() error {
+	searchIndexed = false
+
+	var available bool
+	if err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&available); err != nil {
+		return fmt.Errorf("error checking for FTS5: %w", err)
+	}
+
+	var hasMessages bool
+	err := db.QueryRow("SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'messages'").Scan(&hasMessages)
+	if err != nil {
+		return fmt.Errorf("error checking for the messages table: %w", err)
+	}
+
+	if !available || !hasMessages {
+		for _, trigger := range searchTriggers {
+			if _, err := db.Exec("DROP TRIGGER IF EXISTS " + trigger); err != nil {
+				return fmt.Errorf("error dropping trigger %s: %w", trigger, err)
+			}
+		}
+		if !available {
+			log.Println("SQLite was built without FTS5, chat search falls back to substring matching")
+		}
+		return nil
+	}
+
+	var triggers int
+	query := "SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name IN ('" + strings.Join(searchTriggers, "', '") + "')"
+	if err := db.QueryRow(query).Scan(&triggers); err != nil {
+		return fmt.Errorf("error checking the search index: %w", err)
+	}
+	if triggers == len(searchTriggers) {
+		searchIndexed = true
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(searchIndexSQL); err != nil {
+		return fmt.Errorf("error creating the search index: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing the search index: %w", err)
+	}
+
+	log.Println("Built the chat search index")
+	searchIndexed = true
+	return nil
+}
+
+// ChatMatch is a hit found by SearchChats, with an excerpt around the match
+type ChatMatch struct {
+	ChatID    int
+	Title     string
+	MessageID int    // The matching message, 0 when only the title matched
+	Snippet   string // Matched words are between MatchStart and MatchEnd
+}
+
+// Highlight returns the snippet with its matched words between start and end
+func (m ChatMatch) Highlight(start, end string) string {
+	return strings.NewReplacer(MatchStart, start, MatchEnd, end).Replace(m.Snippet)
+}
+
+// Terms returns the words of the snippet that matched, as they are written
+// in the chat
+func (m ChatMatch) Terms() []string {
+	var terms []string
+	rest := m.Snippet
+	for {
+		_, after, ok := strings.Cut(rest, MatchStart)
+		if !ok {
+			return terms
+		}
+		term, after, _ := strings.Cut(after, MatchEnd)
+		terms = append(terms, term)
+		rest = after
+	}
+}
+
+// SearchChats finds chat titles and messages matching text, best matches
+// first. With the full-text index every word of text must appear, the last
+// one possibly as a prefix, and words match their other forms, e.g. "run"
+// finds "running". Otherwise text is matched as a substring, ignoring case,
+// once per chat with the most recently updated chats first.
+func SearchChats(text string, limit int) ([]ChatMatch, error) {
+	if searchIndexed {
+		return searchIndex(text, limit)
+	}
+	return searchSubstring(text, limit)
+}
+
+func searchIndex(text string, limit int) ([]ChatMatch, error) {
+	match := ftsQuery(text)
+	if match == "" {
+		return nil, nil
+	}
+
+	query := `SELECT chat_id, title, message_id, snippet FROM (
+			SELECT c.id AS chat_id, c.title, 0 AS message_id,
+				highlight(chats_fts, 0, char(2), char(3)) AS snippet, chats_fts.rank AS rank
+			FROM chats_fts JOIN chats c ON c.id = chats_fts.rowid
+			WHERE chats_fts MATCH ?1
+			UNION ALL
+			SELECT m.chat_id, c.title, m.id,
+				snippet(messages_fts, 0, char(2), char(3), '...', 16), messages_fts.rank
+			FROM messages_fts
+				JOIN messages m ON m.id = messages_fts.rowid
+				JOIN chats c ON c.id = m.chat_id
+			WHERE messages_fts MATCH ?1
+		) ORDER BY rank LIMIT ?2;`
+	rows, err := db.Query(query, match, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search chats: %w", err)
+	}
+	defer rows.Close()
+
+	var matches []ChatMatch
+	for rows.Next() {
+		var m ChatMatch
+		if err := rows.Scan(&m.ChatID, &m.Title, &m.MessageID, &m.Snippet); err != nil {
+			return nil, fmt.Errorf("failed to scan search result: %w", err)
+		}
+		m.Snippet = strings.Join(strings.Fields(m.Snippet), " ")
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
+
+// ftsQuery turns what the user typed into an FTS5 query, quoting each word
+// so punctuation is not read as query syntax
+func ftsQuery(text string) string {
+	words := strings.Fields(text)
+	for i, word := range words {
+		words[i] = `"` + strings.ReplaceAll(word, `"`, `""`) + `"`
+	}
+	if len(words) > 0 {
+		words[len(words)-1] += "*"
+	}
+	return strings.Join(words, " ")
+}
+
+func searchSubstring(text string, limit int) ([]ChatMatch, error) {
+	query := `SELECT c.id, c.title, COALESCE(m.id, 0), COALESCE(m.content, '')
+		FROM chats c
+		LEFT JOIN messages m ON m.id = (
+			SELECT id FROM messages WHERE chat_id = c.id AND content LIKE ?1 ESCAPE '\' ORDER BY position, id LIMIT 1)
+		WHERE c.title LIKE ?1 ESCAPE '\' OR m.id IS NOT NULL
+		ORDER BY c.updated_at DESC LIMIT ?2;`
+	pattern := "%" + likeEscaper.Replace(text) + "%"
+	rows, err := db.Query(query, pattern, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search chats: %w", err)
+	}
+	defer rows.Close()
+
+	var matches []ChatMatch
+	for rows.Next() {
+		var m ChatMatch
+		var content string
+		if err := rows.Scan(&m.ChatID, &m.Title, &m.MessageID, &content); err != nil {
+			return nil, fmt.Errorf("failed to scan chat: %w", err)
+		}
+		if m.MessageID == 0 {
+			content = m.Title
+		}
+		m.Snippet = snippet(content, text, 80)
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// snippet returns up to width bytes of content either side of the first
+// case-insensitive match of text, on one line, with the match marked
+func snippet(content, text string, width int) string {
+	i := strings.Index(strings.ToLower(content), strings.ToLower(text))
+	if i < 0 || text == "" || i+len(text) > len(content) {
+		return strings.Join(strings.Fields(truncate(content, 2*width)), " ")
+	}
+	start, end := i-width, i+len(text)+width
+	if start < 0 {
+		start = 0
+	}
+	if end > len(content) {
+		end = len(content)
+	}
+	for start > 0 && !utf8.RuneStart(content[start]) {
+		start--
+	}
+	for end < len(content) && !utf8.RuneStart(content[end]) {
+		end++
+	}
+
+	marked := content[start:i] + MatchStart + content[i:i+len(text)] + MatchEnd + content[i+len(text):end]
+	s := strings.Join(strings.Fields(marked), " ")
+	if start > 0 {
+		s = "..." + s
+	}
+	if end < len(content) {
+		s += "..."
+	}
+	return s
+}
+
+// truncate cuts s to at most n bytes without splitting a character
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,162 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Utility-Gods/gottem/pkg/types"
+)
+
+func TestFTSQuery(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"", ""},
+		{"   ", ""},
+		{"go", `"go"*`},
+		{"rate  limit", `"rate" "limit"*`},
+		{`say "hi"`, `"say" """hi"""*`},
+		{"NOT a-b OR c*", `"NOT" "a-b" "OR" "c*"*`},
+	}
+	for _, tt := range tests {
+		if got := ftsQuery(tt.text); got != tt.want {
+			t.Errorf("ftsQuery(%q) = %s, want %s", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		text    string
+		width   int
+		want    string
+	}{
+		{"whole content", "Hello World", "world", 80, "Hello " + MatchStart + "World" + MatchEnd},
+		{"cut either side", "aaaa bbbb needle cccc dddd", "needle", 5, "...bbbb " + MatchStart + "needle" + MatchEnd + " cccc..."},
+		{"one line", "first\n\nneedle\tlast", "needle", 80, "first " + MatchStart + "needle" + MatchEnd + " last"},
+		{"does not split characters", "ééééé needle", "needle", 4, "...éé " + MatchStart + "needle" + MatchEnd},
+		{"no match", "nothing\nhere", "needle", 80, "nothing here"},
+		{"no text", "content", "", 80, "content"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := snippet(tt.content, tt.text, tt.width); got != tt.want {
+				t.Errorf("snippet = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"hello", 10, "hello"},
+		{"hello", 5, "hello"},
+		{"hello", 3, "hel..."},
+		{"héllo", 2, "h..."},
+		{"日本", 4, "日..."},
+	}
+	for _, tt := range tests {
+		if got := truncate(tt.s, tt.n); got != tt.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestChatMatchHighlight(t *testing.T) {
+	m := ChatMatch{Snippet: "use " + MatchStart + "Go" + MatchEnd + " for " + MatchStart + "tools" + MatchEnd}
+	if got := m.Highlight("[", "]"); got != "use [Go] for [tools]" {
+		t.Errorf("Highlight = %q", got)
+	}
+	if got := m.Terms(); !reflect.DeepEqual(got, []string{"Go", "tools"}) {
+		t.Errorf("Terms = %q", got)
+	}
+	if got := (ChatMatch{Snippet: "no match"}).Terms(); got != nil {
+		t.Errorf("Terms without a match = %q", got)
+	}
+}
+
+// TestSearchChats runs against the full-text index when built with the
+// sqlite_fts5 tag and against the substring search otherwise
+func TestSearchChats(t *testing.T) {
+	latest, err := LatestSchemaVersion()
+	if err != nil {
+		t.Fatalf("LatestSchemaVersion: %v", err)
+	}
+	migrateTestDB(t, latest)
+	if err := EnsureSearchIndex(); err != nil {
+		t.Fatalf("EnsureSearchIndex: %v", err)
+	}
+	t.Cleanup(func() { searchIndexed = false })
+
+	goChat, err := CreateChat("Go questions")
+	if err != nil {
+		t.Fatalf("CreateChat: %v", err)
+	}
+	otherChat, err := CreateChat("Dinner plans")
+	if err != nil {
+		t.Fatalf("CreateChat: %v", err)
+	}
+	messages := []Message{
+		{ChatID: goChat, Role: types.RoleUser, Content: "How do channels work?"},
+		{ChatID: otherChat, Role: types.RoleUser, Content: "Pasta or curry tonight?"},
+		{ChatID: otherChat, Role: types.RoleAssistant, Content: "Curry, with channels of flavour."},
+	}
+	for _, m := range messages {
+		if _, err := AddMessage(m); err != nil {
+			t.Fatalf("AddMessage: %v", err)
+		}
+	}
+
+	matches, err := SearchChats("curry", 10)
+	if err != nil {
+		t.Fatalf("SearchChats: %v", err)
+	}
+	if len(matches) == 0 || matches[0].ChatID != otherChat || matches[0].MessageID == 0 {
+		t.Fatalf("SearchChats(curry) = %+v", matches)
+	}
+	for _, m := range matches {
+		if terms := m.Terms(); len(terms) == 0 {
+			t.Errorf("match %+v marks no terms", m)
+		}
+	}
+
+	matches, err = SearchChats("questions", 10)
+	if err != nil {
+		t.Fatalf("SearchChats: %v", err)
+	}
+	if len(matches) != 1 || matches[0].ChatID != goChat || matches[0].MessageID != 0 {
+		t.Errorf("a title match gave %+v", matches)
+	}
+
+	// Renaming a chat and deleting it keep the search up to date
+	if err := UpdateChatTitle(goChat, "Rust questions"); err != nil {
+		t.Fatalf("UpdateChatTitle: %v", err)
+	}
+	if matches, err := SearchChats("rust", 10); err != nil || len(matches) != 1 {
+		t.Errorf("after renaming, SearchChats(rust) = %+v, %v", matches, err)
+	}
+	if err := DeleteChat(otherChat); err != nil {
+		t.Fatalf("DeleteChat: %v", err)
+	}
+	if matches, err := SearchChats("curry", 10); err != nil || len(matches) != 0 {
+		t.Errorf("a deleted chat was still found: %+v, %v", matches, err)
+	}
+
+	if !searchIndexed {
+		return
+	}
+	// Only the index matches other forms of a word
+	if matches, err := SearchChats("working channel", 10); err != nil || len(matches) != 1 || matches[0].MessageID == 0 {
+		t.Errorf("SearchChats(working channel) = %+v, %v, want the message about channels", matches, err)
+	}
+	if matches, err := SearchChats("quest", 10); err != nil || len(matches) != 1 {
+		t.Errorf("a prefix search gave %+v, %v", matches, err)
+	}
+}
@@ -0,0 +1,235 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// UsageRecord is the token usage and cost of a single request
+type UsageRecord struct {
+	ChatID       int
+	Provider     string
+	Model        string
+	InputTokens  int
+	OutputTokens int
+	Latency      time.Duration
+	Cost         float64 // US dollars, worked out by RecordUsage
+}
+
+// UsageTotals adds up the usage of a number of requests
+type UsageTotals struct {
+	Requests     int
+	InputTokens  int
+	OutputTokens int
+	Cost         float64
+}
+
+// UsageReportRow is one line of a usage report, such as a provider or a day
+type UsageReportRow struct {
+	Key string
+	UsageTotals
+}
+
+// ModelPrice is the price of a model in US dollars per million tokens. It
+// applies to every model whose name starts with Model.
+type ModelPrice struct {
+	Model       string
+	InputPrice  float64
+	OutputPrice float64
+}
+
+// RecordUsage prices a request using the model price table and saves it. It
+// returns the record with its cost filled in. Models without a price cost
+// nothing.
+func RecordUsage(record UsageRecord) (UsageRecord, error) {
+	price, err := GetModelPrice(record.Model)
+	if err != nil {
+		return record, err
+	}
+	record.Cost = (float64(record.InputTokens)*price.InputPrice + float64(record.OutputTokens)*price.OutputPrice) / 1e6
+
+	query := `INSERT INTO usage (chat_id, provider, model, input_tokens, output_tokens, latency_ms, cost)
+		VALUES (?, ?, ?, ?, ?, ?, ?);`
+	_, err = db.Exec(query, record.ChatID, record.Provider, record.Model, record.InputTokens, record.OutputTokens,
+		record.Latency.Milliseconds(), record.Cost)
+	if err != nil {
+		return record, fmt.Errorf("failed to record usage: %w", err)
+	}
+	return record, nil
+}
+
+// GetChatUsage returns the running totals for a chat
+func GetChatUsage(chatID int) (UsageTotals, error) {
+	query := `SELECT COUNT(*), COALESCE(SUM(input_tokens), 0), COALESCE(SUM(output_tokens), 0), COALESCE(SUM(cost), 0)
+		FROM usage WHERE chat_id = ?;`
+	var totals UsageTotals
+	err := db.QueryRow(query, chatID).Scan(&totals.Requests, &totals.InputTokens, &totals.OutputTokens, &totals.Cost)
+	if err != nil {
+		return UsageTotals{}, fmt.Errorf("failed to get chat usage: %w", err)
+	}
+	return totals, nil
+}
+
+// GetUsageByProvider totals all recorded usage per provider, most expensive
+// first
+func GetUsageByProvider() ([]UsageReportRow, error) {
+	return usageReport(`SELECT provider, COUNT(*), SUM(input_tokens), SUM(output_tokens), SUM(cost)
+		FROM usage GROUP BY provider ORDER BY SUM(cost) DESC, provider;`)
+}
+
+// GetUsageByDay totals the usage of the last days days, in local time, most
+// recent first
+func GetUsageByDay(days int) ([]UsageReportRow, error) {
+	return usageReport(`SELECT date(created_at, 'localtime') AS day, COUNT(*), SUM(input_tokens), SUM(output_tokens), SUM(cost)
+		FROM usage WHERE created_at >= datetime('now', ?) GROUP BY day ORDER BY day DESC;`,
+		fmt.Sprintf("-%d days", days))
+}
+
+func usageReport(query string, args ...interface{}) ([]UsageReportRow, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage: %w", err)
+	}
+	defer rows.Close()
+
+	var report []UsageReportRow
+	for rows.Next() {
+		var row UsageReportRow
+		if err := rows.Scan(&row.Key, &row.Requests, &row.InputTokens, &row.OutputTokens, &row.Cost); err != nil {
+			return nil, fmt.Errorf("failed to scan usage: %w", err)
+		}
+		report = append(report, row)
+	}
+
+	return report, rows.Err()
+}
+
+// GetModelPrice returns the price with the longest name that model starts
+// with, or a zero price if there is none
+func GetModelPrice(model string) (ModelPrice, error) {
+	query := `SELECT model, input_price, output_price FROM model_prices
+		WHERE substr(?, 1, length(model)) = model ORDER BY length(model) DESC LIMIT 1;`
+	var price ModelPrice
+	err := db.QueryRow(query, model).Scan(&price.Model, &price.InputPrice, &price.OutputPrice)
+	if err == sql.ErrNoRows {
+		return ModelPrice{}, nil
+	}
+	if err != nil {
+		return ModelPrice{}, fmt.Errorf("failed to get price for %s: %w", model, err)
+	}
+	return price, nil
+}
+
+func GetModelPrices() ([]ModelPrice, error) {
+	query := `SELECT model, input_price, output_price FROM model_prices ORDER BY model;`
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query model prices: %w", err)
+	}
+	defer rows.Close()
+
+	var prices []ModelPrice
+	for rows.Next() {
+		var price ModelPrice
+		if err := rows.Scan(&price.Model, &price.InputPrice, &price.OutputPrice); err != nil {
+			return nil, fmt.Errorf("failed to scan model price: %w", err)
+		}
+		prices = append(prices, price)
+	}
+
+	return prices, rows.Err()
+}
+
+func SaveModelPrice(price ModelPrice) error {
+	query := `INSERT OR REPLACE INTO model_prices (model, input_price, output_price) VALUES (?, ?, ?);`
+	_, err := db.Exec(query, price.Model, price.InputPrice, price.OutputPrice)
+	if err != nil {
+		return fmt.Errorf("failed to save price for %s: %w", price.Model, err)
+	}
+	return nil
+}
+
+func DeleteModelPrice(model string) error {
+	query := `DELETE FROM model_prices WHERE model = ?;`
+	_, err := db.Exec(query, model)
+	if err != nil {
+		return fmt.Errorf("failed to delete price for %s: %w", model, err)
+	}
+	return nil
+}
+
+// Budget is a monthly spending limit in US dollars. An empty Provider is the
+// overall budget. Spending past Soft warns, and a request that would go past
+// Hard is refused. Zero limits are not enforced.
+type Budget struct {
+	Provider string
+	Soft     float64
+	Hard     float64
+}
+
+// GetBudget returns the budget for a provider, or a zero budget if none is
+// set
+func GetBudget(provider string) (Budget, error) {
+	query := `SELECT provider, soft_limit, hard_limit FROM budgets WHERE provider = ?;`
+	var budget Budget
+	err := db.QueryRow(query, provider).Scan(&budget.Provider, &budget.Soft, &budget.Hard)
+	if err == sql.ErrNoRows {
+		return Budget{Provider: provider}, nil
+	}
+	if err != nil {
+		return Budget{}, fmt.Errorf("failed to get budget: %w", err)
+	}
+	return budget, nil
+}
+
+func GetBudgets() ([]Budget, error) {
+	query := `SELECT provider, soft_limit, hard_limit FROM budgets ORDER BY provider;`
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query budgets: %w", err)
+	}
+	defer rows.Close()
+
+	var budgets []Budget
+	for rows.Next() {
+		var budget Budget
+		if err := rows.Scan(&budget.Provider, &budget.Soft, &budget.Hard); err != nil {
+			return nil, fmt.Errorf("failed to scan budget: %w", err)
+		}
+		budgets = append(budgets, budget)
+	}
+
+	return budgets, rows.Err()
+}
+
+func SaveBudget(budget Budget) error {
+	query := `INSERT OR REPLACE INTO budgets (provider, soft_limit, hard_limit) VALUES (?, ?, ?);`
+	_, err := db.Exec(query, budget.Provider, budget.Soft, budget.Hard)
+	if err != nil {
+		return fmt.Errorf("failed to save budget: %w", err)
+	}
+	return nil
+}
+
+func DeleteBudget(provider string) error {
+	query := `DELETE FROM budgets WHERE provider = ?;`
+	_, err := db.Exec(query, provider)
+	if err != nil {
+		return fmt.Errorf("failed to delete budget: %w", err)
+	}
+	return nil
+}
+
+// GetMonthSpend returns what a provider has cost so far this calendar month,
+// in local time. An empty provider totals every provider.
+func GetMonthSpend(provider string) (float64, error) {
+	query := `SELECT COALESCE(SUM(cost), 0) FROM usage
+		WHERE date(created_at, 'localtime') >= date('now', 'localtime', 'start of month')
+		AND (? = '' OR provider = ?);`
+	var spent float64
+	if err := db.QueryRow(query, provider, provider).Scan(&spent); err != nil {
+		return 0, fmt.Errorf("failed to get monthly spend: %w", err)
+	}
+	return spent, nil
+}
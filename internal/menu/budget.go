@@ -0,0 +1,228 @@
+package menu
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/Utility-Gods/gottem/internal/api"
+	"github.com/Utility-Gods/gottem/internal/db"
+	"github.com/manifoldco/promptui"
+)
+
+const overallBudget = "Overall"
+
+// BudgetMenu manages the monthly spending budgets
+func BudgetMenu() {
+	for {
+		prompt := promptui.Select{
+			Label: "Budgets",
+			Items: []string{"Set Budget", "View Budgets", "Delete Budget", "Back to Settings"},
+		}
+
+		_, result, err := prompt.Run()
+		if err != nil {
+			fmt.Printf("Prompt failed %v\n", err)
+			return
+		}
+
+		switch result {
+		case "Set Budget":
+			SetBudget()
+		case "View Budgets":
+			ViewBudgets()
+		case "Delete Budget":
+			DeleteBudget()
+		case "Back to Settings":
+			return
+		}
+	}
+}
+
+func SetBudget() {
+	fmt.Println("\nBudgets are monthly limits in US dollars, per provider or across all providers.")
+	fmt.Println("Past the soft limit queries still go out with a warning. A query that would cross the hard limit is refused.")
+
+	provider, err := selectBudgetProvider()
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+		return
+	}
+
+	current, err := db.GetBudget(provider)
+	if err != nil {
+		fmt.Printf("Error retrieving budget: %v\n", err)
+		return
+	}
+
+	soft, err := promptAmount("Soft limit (0 for none)", current.Soft)
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+		return
+	}
+
+	hard, err := promptAmount("Hard limit (0 for none)", current.Hard)
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+		return
+	}
+
+	if err := db.SaveBudget(db.Budget{Provider: provider, Soft: soft, Hard: hard}); err != nil {
+		fmt.Printf("Failed to save budget: %v\n", err)
+		return
+	}
+	fmt.Printf("%s budget saved.\n", budgetName(provider))
+}
+
+// selectBudgetProvider picks the overall budget or a provider by the name its
+// usage is recorded under. The empty string is the overall budget.
+func selectBudgetProvider() (string, error) {
+	items := []string{overallBudget, "Claude API", api.OpenAIConfig.Name, api.GroqConfig.Name}
+	seen := make(map[string]bool)
+	for _, item := range items {
+		seen[item] = true
+	}
+
+	var names []string
+	if providers, err := db.GetCompatibleProviders(); err == nil {
+		for _, p := range providers {
+			names = append(names, p.Name)
+		}
+	}
+	if report, err := db.GetUsageByProvider(); err == nil {
+		for _, row := range report {
+			names = append(names, row.Key)
+		}
+	}
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			items = append(items, name)
+		}
+	}
+	items = append(items, "Other...")
+
+	prompt := promptui.Select{
+		Label: "Select budget",
+		Items: items,
+	}
+	_, result, err := prompt.Run()
+	if err != nil {
+		return "", err
+	}
+
+	switch result {
+	case overallBudget:
+		return "", nil
+	case "Other...":
+		namePrompt := promptui.Prompt{Label: "Provider name, as shown in the API picker"}
+		return namePrompt.Run()
+	}
+	return result, nil
+}
+
+func ViewBudgets() {
+	budgets, err := db.GetBudgets()
+	if err != nil {
+		fmt.Printf("Error retrieving budgets: %v\n", err)
+		return
+	}
+
+	if len(budgets) == 0 {
+		fmt.Println("No budgets configured.")
+		return
+	}
+
+	fmt.Println("\n--- Budgets (USD per month) ---")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Budget\tSpent\tSoft\tHard")
+	for _, budget := range budgets {
+		spent, err := db.GetMonthSpend(budget.Provider)
+		if err != nil {
+			fmt.Printf("Error retrieving spend: %v\n", err)
+			return
+		}
+		fmt.Fprintf(w, "%s\t$%.2f\t%s\t%s\n", budgetName(budget.Provider), spent, formatLimit(budget.Soft), formatLimit(budget.Hard))
+	}
+	w.Flush()
+	fmt.Println()
+
+	prompt := promptui.Prompt{
+		Label:     "Press Enter to continue",
+		IsConfirm: true,
+	}
+	_, err = prompt.Run()
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+	}
+}
+
+func DeleteBudget() {
+	budgets, err := db.GetBudgets()
+	if err != nil {
+		fmt.Printf("Error retrieving budgets: %v\n", err)
+		return
+	}
+
+	if len(budgets) == 0 {
+		fmt.Println("No budgets configured.")
+		return
+	}
+
+	var items []string
+	for _, budget := range budgets {
+		items = append(items, budgetName(budget.Provider))
+	}
+	items = append(items, "Cancel")
+
+	prompt := promptui.Select{
+		Label: "Select budget to delete",
+		Items: items,
+	}
+
+	i, result, err := prompt.Run()
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+		return
+	}
+
+	if result == "Cancel" {
+		return
+	}
+
+	if err := db.DeleteBudget(budgets[i].Provider); err != nil {
+		fmt.Printf("Error deleting budget: %v\n", err)
+		return
+	}
+	fmt.Printf("%s budget deleted.\n", result)
+}
+
+// monthSpendLabel summarises this month's spending for the main menu
+func monthSpendLabel() string {
+	spent, err := db.GetMonthSpend("")
+	if err != nil {
+		return ""
+	}
+
+	label := fmt.Sprintf("This month: $%.2f", spent)
+	if budget, err := db.GetBudget(""); err == nil && budget.Hard > 0 {
+		label += fmt.Sprintf(" of $%.2f", budget.Hard)
+	} else if err == nil && budget.Soft > 0 {
+		label += fmt.Sprintf(" of $%.2f", budget.Soft)
+	}
+	return label
+}
+
+func budgetName(provider string) string {
+	if provider == "" {
+		return overallBudget
+	}
+	return provider
+}
+
+func formatLimit(limit float64) string {
+	if limit <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("$%.2f", limit)
+}
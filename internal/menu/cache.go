@@ -0,0 +1,89 @@
+package menu
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Utility-Gods/gottem/internal/api"
+	"github.com/Utility-Gods/gottem/internal/db"
+	"github.com/manifoldco/promptui"
+)
+
+// CacheMenu shows the response cache statistics, sets how long answers are
+// reused and purges old answers
+func CacheMenu() {
+	for {
+		prompt := promptui.Select{
+			Label: "Response Cache",
+			Items: []string{"View Cache Statistics", "Set Cache TTL", "Purge Expired Entries", "Purge All Entries", "Back to Settings"},
+		}
+
+		_, result, err := prompt.Run()
+		if err != nil {
+			fmt.Printf("Prompt failed %v\n", err)
+			return
+		}
+
+		switch result {
+		case "View Cache Statistics":
+			ViewCacheStats()
+		case "Set Cache TTL":
+			SetCacheTTL()
+		case "Purge Expired Entries":
+			purgeCache(api.LoadCacheTTL())
+		case "Purge All Entries":
+			purgeCache(0)
+		case "Back to Settings":
+			return
+		}
+	}
+}
+
+func ViewCacheStats() {
+	ttl := api.LoadCacheTTL()
+	stats, err := db.GetCacheStats(ttl)
+	if err != nil {
+		fmt.Printf("Error retrieving cache statistics: %v\n", err)
+		return
+	}
+
+	fmt.Println("\n--- Response Cache ---")
+	fmt.Printf("TTL: %s\n", ttl)
+	fmt.Printf("Entries: %d (%d expired)\n", stats.Entries, stats.Expired)
+	fmt.Printf("Hits: %d\n", stats.Hits)
+	fmt.Printf("Size: %.1f KB\n\n", float64(stats.Bytes)/1024)
+
+	prompt := promptui.Prompt{
+		Label:     "Press Enter to continue",
+		IsConfirm: true,
+	}
+	_, err = prompt.Run()
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+	}
+}
+
+func SetCacheTTL() {
+	ttl, err := promptDuration("Reuse cached responses for", api.LoadCacheTTL())
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+		return
+	}
+
+	if err := api.SaveCacheTTL(ttl); err != nil {
+		fmt.Printf("Failed to save cache TTL: %v\n", err)
+		return
+	}
+	fmt.Printf("Cached responses are reused for %s.\n", ttl)
+}
+
+// purgeCache deletes the cached responses older than ttl, or all of them
+// when ttl is zero
+func purgeCache(ttl time.Duration) {
+	deleted, err := db.PurgeCache(ttl)
+	if err != nil {
+		fmt.Printf("Failed to purge the response cache: %v\n", err)
+		return
+	}
+	fmt.Printf("Deleted %d cached responses.\n", deleted)
+}
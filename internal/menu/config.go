@@ -0,0 +1,92 @@
+package menu
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/Utility-Gods/gottem/internal/api"
+	"github.com/Utility-Gods/gottem/internal/config"
+	"github.com/Utility-Gods/gottem/internal/db"
+	"github.com/manifoldco/promptui"
+)
+
+// ViewConfigSources shows where each API key and setting comes from: the
+// environment, the config file or the database
+func ViewConfigSources() {
+	fmt.Println("\n--- Configuration Sources ---")
+	path := config.Path()
+	loadErr := config.Load()
+	_, statErr := os.Stat(path)
+	switch {
+	case loadErr != nil:
+		fmt.Printf("Config file: %s (%v)\n", path, loadErr)
+	case os.IsNotExist(statErr):
+		fmt.Printf("Config file: %s (not found)\n", path)
+	default:
+		fmt.Printf("Config file: %s\n", path)
+	}
+
+	keys, err := api.APIKeySources()
+	if err != nil {
+		fmt.Printf("Error retrieving API keys: %v\n", err)
+		return
+	}
+
+	fmt.Println("\nAPI keys come from GOTTEM_<NAME>_API_KEY, the provider's own variable, the config file or the database, in that order.")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "API Key\tSource")
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s\t%s\n", key.Name, key)
+	}
+	w.Flush()
+
+	stored, err := db.GetStoredSettings()
+	if err != nil {
+		fmt.Printf("Error retrieving settings: %v\n", err)
+		return
+	}
+	fromFile := config.Settings()
+
+	var names []string
+	for name := range stored {
+		names = append(names, name)
+	}
+	for name := range fromFile {
+		if _, ok := stored[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	fmt.Println("\nSettings in the config file take precedence over those saved here.")
+	if len(names) == 0 {
+		fmt.Println("No settings changed from their defaults.")
+	} else {
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "Setting\tValue\tSource")
+		for _, name := range names {
+			if value, ok := fromFile[name]; ok {
+				source := "config file"
+				if _, ok := stored[name]; ok {
+					source += ", overrides database"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\n", name, value, source)
+				continue
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", name, stored[name], "database")
+		}
+		w.Flush()
+	}
+	fmt.Println()
+
+	prompt := promptui.Prompt{
+		Label:     "Press Enter to continue",
+		IsConfirm: true,
+	}
+	_, err = prompt.Run()
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+	}
+}
@@ -0,0 +1,156 @@
+package menu
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Utility-Gods/gottem/internal/db"
+	"github.com/manifoldco/promptui"
+)
+
+// FallbackMenu manages provider fallback chains
+func FallbackMenu() {
+	for {
+		prompt := promptui.Select{
+			Label: "Fallback Chains",
+			Items: []string{"Add Chain", "View Chains", "Delete Chain", "Back to Settings"},
+		}
+
+		_, result, err := prompt.Run()
+		if err != nil {
+			fmt.Printf("Prompt failed %v\n", err)
+			return
+		}
+
+		switch result {
+		case "Add Chain":
+			AddFallbackChain()
+		case "View Chains":
+			ViewFallbackChains()
+		case "Delete Chain":
+			DeleteFallbackChain()
+		case "Back to Settings":
+			return
+		}
+	}
+}
+
+func AddFallbackChain() {
+	fmt.Println("\nA fallback chain tries each API in order until one answers.")
+	fmt.Println("Built-in shortcuts: c (Claude), o (OpenAI), g (Groq), l (Ollama), L (llama.cpp).")
+
+	namePrompt := promptui.Prompt{Label: "Name (e.g. Reliable)"}
+	name, err := namePrompt.Run()
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+		return
+	}
+
+	shortcutPrompt := promptui.Prompt{Label: "Shortcut (must not clash with another API)"}
+	shortcut, err := shortcutPrompt.Run()
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+		return
+	}
+
+	membersPrompt := promptui.Prompt{Label: "API shortcuts in order, comma separated (e.g. c,o,l)"}
+	members, err := membersPrompt.Run()
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+		return
+	}
+
+	chain := db.FallbackChain{
+		Name:     strings.TrimSpace(name),
+		Shortcut: strings.TrimSpace(shortcut),
+	}
+	for _, member := range strings.Split(members, ",") {
+		if member = strings.TrimSpace(member); member != "" {
+			chain.Members = append(chain.Members, member)
+		}
+	}
+
+	if chain.Name == "" || chain.Shortcut == "" || len(chain.Members) == 0 {
+		fmt.Println("Name, shortcut and at least one API are required.")
+		return
+	}
+	for _, member := range chain.Members {
+		if member == chain.Shortcut {
+			fmt.Println("A chain cannot include itself.")
+			return
+		}
+	}
+
+	if err := db.SaveFallbackChain(chain); err != nil {
+		fmt.Printf("Failed to save fallback chain: %v\n", err)
+		return
+	}
+	fmt.Printf("%s saved successfully.\n", chain.Name)
+}
+
+func ViewFallbackChains() {
+	chains, err := db.GetFallbackChains()
+	if err != nil {
+		fmt.Printf("Error retrieving fallback chains: %v\n", err)
+		return
+	}
+
+	if len(chains) == 0 {
+		fmt.Println("No fallback chains configured.")
+		return
+	}
+
+	fmt.Println("\n--- Fallback Chains ---")
+	for _, chain := range chains {
+		fmt.Printf("Name: %s\nShortcut: %s\nOrder: %s\n\n", chain.Name, chain.Shortcut, strings.Join(chain.Members, " → "))
+	}
+
+	prompt := promptui.Prompt{
+		Label:     "Press Enter to continue",
+		IsConfirm: true,
+	}
+	_, err = prompt.Run()
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+	}
+}
+
+func DeleteFallbackChain() {
+	chains, err := db.GetFallbackChains()
+	if err != nil {
+		fmt.Printf("Error retrieving fallback chains: %v\n", err)
+		return
+	}
+
+	if len(chains) == 0 {
+		fmt.Println("No fallback chains configured.")
+		return
+	}
+
+	var items []string
+	for _, chain := range chains {
+		items = append(items, chain.Name)
+	}
+	items = append(items, "Cancel")
+
+	prompt := promptui.Select{
+		Label: "Select fallback chain to delete",
+		Items: items,
+	}
+
+	_, result, err := prompt.Run()
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+		return
+	}
+
+	if result == "Cancel" {
+		return
+	}
+
+	if err := db.DeleteFallbackChain(result); err != nil {
+		fmt.Printf("Error deleting fallback chain: %v\n", err)
+		return
+	}
+	fmt.Printf("%s deleted successfully.\n", result)
+}
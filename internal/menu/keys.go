@@ -0,0 +1,238 @@
+package menu
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Utility-Gods/gottem/internal/db"
+	"github.com/manifoldco/promptui"
+)
+
+// maxUnlockAttempts is how many times the passphrase may be mistyped before
+// giving up
+const maxUnlockAttempts = 3
+
+// KeyEncryptionMenu manages the passphrase that encrypts the API keys
+func KeyEncryptionMenu() {
+	for {
+		prompt := promptui.Select{
+			Label: "Key Encryption",
+			Items: []string{"Change Passphrase", "Set Idle Timeout", "Lock Keys Now", "Reset Passphrase", "Back to Settings"},
+		}
+
+		_, result, err := prompt.Run()
+		if err != nil {
+			fmt.Printf("Prompt failed %v\n", err)
+			return
+		}
+
+		switch result {
+		case "Change Passphrase":
+			ChangePassphrase()
+		case "Set Idle Timeout":
+			SetKeyIdleTimeout()
+		case "Lock Keys Now":
+			db.Lock()
+			fmt.Println("API keys locked. The passphrase is needed to use them again.")
+		case "Reset Passphrase":
+			ResetPassphrase()
+		case "Back to Settings":
+			return
+		}
+	}
+}
+
+// UnlockKeys makes sure the API keys can be read, asking for the passphrase
+// if they are locked. Keys stored in plain text by older versions need a
+// passphrase to be chosen first. It returns false if the keys stay locked.
+func UnlockKeys() bool {
+	hasPassphrase, err := db.HasPassphrase()
+	if err != nil {
+		fmt.Printf("Error checking the passphrase: %v\n", err)
+		return false
+	}
+
+	if !hasPassphrase {
+		plain, err := db.HasPlainKeys()
+		if err != nil {
+			fmt.Printf("Error checking API keys: %v\n", err)
+			return false
+		}
+		if !plain {
+			return true
+		}
+		fmt.Println("Your API keys are stored in plain text. Choose a passphrase to encrypt them.")
+		return choosePassphrase()
+	}
+
+	if !db.Locked() {
+		return true
+	}
+
+	for attempt := 1; attempt <= maxUnlockAttempts; attempt++ {
+		prompt := promptui.Prompt{
+			Label: "Passphrase to unlock API keys",
+			Mask:  '*',
+		}
+		passphrase, err := prompt.Run()
+		if err != nil {
+			fmt.Println("API keys stay locked, hosted APIs are unavailable until they are unlocked.")
+			return false
+		}
+
+		err = db.Unlock(passphrase)
+		if err == nil {
+			return true
+		}
+		if !errors.Is(err, db.ErrWrongPassphrase) {
+			fmt.Printf("Failed to unlock API keys: %v\n", err)
+			return false
+		}
+		fmt.Printf("Wrong passphrase (attempt %d/%d).\n", attempt, maxUnlockAttempts)
+	}
+
+	fmt.Println("API keys stay locked. If you forgot the passphrase, reset it under Settings → Key Encryption.")
+	return false
+}
+
+// requirePassphrase makes sure a key can be saved, choosing the first
+// passphrase or unlocking the keys as needed
+func requirePassphrase() bool {
+	hasPassphrase, err := db.HasPassphrase()
+	if err != nil {
+		fmt.Printf("Error checking the passphrase: %v\n", err)
+		return false
+	}
+	if !hasPassphrase {
+		fmt.Println("API keys are encrypted with a passphrase. Choose one now; you will enter it once per session.")
+		return choosePassphrase()
+	}
+	return UnlockKeys()
+}
+
+func ChangePassphrase() {
+	hasPassphrase, err := db.HasPassphrase()
+	if err != nil {
+		fmt.Printf("Error checking the passphrase: %v\n", err)
+		return
+	}
+
+	if hasPassphrase {
+		prompt := promptui.Prompt{
+			Label: "Current passphrase",
+			Mask:  '*',
+		}
+		current, err := prompt.Run()
+		if err != nil {
+			fmt.Printf("Prompt failed %v\n", err)
+			return
+		}
+		if err := db.Unlock(current); err != nil {
+			fmt.Printf("Failed to verify the passphrase: %v\n", err)
+			return
+		}
+	}
+
+	if choosePassphrase() {
+		fmt.Println("Passphrase changed. All API keys are encrypted with the new one.")
+	}
+}
+
+// choosePassphrase asks for a new passphrase twice and encrypts the API keys
+// with it
+func choosePassphrase() bool {
+	prompt := promptui.Prompt{
+		Label: "New passphrase",
+		Mask:  '*',
+		Validate: func(input string) error {
+			if input == "" {
+				return fmt.Errorf("the passphrase cannot be empty")
+			}
+			return nil
+		},
+	}
+	passphrase, err := prompt.Run()
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+		return false
+	}
+
+	confirm := promptui.Prompt{
+		Label: "Repeat the passphrase",
+		Mask:  '*',
+	}
+	repeated, err := confirm.Run()
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+		return false
+	}
+	if repeated != passphrase {
+		fmt.Println("The passphrases do not match.")
+		return false
+	}
+
+	if err := db.ChangePassphrase(passphrase); err != nil {
+		fmt.Printf("Failed to set the passphrase: %v\n", err)
+		return false
+	}
+	return true
+}
+
+func SetKeyIdleTimeout() {
+	current, err := db.KeyIdleTimeout()
+	if err != nil {
+		fmt.Printf("Error retrieving the idle timeout: %v\n", err)
+		return
+	}
+
+	fmt.Println("\nAPI keys lock again after going unused for this long. Enter 0 to keep them unlocked until you exit.")
+	prompt := promptui.Prompt{
+		Label:   "Lock API keys after",
+		Default: current.String(),
+		Validate: func(input string) error {
+			d, err := time.ParseDuration(input)
+			if err != nil || d < 0 {
+				return fmt.Errorf("enter a duration such as 15m, or 0")
+			}
+			return nil
+		},
+	}
+	value, err := prompt.Run()
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+		return
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		fmt.Printf("Invalid duration: %v\n", err)
+		return
+	}
+
+	if err := db.SetKeyIdleTimeout(timeout); err != nil {
+		fmt.Printf("Failed to save the idle timeout: %v\n", err)
+		return
+	}
+	if timeout == 0 {
+		fmt.Println("API keys stay unlocked until you exit.")
+		return
+	}
+	fmt.Printf("API keys lock after %s without use.\n", timeout)
+}
+
+func ResetPassphrase() {
+	confirm := promptui.Prompt{
+		Label:     "This deletes all saved API keys so you can choose a new passphrase. Continue",
+		IsConfirm: true,
+	}
+	if _, err := confirm.Run(); err != nil {
+		fmt.Println("Reset cancelled.")
+		return
+	}
+
+	if err := db.ResetPassphrase(); err != nil {
+		fmt.Printf("Failed to reset the passphrase: %v\n", err)
+		return
+	}
+	fmt.Println("Passphrase and API keys deleted. Set your keys again to choose a new passphrase.")
+}
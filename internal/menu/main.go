@@ -10,9 +10,16 @@ import (
 
 // MainMenu starts the main menu loop
 func MainMenu() {
+	UnlockKeys()
+
 	for {
+		label := "Main Menu"
+		if spend := monthSpendLabel(); spend != "" {
+			label += " | " + spend
+		}
+
 		prompt := promptui.Select{
-			Label: "Main Menu",
+			Label: label,
 			Items: []string{"Run CLI", "Settings", "Exit"},
 		}
 
@@ -24,6 +31,8 @@ func MainMenu() {
 
 		switch result {
 		case "Run CLI":
+			// The keys may have locked again while the menu sat idle
+			UnlockKeys()
 			app := api.NewApp()
 			cli.RunCLI(app)
 		case "Settings":
@@ -0,0 +1,201 @@
+package menu
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Utility-Gods/gottem/internal/api"
+	"github.com/Utility-Gods/gottem/internal/db"
+	"github.com/manifoldco/promptui"
+)
+
+// NetworkMenu manages the per-provider base URL, timeout, proxy and CA
+// bundle
+func NetworkMenu() {
+	for {
+		prompt := promptui.Select{
+			Label: "Network Settings",
+			Items: []string{"Edit Network Settings", "View Network Settings", "Reset Network Settings", "Back to Settings"},
+		}
+
+		_, result, err := prompt.Run()
+		if err != nil {
+			fmt.Printf("Prompt failed %v\n", err)
+			return
+		}
+
+		switch result {
+		case "Edit Network Settings":
+			EditNetworkSettings()
+		case "View Network Settings":
+			ViewNetworkSettings()
+		case "Reset Network Settings":
+			ResetNetworkSettings()
+		case "Back to Settings":
+			return
+		}
+	}
+}
+
+func EditNetworkSettings() {
+	prompt := promptui.Select{
+		Label: "Select provider",
+		Items: api.NetworkProviders(),
+	}
+	_, provider, err := prompt.Run()
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+		return
+	}
+
+	settings, err := db.GetNetworkSettings(provider)
+	if err != nil {
+		fmt.Printf("Error retrieving network settings: %v\n", err)
+		return
+	}
+
+	fmt.Printf("\nLeave a field empty to use the default. Durations use Go syntax, for example 90s or 5m.\n")
+
+	baseURLPrompt := promptui.Prompt{Label: "Base URL", Default: settings.BaseURL}
+	settings.BaseURL, err = baseURLPrompt.Run()
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+		return
+	}
+
+	current := ""
+	if settings.Timeout > 0 {
+		current = settings.Timeout.String()
+	}
+	timeoutPrompt := promptui.Prompt{
+		Label:   "Time to wait for a response to start",
+		Default: current,
+		Validate: func(input string) error {
+			if input == "" {
+				return nil
+			}
+			d, err := time.ParseDuration(input)
+			if err != nil || d <= 0 {
+				return fmt.Errorf("enter a positive duration such as 90s")
+			}
+			return nil
+		},
+	}
+	timeout, err := timeoutPrompt.Run()
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+		return
+	}
+	settings.Timeout = 0
+	if timeout != "" {
+		settings.Timeout, _ = time.ParseDuration(timeout)
+	}
+
+	proxyPrompt := promptui.Prompt{Label: "Proxy URL (empty uses HTTPS_PROXY)", Default: settings.Proxy}
+	settings.Proxy, err = proxyPrompt.Run()
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+		return
+	}
+
+	caPrompt := promptui.Prompt{Label: "CA bundle (PEM file)", Default: settings.CAFile}
+	settings.CAFile, err = caPrompt.Run()
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+		return
+	}
+
+	settings.BaseURL = strings.TrimSpace(settings.BaseURL)
+	settings.Proxy = strings.TrimSpace(settings.Proxy)
+	settings.CAFile = strings.TrimSpace(settings.CAFile)
+	if err := api.SaveNetworkSettings(settings); err != nil {
+		fmt.Printf("Failed to save network settings: %v\n", err)
+		return
+	}
+	fmt.Printf("Network settings for %s saved. They apply the next time you run the CLI.\n", provider)
+}
+
+func ViewNetworkSettings() {
+	all, err := db.GetAllNetworkSettings()
+	if err != nil {
+		fmt.Printf("Error retrieving network settings: %v\n", err)
+		return
+	}
+
+	if len(all) == 0 {
+		fmt.Println("No network settings saved, every provider uses its defaults.")
+		return
+	}
+
+	fmt.Println("\n--- Network Settings ---")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Provider\tBase URL\tTimeout\tProxy\tCA Bundle")
+	for _, s := range all {
+		timeout := ""
+		if s.Timeout > 0 {
+			timeout = s.Timeout.String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", s.Provider, orDefault(s.BaseURL), orDefault(timeout), orDefault(s.Proxy), orDefault(s.CAFile))
+	}
+	w.Flush()
+	fmt.Println()
+
+	prompt := promptui.Prompt{
+		Label:     "Press Enter to continue",
+		IsConfirm: true,
+	}
+	_, err = prompt.Run()
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+	}
+}
+
+func ResetNetworkSettings() {
+	all, err := db.GetAllNetworkSettings()
+	if err != nil {
+		fmt.Printf("Error retrieving network settings: %v\n", err)
+		return
+	}
+
+	if len(all) == 0 {
+		fmt.Println("No network settings saved.")
+		return
+	}
+
+	var items []string
+	for _, s := range all {
+		items = append(items, s.Provider)
+	}
+	items = append(items, "Cancel")
+
+	prompt := promptui.Select{
+		Label: "Select provider to reset",
+		Items: items,
+	}
+
+	_, result, err := prompt.Run()
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+		return
+	}
+
+	if result == "Cancel" {
+		return
+	}
+
+	if err := db.DeleteNetworkSettings(result); err != nil {
+		fmt.Printf("Error resetting network settings: %v\n", err)
+		return
+	}
+	fmt.Printf("%s uses the default network settings again.\n", result)
+}
+
+func orDefault(value string) string {
+	if value == "" {
+		return "default"
+	}
+	return value
+}
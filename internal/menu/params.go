@@ -0,0 +1,95 @@
+package menu
+
+import (
+	"fmt"
+
+	"github.com/Utility-Gods/gottem/internal/api"
+	"github.com/Utility-Gods/gottem/internal/db"
+	"github.com/manifoldco/promptui"
+)
+
+// ChatParamsMenu edits the generation parameters and system prompt of a chat
+func ChatParamsMenu() {
+	chats, err := db.GetChats()
+	if err != nil {
+		fmt.Printf("Error retrieving chats: %v\n", err)
+		return
+	}
+
+	if len(chats) == 0 {
+		fmt.Println("No chats found.")
+		return
+	}
+
+	var items []string
+	for _, chat := range chats {
+		items = append(items, fmt.Sprintf("%d: %s", chat.ID, chat.Title))
+	}
+
+	chatPrompt := promptui.Select{
+		Label: "Select a chat",
+		Items: items,
+		Size:  10,
+	}
+
+	index, _, err := chatPrompt.Run()
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+		return
+	}
+	chat := chats[index]
+
+	params, err := db.GetChatParams(chat.ID)
+	if err != nil {
+		fmt.Printf("Error retrieving chat parameters: %v\n", err)
+		return
+	}
+
+	for {
+		var items []string
+		for _, name := range api.ParamNames {
+			items = append(items, fmt.Sprintf("%s: %s", name, api.FormatParam(params, name)))
+		}
+		items = append(items, "Back to Settings")
+
+		prompt := promptui.Select{
+			Label: fmt.Sprintf("Parameters for '%s'", chat.Title),
+			Items: items,
+		}
+
+		index, _, err := prompt.Run()
+		if err != nil {
+			fmt.Printf("Prompt failed %v\n", err)
+			return
+		}
+		if index == len(api.ParamNames) {
+			return
+		}
+		name := api.ParamNames[index]
+
+		valuePrompt := promptui.Prompt{
+			Label: fmt.Sprintf("Enter %s (leave empty for the provider default)", name),
+		}
+		value, err := valuePrompt.Run()
+		if err != nil {
+			fmt.Printf("Prompt failed %v\n", err)
+			return
+		}
+
+		if value == "" {
+			err = api.UnsetParam(&params, name)
+		} else {
+			err = api.SetParam(&params, name, value)
+		}
+		if err != nil {
+			fmt.Printf("Invalid value: %v\n", err)
+			continue
+		}
+
+		if err := db.SetChatParams(chat.ID, params); err != nil {
+			fmt.Printf("Failed to save parameters: %v\n", err)
+			continue
+		}
+		fmt.Printf("%s updated.\n", name)
+	}
+}
@@ -0,0 +1,191 @@
+package menu
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Utility-Gods/gottem/internal/db"
+	"github.com/manifoldco/promptui"
+)
+
+// ProvidersMenu manages user-defined OpenAI-compatible providers
+func ProvidersMenu() {
+	for {
+		prompt := promptui.Select{
+			Label: "Compatible Providers",
+			Items: []string{"Add Provider", "View Providers", "Delete Provider", "Back to Settings"},
+		}
+
+		_, result, err := prompt.Run()
+		if err != nil {
+			fmt.Printf("Prompt failed %v\n", err)
+			return
+		}
+
+		switch result {
+		case "Add Provider":
+			AddProvider()
+		case "View Providers":
+			ViewProviders()
+		case "Delete Provider":
+			DeleteProvider()
+		case "Back to Settings":
+			return
+		}
+	}
+}
+
+func AddProvider() {
+	fields := []struct {
+		label    string
+		fallback string
+	}{
+		{"Name (e.g. OpenRouter)", ""},
+		{"Shortcut (single letter used in the editor)", ""},
+		{"Base URL (e.g. https://openrouter.ai/api/v1)", ""},
+		{"Auth header", "Authorization"},
+		{"Auth scheme (leave empty to send the bare key)", "Bearer"},
+		{"Default model", ""},
+		{"Extra headers (Name=Value, comma separated)", ""},
+	}
+
+	values := make([]string, len(fields))
+	for i, field := range fields {
+		prompt := promptui.Prompt{
+			Label:   field.label,
+			Default: field.fallback,
+		}
+		value, err := prompt.Run()
+		if err != nil {
+			fmt.Printf("Prompt failed %v\n", err)
+			return
+		}
+		values[i] = strings.TrimSpace(value)
+	}
+
+	if values[0] == "" || values[1] == "" || values[2] == "" {
+		fmt.Println("Name, shortcut and base URL are required.")
+		return
+	}
+
+	headers, err := parseHeaders(values[6])
+	if err != nil {
+		fmt.Printf("Invalid headers: %v\n", err)
+		return
+	}
+
+	provider := db.CompatibleProvider{
+		Name:         values[0],
+		Shortcut:     values[1],
+		BaseURL:      values[2],
+		AuthHeader:   values[3],
+		AuthScheme:   values[4],
+		DefaultModel: values[5],
+		Headers:      headers,
+	}
+	if err := db.SaveCompatibleProvider(provider); err != nil {
+		fmt.Printf("Failed to save provider: %v\n", err)
+		return
+	}
+	fmt.Printf("%s saved successfully.\n", provider.Name)
+
+	keyPrompt := promptui.Prompt{
+		Label:     "Set an API key for this provider now",
+		IsConfirm: true,
+	}
+	if _, err := keyPrompt.Run(); err == nil {
+		setAPIKey(provider.Name)
+	}
+}
+
+func ViewProviders() {
+	providers, err := db.GetCompatibleProviders()
+	if err != nil {
+		fmt.Printf("Error retrieving providers: %v\n", err)
+		return
+	}
+
+	if len(providers) == 0 {
+		fmt.Println("No compatible providers configured.")
+		return
+	}
+
+	fmt.Println("\n--- Compatible Providers ---")
+	for _, p := range providers {
+		fmt.Printf("Name: %s\nShortcut: %s\nBase URL: %s\nAuth: %s %s\nModel: %s\n", p.Name, p.Shortcut, p.BaseURL, p.AuthHeader, p.AuthScheme, p.DefaultModel)
+		for name := range p.Headers {
+			fmt.Printf("Header: %s\n", name)
+		}
+		fmt.Println()
+	}
+
+	prompt := promptui.Prompt{
+		Label:     "Press Enter to continue",
+		IsConfirm: true,
+	}
+	_, err = prompt.Run()
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+	}
+}
+
+func DeleteProvider() {
+	providers, err := db.GetCompatibleProviders()
+	if err != nil {
+		fmt.Printf("Error retrieving providers: %v\n", err)
+		return
+	}
+
+	if len(providers) == 0 {
+		fmt.Println("No compatible providers configured.")
+		return
+	}
+
+	var items []string
+	for _, p := range providers {
+		items = append(items, p.Name)
+	}
+	items = append(items, "Cancel")
+
+	prompt := promptui.Select{
+		Label: "Select provider to delete",
+		Items: items,
+	}
+
+	_, result, err := prompt.Run()
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+		return
+	}
+
+	if result == "Cancel" {
+		return
+	}
+
+	if err := db.DeleteCompatibleProvider(result); err != nil {
+		fmt.Printf("Error deleting provider: %v\n", err)
+		return
+	}
+	if err := db.DeleteAPIKey(result); err != nil {
+		fmt.Printf("Error deleting API key: %v\n", err)
+		return
+	}
+	fmt.Printf("%s deleted successfully.\n", result)
+}
+
+// parseHeaders parses "Name=Value, Other=Value" into a header map
+func parseHeaders(input string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(input, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("expected Name=Value, got %q", pair)
+		}
+		headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
@@ -0,0 +1,177 @@
+package menu
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/Utility-Gods/gottem/internal/api"
+	"github.com/Utility-Gods/gottem/internal/db"
+	"github.com/manifoldco/promptui"
+)
+
+// RateLimitMenu manages the client-side rate limits of each provider
+func RateLimitMenu() {
+	for {
+		prompt := promptui.Select{
+			Label: "Rate Limits",
+			Items: []string{"Edit Rate Limits", "View Rate Limits", "Reset Rate Limits", "Back to Settings"},
+		}
+
+		_, result, err := prompt.Run()
+		if err != nil {
+			fmt.Printf("Prompt failed %v\n", err)
+			return
+		}
+
+		switch result {
+		case "Edit Rate Limits":
+			EditRateLimits()
+		case "View Rate Limits":
+			ViewRateLimits()
+		case "Reset Rate Limits":
+			ResetRateLimits()
+		case "Back to Settings":
+			return
+		}
+	}
+}
+
+func EditRateLimits() {
+	prompt := promptui.Select{
+		Label: "Select provider",
+		Items: api.NetworkProviders(),
+	}
+	_, provider, err := prompt.Run()
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+		return
+	}
+
+	limits, err := db.GetRateLimits(provider)
+	if err != nil {
+		fmt.Printf("Error retrieving rate limits: %v\n", err)
+		return
+	}
+
+	fmt.Println("\nQueries over a limit wait their turn instead of failing. Enter 0 for no limit.")
+	fmt.Println("Tokens are estimated from the conversation plus max_tokens.")
+
+	if limits.RequestsPerMinute, err = promptLimit("Requests per minute", limits.RequestsPerMinute); err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+		return
+	}
+	if limits.TokensPerMinute, err = promptLimit("Tokens per minute", limits.TokensPerMinute); err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+		return
+	}
+	if limits.MaxConcurrent, err = promptLimit("Concurrent requests", limits.MaxConcurrent); err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+		return
+	}
+
+	if err := api.SaveRateLimits(limits); err != nil {
+		fmt.Printf("Failed to save rate limits: %v\n", err)
+		return
+	}
+	fmt.Printf("Rate limits for %s saved.\n", provider)
+}
+
+func ViewRateLimits() {
+	all, err := db.GetAllRateLimits()
+	if err != nil {
+		fmt.Printf("Error retrieving rate limits: %v\n", err)
+		return
+	}
+
+	if len(all) == 0 {
+		fmt.Println("No rate limits saved, queries are sent as soon as they are made.")
+		return
+	}
+
+	fmt.Println("\n--- Rate Limits ---")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Provider\tRequests/min\tTokens/min\tConcurrent")
+	for _, l := range all {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", l.Provider, formatRate(l.RequestsPerMinute), formatRate(l.TokensPerMinute), formatRate(l.MaxConcurrent))
+	}
+	w.Flush()
+	fmt.Println()
+
+	prompt := promptui.Prompt{
+		Label:     "Press Enter to continue",
+		IsConfirm: true,
+	}
+	_, err = prompt.Run()
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+	}
+}
+
+func ResetRateLimits() {
+	all, err := db.GetAllRateLimits()
+	if err != nil {
+		fmt.Printf("Error retrieving rate limits: %v\n", err)
+		return
+	}
+
+	if len(all) == 0 {
+		fmt.Println("No rate limits saved.")
+		return
+	}
+
+	var items []string
+	for _, l := range all {
+		items = append(items, l.Provider)
+	}
+	items = append(items, "Cancel")
+
+	prompt := promptui.Select{
+		Label: "Select provider to reset",
+		Items: items,
+	}
+
+	_, result, err := prompt.Run()
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+		return
+	}
+
+	if result == "Cancel" {
+		return
+	}
+
+	if err := api.ResetRateLimits(result); err != nil {
+		fmt.Printf("Error resetting rate limits: %v\n", err)
+		return
+	}
+	fmt.Printf("%s is no longer rate limited.\n", result)
+}
+
+func promptLimit(label string, current int) (int, error) {
+	prompt := promptui.Prompt{
+		Label:   label,
+		Default: strconv.Itoa(current),
+		Validate: func(input string) error {
+			n, err := strconv.Atoi(input)
+			if err != nil || n < 0 {
+				return fmt.Errorf("enter a whole number, 0 for no limit")
+			}
+			return nil
+		},
+	}
+
+	value, err := prompt.Run()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(value)
+}
+
+func formatRate(n int) string {
+	if n == 0 {
+		return "none"
+	}
+	return strconv.Itoa(n)
+}
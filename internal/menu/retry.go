@@ -0,0 +1,78 @@
+package menu
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Utility-Gods/gottem/internal/api"
+	"github.com/manifoldco/promptui"
+)
+
+// RetrySettings edits how failed requests are retried
+func RetrySettings() {
+	policy := api.LoadRetryPolicy()
+
+	fmt.Println("\n--- Retry Settings ---")
+	fmt.Println("Rate limits, server errors and network failures are retried with exponential backoff.")
+	fmt.Println("Durations use Go syntax, for example 500ms, 2s or 1m.")
+
+	attemptsPrompt := promptui.Prompt{
+		Label:   "Max attempts (1 disables retries)",
+		Default: strconv.Itoa(policy.MaxAttempts),
+		Validate: func(input string) error {
+			n, err := strconv.Atoi(input)
+			if err != nil || n < 1 {
+				return fmt.Errorf("enter a whole number of at least 1")
+			}
+			return nil
+		},
+	}
+	attempts, err := attemptsPrompt.Run()
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+		return
+	}
+
+	baseDelay, err := promptDuration("Base delay", policy.BaseDelay)
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+		return
+	}
+
+	maxDelay, err := promptDuration("Max delay", policy.MaxDelay)
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+		return
+	}
+
+	policy.MaxAttempts, _ = strconv.Atoi(attempts)
+	policy.BaseDelay = baseDelay
+	policy.MaxDelay = maxDelay
+
+	if err := api.SaveRetryPolicy(policy); err != nil {
+		fmt.Printf("Failed to save retry settings: %v\n", err)
+		return
+	}
+	fmt.Println("Retry settings saved. They apply the next time you run the CLI.")
+}
+
+func promptDuration(label string, current time.Duration) (time.Duration, error) {
+	prompt := promptui.Prompt{
+		Label:   label,
+		Default: current.String(),
+		Validate: func(input string) error {
+			d, err := time.ParseDuration(input)
+			if err != nil || d <= 0 {
+				return fmt.Errorf("enter a positive duration such as 2s")
+			}
+			return nil
+		},
+	}
+
+	value, err := prompt.Run()
+	if err != nil {
+		return 0, err
+	}
+	return time.ParseDuration(value)
+}
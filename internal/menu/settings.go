@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/Utility-Gods/gottem/internal/api"
 	"github.com/Utility-Gods/gottem/internal/db"
 	"github.com/manifoldco/promptui"
 )
@@ -12,7 +13,7 @@ func SettingsMenu() {
 	for {
 		prompt := promptui.Select{
 			Label: "Settings Menu",
-			Items: []string{"Set API Keys", "View API Keys", "Delete API Key", "Flush DB", "Run Migration", "Back to Main Menu"},
+			Items: []string{"Set API Keys", "View API Keys", "Delete API Key", "Key Encryption", "Compatible Providers", "Fallback Chains", "Chat Parameters", "Retry Settings", "Network Settings", "Rate Limits", "Response Cache", "Usage & Costs", "Budgets", "Configuration Sources", "Flush DB", "Run Migration", "Back to Main Menu"},
 		}
 
 		_, result, err := prompt.Run()
@@ -28,6 +29,28 @@ func SettingsMenu() {
 			ViewAPIKeys()
 		case "Delete API Key":
 			DeleteAPIKey()
+		case "Key Encryption":
+			KeyEncryptionMenu()
+		case "Compatible Providers":
+			ProvidersMenu()
+		case "Fallback Chains":
+			FallbackMenu()
+		case "Chat Parameters":
+			ChatParamsMenu()
+		case "Retry Settings":
+			RetrySettings()
+		case "Network Settings":
+			NetworkMenu()
+		case "Rate Limits":
+			RateLimitMenu()
+		case "Response Cache":
+			CacheMenu()
+		case "Usage & Costs":
+			UsageMenu()
+		case "Budgets":
+			BudgetMenu()
+		case "Configuration Sources":
+			ViewConfigSources()
 		case "Flush DB":
 			FlushDB()
 		case "Run Migration":
@@ -65,21 +88,30 @@ func APIKeyMenu() {
 }
 
 func ViewAPIKeys() {
-	apiKeys, err := db.GetAllAPIKeys()
+	// Keys saved in a locked database are listed without their value
+	UnlockKeys()
+
+	keys, err := api.APIKeySources()
 	if err != nil {
 		fmt.Printf("Error retrieving API keys: %v\n", err)
 		return
 	}
 
-	if len(apiKeys) == 0 {
+	var found []api.KeySource
+	for _, key := range keys {
+		if key.Source != "" {
+			found = append(found, key)
+		}
+	}
+	if len(found) == 0 {
 		fmt.Println("No API keys found.")
 		return
 	}
 
 	fmt.Println("\n--- API Keys ---")
-	for _, key := range apiKeys {
-		maskedKey := maskAPIKey(key.APIKey)
-		fmt.Printf("API Name: %s\nAPI Key: %s\n\n", key.APIName, maskedKey)
+	for _, key := range found {
+		maskedKey := maskAPIKey(key.Key)
+		fmt.Printf("API Name: %s\nAPI Key: %s\nSource: %s\n\n", key.Name, maskedKey, key)
 	}
 
 	prompt := promptui.Prompt{
@@ -93,22 +125,18 @@ func ViewAPIKeys() {
 }
 
 func DeleteAPIKey() {
-	apiKeys, err := db.GetAllAPIKeys()
+	names, err := db.GetAPIKeyNames()
 	if err != nil {
 		fmt.Printf("Error retrieving API keys: %v\n", err)
 		return
 	}
 
-	if len(apiKeys) == 0 {
+	if len(names) == 0 {
 		fmt.Println("No API keys found.")
 		return
 	}
 
-	var items []string
-	for _, key := range apiKeys {
-		items = append(items, key.APIName)
-	}
-	items = append(items, "Cancel")
+	items := append(names, "Cancel")
 
 	prompt := promptui.Select{
 		Label: "Select API Key to delete",
@@ -149,6 +177,10 @@ func DeleteAPIKey() {
 }
 
 func setAPIKey(apiName string) {
+	if !requirePassphrase() {
+		return
+	}
+
 	prompt := promptui.Prompt{
 		Label: fmt.Sprintf("Enter %s API Key", apiName),
 		Mask:  '*',
@@ -166,6 +198,9 @@ func setAPIKey(apiName string) {
 	}
 
 	fmt.Printf("%s API Key set successfully.\n", apiName)
+	if key, err := api.LookupAPIKey(apiName); err == nil && key.Source != api.SourceDatabase {
+		fmt.Printf("Note: the key from the %s is used instead of the saved one.\n", key)
+	}
 }
 
 func setOtherAPIKey() {
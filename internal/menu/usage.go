@@ -0,0 +1,209 @@
+package menu
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/Utility-Gods/gottem/internal/db"
+	"github.com/manifoldco/promptui"
+)
+
+// UsageMenu shows token usage reports and edits the model price table
+func UsageMenu() {
+	for {
+		prompt := promptui.Select{
+			Label: "Usage & Costs",
+			Items: []string{"Usage by Provider", "Usage by Day", "Set Model Price", "View Model Prices", "Delete Model Price", "Back to Settings"},
+		}
+
+		_, result, err := prompt.Run()
+		if err != nil {
+			fmt.Printf("Prompt failed %v\n", err)
+			return
+		}
+
+		switch result {
+		case "Usage by Provider":
+			showUsageReport("Usage by Provider", "Provider", db.GetUsageByProvider)
+		case "Usage by Day":
+			showUsageReport("Usage by Day (last 30 days)", "Day", func() ([]db.UsageReportRow, error) {
+				return db.GetUsageByDay(30)
+			})
+		case "Set Model Price":
+			SetModelPrice()
+		case "View Model Prices":
+			ViewModelPrices()
+		case "Delete Model Price":
+			DeleteModelPrice()
+		case "Back to Settings":
+			return
+		}
+	}
+}
+
+func showUsageReport(title, keyName string, load func() ([]db.UsageReportRow, error)) {
+	report, err := load()
+	if err != nil {
+		fmt.Printf("Error retrieving usage: %v\n", err)
+		return
+	}
+
+	if len(report) == 0 {
+		fmt.Println("No usage recorded yet.")
+		return
+	}
+
+	fmt.Printf("\n--- %s ---\n", title)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "%s\tRequests\tInput tokens\tOutput tokens\tCost\t\n", keyName)
+	var total db.UsageTotals
+	for _, row := range report {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t$%.4f\t\n", row.Key, row.Requests, row.InputTokens, row.OutputTokens, row.Cost)
+		total.Requests += row.Requests
+		total.InputTokens += row.InputTokens
+		total.OutputTokens += row.OutputTokens
+		total.Cost += row.Cost
+	}
+	fmt.Fprintf(w, "Total\t%d\t%d\t%d\t$%.4f\t\n", total.Requests, total.InputTokens, total.OutputTokens, total.Cost)
+	w.Flush()
+	fmt.Println()
+
+	prompt := promptui.Prompt{
+		Label:     "Press Enter to continue",
+		IsConfirm: true,
+	}
+	_, err = prompt.Run()
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+	}
+}
+
+func SetModelPrice() {
+	fmt.Println("\nPrices are in US dollars per million tokens.")
+	fmt.Println("A price applies to every model whose name starts with it, e.g. claude-3-opus.")
+
+	modelPrompt := promptui.Prompt{Label: "Model"}
+	model, err := modelPrompt.Run()
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+		return
+	}
+
+	current, err := db.GetModelPrice(model)
+	if err != nil {
+		fmt.Printf("Error retrieving price: %v\n", err)
+		return
+	}
+
+	inputPrice, err := promptAmount("Input price", current.InputPrice)
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+		return
+	}
+
+	outputPrice, err := promptAmount("Output price", current.OutputPrice)
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+		return
+	}
+
+	price := db.ModelPrice{Model: model, InputPrice: inputPrice, OutputPrice: outputPrice}
+	if err := db.SaveModelPrice(price); err != nil {
+		fmt.Printf("Failed to save price: %v\n", err)
+		return
+	}
+	fmt.Printf("Price for %s saved. It applies to requests from now on.\n", model)
+}
+
+func promptAmount(label string, current float64) (float64, error) {
+	prompt := promptui.Prompt{
+		Label:   label,
+		Default: strconv.FormatFloat(current, 'f', -1, 64),
+		Validate: func(input string) error {
+			v, err := strconv.ParseFloat(input, 64)
+			if err != nil || v < 0 {
+				return fmt.Errorf("enter an amount of 0 or more")
+			}
+			return nil
+		},
+	}
+
+	value, err := prompt.Run()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+func ViewModelPrices() {
+	prices, err := db.GetModelPrices()
+	if err != nil {
+		fmt.Printf("Error retrieving model prices: %v\n", err)
+		return
+	}
+
+	if len(prices) == 0 {
+		fmt.Println("No model prices configured.")
+		return
+	}
+
+	fmt.Println("\n--- Model Prices (USD per million tokens) ---")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Model\tInput\tOutput")
+	for _, price := range prices {
+		fmt.Fprintf(w, "%s\t%.2f\t%.2f\n", price.Model, price.InputPrice, price.OutputPrice)
+	}
+	w.Flush()
+	fmt.Println()
+
+	prompt := promptui.Prompt{
+		Label:     "Press Enter to continue",
+		IsConfirm: true,
+	}
+	_, err = prompt.Run()
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+	}
+}
+
+func DeleteModelPrice() {
+	prices, err := db.GetModelPrices()
+	if err != nil {
+		fmt.Printf("Error retrieving model prices: %v\n", err)
+		return
+	}
+
+	if len(prices) == 0 {
+		fmt.Println("No model prices configured.")
+		return
+	}
+
+	var items []string
+	for _, price := range prices {
+		items = append(items, price.Model)
+	}
+	items = append(items, "Cancel")
+
+	prompt := promptui.Select{
+		Label: "Select model price to delete",
+		Items: items,
+	}
+
+	_, result, err := prompt.Run()
+	if err != nil {
+		fmt.Printf("Prompt failed %v\n", err)
+		return
+	}
+
+	if result == "Cancel" {
+		return
+	}
+
+	if err := db.DeleteModelPrice(result); err != nil {
+		fmt.Printf("Error deleting model price: %v\n", err)
+		return
+	}
+	fmt.Printf("Price for %s deleted.\n", result)
+}
@@ -1,10 +1,36 @@
 package types
 
+import (
+	"context"
+	"strings"
+	"time"
+)
+
 // APIInfo holds information about an API
 type APIInfo struct {
-	Name     string
-	Shortcut string
-	Handler  APIHandler
+	Name         string
+	Shortcut     string
+	Handler      APIHandler
+	Capabilities Capabilities
+}
+
+// Capabilities describes what an API supports, so callers can hide actions
+// it cannot perform and refuse requests it would reject
+type Capabilities struct {
+	Streaming    bool // Answers arrive incrementally
+	Vision       bool // Image attachments are accepted
+	Tools        bool // Local tools can be called while answering
+	SystemPrompt bool // System messages are accepted
+	JSONMode     bool // Answers can be constrained to a JSON object
+	// ContextSize is the context window of the model in tokens, zero if
+	// unknown
+	ContextSize int
+}
+
+// CapabilityReporter is implemented by handlers that describe what they
+// support. Handlers that do not are assumed to take plain text only.
+type CapabilityReporter interface {
+	Capabilities() Capabilities
 }
 
 // App represents the main application structure
@@ -12,7 +38,126 @@ type App struct {
 	APIs map[string]APIHandler
 }
 
-// APIHandler interface defines the method that all API handlers must implement
+// Role identifies the author of a message in a conversation
+type Role string
+
+const (
+	RoleSystem    Role = "system"
+	RoleUser      Role = "user"
+	RoleAssistant Role = "assistant"
+)
+
+// Message is a single role-tagged turn in a conversation
+type Message struct {
+	Role        Role
+	Content     string
+	Attachments []Attachment // Files sent along with a user message
+}
+
+// Attachment is a file sent to the model with a message. Images are sent as
+// images and text documents are inlined.
+type Attachment struct {
+	Name     string // As referenced in the message, usually the file's path
+	MIMEType string
+	Data     []byte
+}
+
+// IsImage reports whether the attachment is sent as an image
+func (a Attachment) IsImage() bool {
+	return strings.HasPrefix(a.MIMEType, "image/")
+}
+
+// Request is a query sent to an API handler
+type Request struct {
+	// Messages holds the conversation so far, oldest first, ending with the
+	// user turn that should be answered
+	Messages []Message
+	// Model overrides the handler's default model when set
+	Model string
+	// Params holds the generation parameters for this request
+	Params Params
+	// Summary stands in for the oldest messages when the chat's context
+	// policy is to summarize
+	Summary Summary
+}
+
+// Summary is a model-written summary of the start of a long conversation
+type Summary struct {
+	Text string
+	// Messages is how many leading non-system messages the summary replaces
+	Messages int
+}
+
+// Params holds generation parameters and the system prompt for a chat. Zero
+// values and nil pointers leave the provider's defaults in place.
+type Params struct {
+	MaxTokens    int
+	Temperature  *float64
+	TopP         *float64
+	Stop         []string
+	SystemPrompt string
+	// ContextPolicy says what to do when the conversation outgrows the
+	// model's context window: "truncate" (the default), "summarize" or "off"
+	ContextPolicy string
+	// Cache reuses the stored answer when the same request was sent before
+	Cache bool
+	// JSON asks for the answer as a JSON object, for APIs with a JSON mode
+	JSON bool
+	// Continue asks for the rest of an answer cut off by max_tokens, up to
+	// this many times
+	Continue int
+}
+
+// Response is the reply returned by an API handler
+type Response struct {
+	Text     string
+	Model    string
+	Provider string        // Name of the API that produced the response
+	Usage    Usage         // Tokens used, when the provider reports them
+	Latency  time.Duration // Time taken to answer, set by the app
+	Summary  *Summary      // Set when the conversation was summarized again
+	Cached   bool          // The answer came from the response cache
+	Tools    int           // Tool calls made while answering
+	// StopReason is why the model stopped, as the provider reported it
+	StopReason string
+	// Truncated is set when the answer was cut off by max_tokens
+	Truncated bool
+	// Continuations counts the extra requests made to finish a truncated
+	// answer
+	Continuations int
+}
+
+// Usage counts the tokens consumed by a request
+type Usage struct {
+	InputTokens  int
+	OutputTokens int
+}
+
+// APIHandler interface defines the method that all API handlers must implement.
+// Cancelling ctx aborts the request.
 type APIHandler interface {
-	HandleQuery(query string) string
+	HandleQuery(ctx context.Context, req Request) (Response, error)
+}
+
+// StreamingAPIHandler is implemented by handlers that can deliver a response
+// incrementally. onDelta is called for every chunk of text as it arrives and
+// the full response is returned once the stream is complete.
+type StreamingAPIHandler interface {
+	APIHandler
+	StreamQuery(ctx context.Context, req Request, onDelta func(delta string)) (Response, error)
+}
+
+// ContextLimiter is implemented by handlers that know how large a
+// conversation their models accept. Sizes and estimates are in tokens, and
+// a size of zero means unknown.
+type ContextLimiter interface {
+	ContextSize(model string) int
+	EstimateTokens(text string) int
+}
+
+// ModelLister is implemented by handlers that can report which models they
+// can be used with
+type ModelLister interface {
+	ListModels(ctx context.Context) ([]string, error)
+	DefaultModel() string
 }
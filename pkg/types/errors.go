@@ -0,0 +1,72 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrorKind classifies failures returned by API handlers
+type ErrorKind int
+
+const (
+	ErrUnknown ErrorKind = iota
+	ErrAuth
+	ErrRateLimit
+	ErrNetwork
+	ErrBadRequest
+	ErrServer
+	ErrBudget
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrAuth:
+		return "authentication error"
+	case ErrRateLimit:
+		return "rate limited"
+	case ErrNetwork:
+		return "network error"
+	case ErrBadRequest:
+		return "bad request"
+	case ErrServer:
+		return "server error"
+	case ErrBudget:
+		return "budget exceeded"
+	default:
+		return "unknown error"
+	}
+}
+
+// APIError is the error type returned by API handlers
+type APIError struct {
+	Kind       ErrorKind
+	Provider   string
+	StatusCode int
+	Message    string
+	Err        error
+}
+
+func (e *APIError) Error() string {
+	msg := e.Message
+	if msg == "" && e.Err != nil {
+		msg = e.Err.Error()
+	}
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("%s: %s (HTTP %d): %s", e.Provider, e.Kind, e.StatusCode, msg)
+	}
+	return fmt.Sprintf("%s: %s: %s", e.Provider, e.Kind, msg)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorKindOf returns the kind of an APIError anywhere in err's chain, or
+// ErrUnknown if there is none
+func ErrorKindOf(err error) ErrorKind {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Kind
+	}
+	return ErrUnknown
+}
@@ -100,7 +100,7 @@ for platform in "${PLATFORMS[@]}"; do
     fi
 
     echo "Building for $GOOS $GOARCH..."
-    GOOS=$GOOS GOARCH=$GOARCH go build -o $RELEASE_DIR/${output_name}_${GOOS}_${GOARCH}
+    GOOS=$GOOS GOARCH=$GOARCH go build -tags sqlite_fts5 -o $RELEASE_DIR/${output_name}_${GOOS}_${GOARCH}
 done
 
 # Copy assets and create README